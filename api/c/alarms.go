@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
+	sipapi "github.com/panjjo/gosip/sip"
+)
+
+// AlarmsListResponse 报警列表，字段与其他列表接口一致
+type AlarmsListResponse struct {
+	Total int64           `json:"Total"`
+	List  []sipapi.Alarms `json:"List"`
+}
+
+// @Summary     报警列表接口
+// @Description 查询设备上报的报警记录，可按通道、报警类型和报警时间筛选
+// @Tags        alarms
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       channelid query    string  false "报警通道id"
+// @Param       type      query    integer false "报警类型"
+// @Param       start     query    integer false "报警开始时间，时间戳"
+// @Param       end       query    integer false "报警结束时间，时间戳"
+// @Param       limit     query    integer false "条数(0-100) 默认20"
+// @Param       skip      query    integer false "间隔 默认0"
+// @Param       sort      query    string  false "排序,例:-key,根据key倒序,key,根据key正序"
+// @Success     0         {object} AlarmsListResponse
+// @Failure     1000      {object} string
+// @Failure     1001      {object} string
+// @Failure     1002      {object} string
+// @Failure     1003      {object} string
+// @Router      /alarms [get]
+func AlarmsList(c *gin.Context) {
+	limit := m.GetLimit(c)
+	skip := m.GetSkip(c)
+	sort := m.GetSort(c)
+	where, err := alarmsWhere(c.Query)
+	if err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, err.Error())
+		return
+	}
+	alarms := []sipapi.Alarms{}
+	total, err := db.FindT(db.DBClient, new(sipapi.Alarms), &alarms, where, sort, skip, limit, true)
+	if err != nil {
+		m.JsonResponse(c, m.StatusDBERR, err)
+		return
+	}
+	m.JsonResponse(c, m.StatusSucc, AlarmsListResponse{
+		Total: total,
+		List:  alarms,
+	})
+}
+
+// alarmsWhere 报警列表的筛选条件
+func alarmsWhere(query func(string) string) (db.M, error) {
+	where := db.M{}
+	if channelid := query("channelid"); channelid != "" {
+		where["channelid=?"] = channelid
+	}
+	for k, w := range map[string]string{"type": "alarmtype=?", "start": "alarmtime>=?", "end": "alarmtime<=?"} {
+		v := query(k)
+		if v == "" {
+			continue
+		}
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, errors.New(k + "错误")
+		}
+		where[w] = i
+	}
+	return where, nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import "testing"
+
+func TestAlarmsWhere(t *testing.T) {
+	params := map[string]string{"channelid": "34020000001340000001", "type": "2", "start": "1700000000", "end": "1700003600"}
+	where, err := alarmsWhere(func(k string) string { return params[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"channelid=?":  "34020000001340000001",
+		"alarmtype=?":  int64(2),
+		"alarmtime>=?": int64(1700000000),
+		"alarmtime<=?": int64(1700003600),
+	}
+	if len(where) != len(want) {
+		t.Fatalf("where %v, want %v", where, want)
+	}
+	for k, v := range want {
+		if where[k] != v {
+			t.Errorf("%s: %v, want %v", k, where[k], v)
+		}
+	}
+	// 未传的条件不参与筛选
+	if where, _ := alarmsWhere(func(string) string { return "" }); len(where) != 0 {
+		t.Fatalf("empty query where %v", where)
+	}
+	for _, k := range []string{"type", "start", "end"} {
+		if _, err := alarmsWhere(func(q string) string {
+			if q == k {
+				return "abc"
+			}
+			return ""
+		}); err == nil {
+			t.Errorf("%s: want error", k)
+		}
+	}
+}
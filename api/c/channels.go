@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/panjjo/gorm"
@@ -83,6 +84,8 @@ func ChannelCreate(c *gin.Context) {
 // @Param       memo       formData string false "通道备注"
 // @Param       streamtype formData string false "播放类型，pull 媒体服务器拉流，push 摄像头推流,默认push"
 // @Param       url        formData string false "静态拉流地址，streamtype=pull 时生效。"
+// @Param       longitude  formData number false "经度"
+// @Param       latitude   formData number false "纬度"
 // @Success     0          {object} sipapi.Channels
 // @Failure     1000       {object} string
 // @Failure     1001       {object} string
@@ -119,6 +122,22 @@ func ChannelsUpdate(c *gin.Context) {
 	if streamtype != "" && channel.StreamType == m.StreamTypePull {
 		channel.URL = url
 	}
+	if v := c.PostForm("longitude"); v != "" {
+		longitude, err := strconv.ParseFloat(v, 64)
+		if err != nil || longitude < -180 || longitude > 180 {
+			m.JsonResponse(c, m.StatusParamsERR, "longitude错误")
+			return
+		}
+		channel.Longitude = longitude
+	}
+	if v := c.PostForm("latitude"); v != "" {
+		latitude, err := strconv.ParseFloat(v, 64)
+		if err != nil || latitude < -90 || latitude > 90 {
+			m.JsonResponse(c, m.StatusParamsERR, "latitude错误")
+			return
+		}
+		channel.Latitude = latitude
+	}
 
 	if err := db.Save(db.DBClient, channel); err != nil {
 		m.JsonResponse(c, m.StatusDBERR, err)
@@ -2,12 +2,14 @@ package api
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/panjjo/gorm"
 	"github.com/panjjo/gosip/db"
 	"github.com/panjjo/gosip/m"
 	sipapi "github.com/panjjo/gosip/sip"
+	sip "github.com/panjjo/gosip/sip/s"
 )
 
 // @Summary     设备新增接口
@@ -15,8 +17,9 @@ import (
 // @Tags        devices
 // @Accept      x-www-form-urlencoded
 // @Produce     json
-// @Param       pwd  formData string true "设备密码(GB28181认证密码)"
-// @Param       name formData string true "设备名称"
+// @Param       pwd       formData string true  "设备密码(GB28181认证密码)"
+// @Param       name      formData string true  "设备名称"
+// @Param       algorithm formData string false "注册认证摘要算法 MD5 MD5-sess SHA-256 SHA-256-sess，默认MD5"
 // @Success     0    {object} sipapi.Devices
 // @Failure     1000 {object} string
 // @Failure     1001 {object} string
@@ -29,12 +32,18 @@ func DevicesCreate(c *gin.Context) {
 		m.JsonResponse(c, m.StatusParamsERR, "密码不能为空")
 		return
 	}
+	algorithm := c.PostForm("algorithm")
+	if !sip.ValidAlgorithm(algorithm) {
+		m.JsonResponse(c, m.StatusParamsERR, "不支持的认证算法")
+		return
+	}
 	name := c.PostForm("name")
 	device := sipapi.Devices{
-		DeviceID: fmt.Sprintf("%s%06d", m.MConfig.GB28181.DID, m.MConfig.GB28181.DNUM+1),
-		Region:   m.MConfig.GB28181.Region,
-		PWD:      pwd,
-		Name:     name,
+		DeviceID:  fmt.Sprintf("%s%06d", m.MConfig.GB28181.DID, m.MConfig.GB28181.DNUM+1),
+		Region:    m.MConfig.GB28181.Region,
+		PWD:       pwd,
+		Name:      name,
+		Algorithm: algorithm,
 	}
 	if device.Name == "" {
 		device.Name = device.DeviceID
@@ -65,14 +74,18 @@ func DevicesCreate(c *gin.Context) {
 // @Tags        devices
 // @Accept      x-www-form-urlencoded
 // @Produce     json
-// @Param       id   path     string true "设备id"
-// @Param       pwd  formData string false "设备密码(GB28181认证密码)"
-// @Param       name formData string false "设备名称"
-// @Success     0    {object} sipapi.Devices
-// @Failure     1000 {object} string
-// @Failure     1001 {object} string
-// @Failure     1002 {object} string
-// @Failure     1003 {object} string
+// @Param       id                path     string  true  "设备id"
+// @Param       pwd               formData string  false "设备密码(GB28181认证密码)"
+// @Param       name              formData string  false "设备名称"
+// @Param       algorithm         formData string  false "注册认证摘要算法 MD5 MD5-sess SHA-256 SHA-256-sess"
+// @Param       keepaliveinterval formData integer false "心跳间隔，单位秒，默认60"
+// @Param       keepalivetimeout  formData integer false "心跳超时次数，连续未收到心跳的次数达到后设备离线，默认3"
+// @Param       positioninterval  formData integer false "移动位置上报间隔，单位秒，为0不订阅移动位置"
+// @Success     0                 {object} sipapi.Devices
+// @Failure     1000              {object} string
+// @Failure     1001              {object} string
+// @Failure     1002              {object} string
+// @Failure     1003              {object} string
 // @Router      /devices/{id} [post]
 func DevicesUpdate(c *gin.Context) {
 	deviceid := c.Param("id")
@@ -97,10 +110,46 @@ func DevicesUpdate(c *gin.Context) {
 	if name != "" {
 		device.Name = name
 	}
+	if algorithm := c.PostForm("algorithm"); algorithm != "" {
+		if !sip.ValidAlgorithm(algorithm) {
+			m.JsonResponse(c, m.StatusParamsERR, "不支持的认证算法")
+			return
+		}
+		device.Algorithm = algorithm
+	}
+	if interval := c.PostForm("keepaliveinterval"); interval != "" {
+		v, err := strconv.Atoi(interval)
+		if err != nil || v < 0 {
+			m.JsonResponse(c, m.StatusParamsERR, "心跳间隔错误")
+			return
+		}
+		device.KeepaliveInterval = v
+	}
+	if timeout := c.PostForm("keepalivetimeout"); timeout != "" {
+		v, err := strconv.Atoi(timeout)
+		if err != nil || v < 0 {
+			m.JsonResponse(c, m.StatusParamsERR, "心跳超时次数错误")
+			return
+		}
+		device.KeepaliveTimeout = v
+	}
+	positionChanged := false
+	if interval := c.PostForm("positioninterval"); interval != "" {
+		v, err := strconv.Atoi(interval)
+		if err != nil || v < 0 {
+			m.JsonResponse(c, m.StatusParamsERR, "移动位置上报间隔错误")
+			return
+		}
+		positionChanged = v != device.PositionInterval
+		device.PositionInterval = v
+	}
 	if err := db.Save(db.DBClient, device); err != nil {
 		m.JsonResponse(c, m.StatusDBERR, err)
 		return
 	}
+	if positionChanged {
+		go sipapi.RefreshPositionSubscribe(device.DeviceID, device.PositionInterval)
+	}
 	m.JsonResponse(c, m.StatusSucc, device)
 }
 
@@ -185,6 +234,40 @@ func DevicesDelete(c *gin.Context) {
 	m.JsonResponse(c, m.StatusSucc, "")
 }
 
+// @Summary     设备状态查询接口
+// @Description 向设备查询在线、录像、编码、设备时间和报警状态，查询结果同时保存为设备的最新状态
+// @Tags        devices
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       id   path     string true "设备id"
+// @Success     0    {object} sipapi.DeviceStatus
+// @Failure     1000 {object} string
+// @Failure     1001 {object} string
+// @Failure     1002 {object} string
+// @Failure     1003 {object} string
+// @Router      /devices/{id}/status [get]
+func DevicesStatus(c *gin.Context) {
+	deviceid := c.Param("id")
+
+	device := &sipapi.Devices{
+		DeviceID: deviceid,
+	}
+	if err := db.Get(db.DBClient, device); err != nil {
+		if db.RecordNotFound(err) {
+			m.JsonResponse(c, m.StatusParamsERR, "设备id不存在")
+			return
+		}
+		m.JsonResponse(c, m.StatusDBERR, err)
+		return
+	}
+	status, err := sipapi.SipDeviceStatus(deviceid)
+	if err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, err)
+		return
+	}
+	m.JsonResponse(c, m.StatusSucc, status)
+}
+
 // // 视频流录制 默认保存为mp4文件，录制最多录制10分钟，10分钟后自动停止，一个流只能存在一个录制
 // func apiRecordStart(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 // 	id := ps.ByName("id")
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjjo/gosip/m"
+	sipapi "github.com/panjjo/gosip/sip"
+)
+
+// 地图查询默认返回条数
+const defaultGeoLimit = 1000
+
+// @Summary     附近通道接口
+// @Description 查询中心点半径范围内设置了坐标的通道，按距离由近到远返回
+// @Tags        channels
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       lng    query    number  true  "中心点经度"
+// @Param       lat    query    number  true  "中心点纬度"
+// @Param       radius query    number  false "半径，单位m，默认1000"
+// @Param       limit  query    integer false "条数 默认1000"
+// @Success     0      {array}  sipapi.NearbyChannel
+// @Failure     1000   {object} string
+// @Failure     1001   {object} string
+// @Failure     1002   {object} string
+// @Failure     1003   {object} string
+// @Router      /channels/nearby [get]
+func ChannelsNearby(c *gin.Context) {
+	lng, ok := geoQuery(c, "lng", -180, 180)
+	if !ok {
+		return
+	}
+	lat, ok := geoQuery(c, "lat", -90, 90)
+	if !ok {
+		return
+	}
+	radius := 1000.0
+	if c.Query("radius") != "" {
+		if radius, ok = geoQuery(c, "radius", 0, 20000000); !ok {
+			return
+		}
+	}
+	channels, err := sipapi.ChannelsNearby(lng, lat, radius, geoLimit(c))
+	if err != nil {
+		m.JsonResponse(c, m.StatusDBERR, err)
+		return
+	}
+	m.JsonResponse(c, m.StatusSucc, channels)
+}
+
+// @Summary     范围内通道接口
+// @Description 查询经纬度矩形范围内设置了坐标的通道，用于地图按可视区域加载
+// @Tags        channels
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       minlng query    number  true  "最小经度"
+// @Param       minlat query    number  true  "最小纬度"
+// @Param       maxlng query    number  true  "最大经度"
+// @Param       maxlat query    number  true  "最大纬度"
+// @Param       limit  query    integer false "条数 默认1000"
+// @Success     0      {array}  sipapi.Channels
+// @Failure     1000   {object} string
+// @Failure     1001   {object} string
+// @Failure     1002   {object} string
+// @Failure     1003   {object} string
+// @Router      /channels/bbox [get]
+func ChannelsBBox(c *gin.Context) {
+	var bounds [4]float64
+	for i, k := range []string{"minlng", "minlat", "maxlng", "maxlat"} {
+		limit := 180.0
+		if i%2 == 1 {
+			limit = 90
+		}
+		v, ok := geoQuery(c, k, -limit, limit)
+		if !ok {
+			return
+		}
+		bounds[i] = v
+	}
+	if bounds[0] > bounds[2] || bounds[1] > bounds[3] {
+		m.JsonResponse(c, m.StatusParamsERR, "范围错误")
+		return
+	}
+	channels, err := sipapi.ChannelsInBounds(bounds[0], bounds[1], bounds[2], bounds[3], geoLimit(c))
+	if err != nil {
+		m.JsonResponse(c, m.StatusDBERR, err)
+		return
+	}
+	m.JsonResponse(c, m.StatusSucc, channels)
+}
+
+// geoQuery 读取坐标参数，参数缺失或超出范围时返回错误响应
+func geoQuery(c *gin.Context, key string, min, max float64) (float64, bool) {
+	v, err := strconv.ParseFloat(c.Query(key), 64)
+	if err != nil || v < min || v > max {
+		m.JsonResponse(c, m.StatusParamsERR, key+"错误")
+		return 0, false
+	}
+	return v, true
+}
+
+func geoLimit(c *gin.Context) int {
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultGeoLimit
+}
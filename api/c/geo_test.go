@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjjo/gosip/m"
+)
+
+func geoContext(query string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/channels/bbox?"+query, nil)
+	return c, w
+}
+
+func TestChannelsBBoxParams(t *testing.T) {
+	cases := map[string]string{
+		"missing":  "minlng=116&minlat=39&maxlng=117",
+		"range":    "minlng=116&minlat=39&maxlng=181&maxlat=40",
+		"lat":      "minlng=116&minlat=-91&maxlng=117&maxlat=40",
+		"inverted": "minlng=117&minlat=39&maxlng=116&maxlat=40",
+	}
+	for name, query := range cases {
+		c, w := geoContext(query)
+		ChannelsBBox(c)
+		if !strings.Contains(w.Body.String(), `"code":"`+m.StatusParamsERR+`"`) {
+			t.Errorf("%s: response %s", name, w.Body.String())
+		}
+	}
+}
+
+func TestGeoLimit(t *testing.T) {
+	for query, want := range map[string]int{"": defaultGeoLimit, "limit=10": 10, "limit=0": defaultGeoLimit, "limit=abc": defaultGeoLimit} {
+		c, _ := geoContext(query)
+		if got := geoLimit(c); got != want {
+			t.Errorf("%q: %d, want %d", query, got, want)
+		}
+	}
+}
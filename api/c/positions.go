@@ -0,0 +1,48 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
+	sipapi "github.com/panjjo/gosip/sip"
+)
+
+// @Summary     移动位置轨迹接口
+// @Description 查询通道在时间段内上报的移动位置，按定位时间正序返回，通道最新位置见通道信息的position
+// @Tags        channels
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       id    path     string true "通道id"
+// @Param       start query    int    true "开始时间，时间戳"
+// @Param       end   query    int    true "结束时间，时间戳"
+// @Success     0     {array}  sipapi.Positions
+// @Failure     1000  {object} string
+// @Failure     1001  {object} string
+// @Failure     1002  {object} string
+// @Failure     1003  {object} string
+// @Router      /channels/{id}/positions [get]
+func PositionsList(c *gin.Context) {
+	channelid := c.Param("id")
+	startStamp, err := strconv.ParseInt(c.Query("start"), 10, 64)
+	if err != nil || startStamp <= 0 {
+		m.JsonResponse(c, m.StatusParamsERR, "开始时间错误")
+		return
+	}
+	endStamp, err := strconv.ParseInt(c.Query("end"), 10, 64)
+	if err != nil || endStamp <= 0 || endStamp <= startStamp {
+		m.JsonResponse(c, m.StatusParamsERR, "结束时间错误")
+		return
+	}
+	positions := []sipapi.Positions{}
+	if _, err := db.FindT(db.DBClient, new(sipapi.Positions), &positions, db.M{
+		"channelid=?":     channelid,
+		"positiontime>=?": startStamp,
+		"positiontime<=?": endStamp,
+	}, "positiontime", -1, -1, false); err != nil {
+		m.JsonResponse(c, m.StatusDBERR, err)
+		return
+	}
+	m.JsonResponse(c, m.StatusSucc, positions)
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
+	sipapi "github.com/panjjo/gosip/sip"
+)
+
+// @Summary     云台控制接口
+// @Description 控制通道云台方向、变倍、聚焦、光圈，持续动作直到发送stop，返回设备的响应码
+// @Tags        channels
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       id        path     string true  "通道id"
+// @Param       cmd       formData string true  "指令 up,down,left,right,upleft,upright,downleft,downright,zoomin,zoomout,focusnear,focusfar,irisopen,irisclose,stop"
+// @Param       speed     formData int    false "水平、垂直、聚焦、光圈速度 0-255，默认128"
+// @Param       zoomspeed formData int    false "变倍速度 0-15，默认8"
+// @Success     0         {object} int
+// @Failure     1000      {object} string
+// @Failure     1001      {object} string
+// @Failure     1002      {object} string
+// @Failure     1003      {object} string
+// @Router      /channels/{id}/ptz [post]
+func ChannelsPTZ(c *gin.Context) {
+	channelid := c.Param("id")
+	ptz := sipapi.PTZControl{Cmd: c.PostForm("cmd"), Speed: 128, ZoomSpeed: 8}
+	if speed := c.PostForm("speed"); speed != "" {
+		s, err := strconv.Atoi(speed)
+		if err != nil {
+			m.JsonResponse(c, m.StatusParamsERR, "速度错误")
+			return
+		}
+		ptz.Speed = s
+	}
+	if speed := c.PostForm("zoomspeed"); speed != "" {
+		s, err := strconv.Atoi(speed)
+		if err != nil {
+			m.JsonResponse(c, m.StatusParamsERR, "变倍速度错误")
+			return
+		}
+		ptz.ZoomSpeed = s
+	}
+	if _, err := ptz.PTZCmd(); err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, err)
+		return
+	}
+
+	channel, ok := ptzChannel(c, channelid)
+	if !ok {
+		return
+	}
+	code, err := sipapi.SipPTZ(channel, ptz)
+	ptzResponse(c, code, err)
+}
+
+// ptzChannel 获取在线的通道，失败时直接返回错误
+func ptzChannel(c *gin.Context, channelid string) (*sipapi.Channels, bool) {
+	channel := &sipapi.Channels{ChannelID: channelid}
+	if err := db.Get(db.DBClient, channel); err != nil {
+		if db.RecordNotFound(err) {
+			m.JsonResponse(c, m.StatusParamsERR, "通道不存在")
+			return nil, false
+		}
+		m.JsonResponse(c, m.StatusDBERR, err)
+		return nil, false
+	}
+	if channel.Status != m.DeviceStatusON {
+		m.JsonResponse(c, m.StatusParamsERR, "通道已离线")
+		return nil, false
+	}
+	return channel, true
+}
+
+// ptzResponse 返回设备对控制指令的响应码
+func ptzResponse(c *gin.Context, code int, err error) {
+	if err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, err)
+		return
+	}
+	if code != http.StatusOK {
+		m.JsonResponse(c, m.StatusParamsERR, fmt.Sprintf("设备响应%d", code))
+		return
+	}
+	m.JsonResponse(c, m.StatusSucc, code)
+}
+
+// @Summary     预置位列表接口
+// @Description 查询设备上实际存在的预置位，名称优先使用平台设置的名称
+// @Tags        channels
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       id   path     string true "通道id"
+// @Success     0    {array}  sipapi.Presets
+// @Failure     1000 {object} string
+// @Failure     1001 {object} string
+// @Failure     1002 {object} string
+// @Failure     1003 {object} string
+// @Router      /channels/{id}/presets [get]
+func PresetsList(c *gin.Context) {
+	channel, ok := ptzChannel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	list, err := sipapi.SipPresetList(channel)
+	if err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, err)
+		return
+	}
+	m.JsonResponse(c, m.StatusSucc, list)
+}
+
+// @Summary     设置预置位接口
+// @Description 将云台当前位置设置为预置位，返回设备的响应码
+// @Tags        channels
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       id       path     string true  "通道id"
+// @Param       presetid formData int    true  "预置位号 1-255"
+// @Param       name     formData string false "预置位名称"
+// @Success     0        {object} int
+// @Failure     1000     {object} string
+// @Failure     1001     {object} string
+// @Failure     1002     {object} string
+// @Failure     1003     {object} string
+// @Router      /channels/{id}/presets [post]
+func PresetsSet(c *gin.Context) {
+	presetid, err := strconv.Atoi(c.PostForm("presetid"))
+	if err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, "预置位号错误")
+		return
+	}
+	if _, err := sipapi.PresetCmd(sipapi.PresetSet, presetid); err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, err)
+		return
+	}
+	channel, ok := ptzChannel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	code, err := sipapi.SipPresetSet(channel, presetid, c.PostForm("name"))
+	ptzResponse(c, code, err)
+}
+
+// @Summary     调用预置位接口
+// @Description 云台转到预置位，返回设备的响应码
+// @Tags        channels
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       id       path     string true "通道id"
+// @Param       presetid path     int    true "预置位号 1-255"
+// @Success     0        {object} int
+// @Failure     1000     {object} string
+// @Failure     1001     {object} string
+// @Failure     1002     {object} string
+// @Failure     1003     {object} string
+// @Router      /channels/{id}/presets/{presetid} [post]
+func PresetsCall(c *gin.Context) {
+	presetid, err := strconv.Atoi(c.Param("presetid"))
+	if err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, "预置位号错误")
+		return
+	}
+	channel, ok := ptzChannel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	code, err := sipapi.SipPresetCall(channel, presetid)
+	ptzResponse(c, code, err)
+}
+
+// @Summary     删除预置位接口
+// @Description 删除设备上的预置位及平台保存的名称，返回设备的响应码
+// @Tags        channels
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       id       path     string true "通道id"
+// @Param       presetid path     int    true "预置位号 1-255"
+// @Success     0        {object} int
+// @Failure     1000     {object} string
+// @Failure     1001     {object} string
+// @Failure     1002     {object} string
+// @Failure     1003     {object} string
+// @Router      /channels/{id}/presets/{presetid} [delete]
+func PresetsDelete(c *gin.Context) {
+	presetid, err := strconv.Atoi(c.Param("presetid"))
+	if err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, "预置位号错误")
+		return
+	}
+	channel, ok := ptzChannel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	code, err := sipapi.SipPresetDelete(channel, presetid)
+	ptzResponse(c, code, err)
+}
+
+// @Summary     巡航、扫描控制接口
+// @Description 设置巡航轨迹、巡航速度和停留时间，开始或停止巡航、扫描，返回设备的响应码
+// @Tags        channels
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       id       path     string true  "通道id"
+// @Param       cmd      formData string true  "指令 add 加入巡航点,delete 删除巡航点,speed 巡航速度,dwell 停留时间,start 开始巡航,stop 停止巡航/扫描,scanstart 开始扫描,scanleft 设置扫描左边界,scanright 设置扫描右边界,scanspeed 扫描速度"
+// @Param       group    formData int    false "巡航组号或扫描组号 0-255，默认0"
+// @Param       presetid formData int    false "预置位号，add/delete 时使用，delete 时为0删除整条巡航"
+// @Param       value    formData int    false "巡航速度、停留时间(秒)或扫描速度 0-4095"
+// @Success     0        {object} int
+// @Failure     1000     {object} string
+// @Failure     1001     {object} string
+// @Failure     1002     {object} string
+// @Failure     1003     {object} string
+// @Router      /channels/{id}/cruise [post]
+func ChannelsCruise(c *gin.Context) {
+	cruise := sipapi.CruiseControl{Cmd: c.PostForm("cmd")}
+	for name, v := range map[string]*int{"group": &cruise.Group, "presetid": &cruise.Preset, "value": &cruise.Value} {
+		if s := c.PostForm(name); s != "" {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				m.JsonResponse(c, m.StatusParamsERR, name+"错误")
+				return
+			}
+			*v = i
+		}
+	}
+	if _, err := cruise.PTZCmd(); err != nil {
+		m.JsonResponse(c, m.StatusParamsERR, err)
+		return
+	}
+	channel, ok := ptzChannel(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	code, err := sipapi.SipCruise(channel, cruise)
+	ptzResponse(c, code, err)
+}
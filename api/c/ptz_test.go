@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/panjjo/gosip/m"
+)
+
+func formContext(form url.Values) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/channels/34020000001320000001/cruise", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	c.Params = gin.Params{{Key: "id", Value: "34020000001320000001"}}
+	return c, w
+}
+
+// 参数错误在查询通道前返回
+func TestPresetsSetParams(t *testing.T) {
+	for _, presetid := range []string{"", "abc", "0", "256"} {
+		c, w := formContext(url.Values{"presetid": {presetid}})
+		PresetsSet(c)
+		if !strings.Contains(w.Body.String(), `"code":"`+m.StatusParamsERR+`"`) {
+			t.Errorf("presetid %q: response %s", presetid, w.Body.String())
+		}
+	}
+}
+
+func TestChannelsCruiseParams(t *testing.T) {
+	cases := map[string]url.Values{
+		"cmd":    {"cmd": {"unknown"}},
+		"group":  {"cmd": {"start"}, "group": {"abc"}},
+		"range":  {"cmd": {"start"}, "group": {"256"}},
+		"preset": {"cmd": {"add"}, "group": {"1"}},
+		"value":  {"cmd": {"dwell"}, "value": {"4096"}},
+	}
+	for name, form := range cases {
+		c, w := formContext(form)
+		ChannelsCruise(c)
+		if !strings.Contains(w.Body.String(), `"code":"`+m.StatusParamsERR+`"`) {
+			t.Errorf("%s: response %s", name, w.Body.String())
+		}
+	}
+}
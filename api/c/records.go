@@ -2,7 +2,6 @@ package api
 
 import (
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/panjjo/gosip/db"
@@ -57,7 +56,7 @@ func RecordsList(c *gin.Context) {
 		m.JsonResponse(c, m.StatusDBERR, err)
 		return
 	}
-	if channel.Status != m.DeviceStatusON || time.Now().Unix()-channel.Active > 30*60 {
+	if channel.Status != m.DeviceStatusON {
 		m.JsonResponse(c, m.StatusParamsERR, "通道已离线")
 		return
 	}
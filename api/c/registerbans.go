@@ -0,0 +1,39 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/panjjo/gosip/m"
+	sipapi "github.com/panjjo/gosip/sip"
+)
+
+// @Summary     注册锁定列表接口
+// @Description 查询注册认证失败记录，按设备id和来源ip分别记录，lockeduntil大于当前时间的处于锁定中
+// @Tags        registerbans
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Success     0    {object} []sipapi.RegisterBan
+// @Failure     1000 {object} string
+// @Failure     1001 {object} string
+// @Failure     1002 {object} string
+// @Failure     1003 {object} string
+// @Router      /registerbans [get]
+func RegisterBansList(c *gin.Context) {
+	m.JsonResponse(c, m.StatusSucc, sipapi.RegisterBans())
+}
+
+// @Summary     注册锁定解除接口
+// @Description 解除设备id或ip的注册锁定，key为空时全部解除
+// @Tags        registerbans
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       key  query    string false "设备id或ip，为空解除全部"
+// @Success     0    {object} string
+// @Failure     1000 {object} string
+// @Failure     1001 {object} string
+// @Failure     1002 {object} string
+// @Failure     1003 {object} string
+// @Router      /registerbans [delete]
+func RegisterBansClear(c *gin.Context) {
+	sipapi.ClearRegisterBan(c.Query("key"))
+	m.JsonResponse(c, m.StatusSucc, "")
+}
@@ -28,7 +28,7 @@ import (
 // @Router      /channels/{id}/streams [post]
 func Play(c *gin.Context) {
 	channelid := c.Param("id")
-	pm := &sipapi.Streams{S: time.Time{}, E: time.Time{}, ChannelID: channelid, Ttag: db.M{}, Ftag: db.M{}}
+	pm := &sipapi.Streams{S: time.Time{}, E: time.Time{}, ChannelID: channelid}
 	if c.PostForm("replay") == "1" {
 		// 回放，获取时间
 		pm.T = 1
@@ -51,7 +51,7 @@ func Play(c *gin.Context) {
 			return
 		}
 	}
-	res, err := sipapi.SipPlay(pm)
+	res, err := sipapi.SipPlay(c.Request.Context(), pm)
 	if err != nil {
 		m.JsonResponse(c, m.StatusParamsERR, err.Error())
 		return
@@ -73,7 +73,8 @@ func Play(c *gin.Context) {
 // @Router      /streams/{id} [delete]
 func Stop(c *gin.Context) {
 	streamid := c.Param("id")
-	if _, ok := sipapi.StreamList.Response.Load(streamid); !ok {
+	_, ok := sipapi.StreamList.Response.Load(streamid)
+	if _, pending := sipapi.StreamList.Pending.Load(streamid); !ok && !pending {
 		m.JsonResponse(c, m.StatusParamsERR, "视频流不存在或已关闭")
 		return
 	}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/panjjo/gosip/m"
+	sipapi "github.com/panjjo/gosip/sip"
+)
+
+// @Summary     组织树接口
+// @Description 按层级加载设备目录的组织结构，不传deviceid返回设备列表，传deviceid不传id返回设备下顶级节点，传deviceid和id返回该节点的下级节点
+// @Tags        tree
+// @Accept      x-www-form-urlencoded
+// @Produce     json
+// @Param       deviceid query    string false "节点所属设备id"
+// @Param       id       query    string false "节点id"
+// @Success     0        {array}  sipapi.TreeNode
+// @Failure     1000     {object} string
+// @Failure     1001     {object} string
+// @Failure     1002     {object} string
+// @Failure     1003     {object} string
+// @Router      /tree [get]
+func Tree(c *gin.Context) {
+	deviceid := c.Query("deviceid")
+	id := c.Query("id")
+	if deviceid == "" && id != "" {
+		m.JsonResponse(c, m.StatusParamsERR, "缺少deviceid")
+		return
+	}
+	nodes, err := sipapi.TreeChildren(deviceid, id)
+	if err != nil {
+		m.JsonResponse(c, m.StatusDBERR, err)
+		return
+	}
+	m.JsonResponse(c, m.StatusSucc, nodes)
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -220,7 +221,7 @@ func zlmStreamNotFound(c *gin.Context) {
 				logrus.Infoln("closeStream stream pushed!", req.Stream)
 			} else {
 				// 拉流的，重新拉流
-				sipapi.SipPlay(params)
+				sipapi.SipPlay(context.Background(), params)
 				logrus.Infoln("closeStream stream pulled!", req.Stream)
 			}
 		} else {
@@ -17,14 +17,29 @@ func Init(r *gin.Engine) {
 		r.POST("/devices", api.DevicesCreate)
 		r.POST("/devices/:id", api.DevicesUpdate)
 		r.DELETE("/devices/:id", api.DevicesDelete)
-
+		r.GET("/devices/:id/status", api.DevicesStatus)
+		r.GET("/registerbans", api.RegisterBansList)
+		r.DELETE("/registerbans", api.RegisterBansClear)
 	}
 	// 通道类接口
 	{
 		r.GET("/channels", api.ChannelsList)
+		r.GET("/channels/nearby", api.ChannelsNearby)
+		r.GET("/channels/bbox", api.ChannelsBBox)
 		r.POST("/devices/:id/channels", api.ChannelCreate)
 		r.POST("/channels/:id", api.ChannelsUpdate)
 		r.DELETE("/channels/:id", api.ChannelsDelete)
+		r.POST("/channels/:id/ptz", api.ChannelsPTZ)
+		r.GET("/channels/:id/presets", api.PresetsList)
+		r.POST("/channels/:id/presets", api.PresetsSet)
+		r.POST("/channels/:id/presets/:presetid", api.PresetsCall)
+		r.DELETE("/channels/:id/presets/:presetid", api.PresetsDelete)
+		r.POST("/channels/:id/cruise", api.ChannelsCruise)
+		r.GET("/channels/:id/positions", api.PositionsList)
+	}
+	// 组织树
+	{
+		r.GET("/tree", api.Tree)
 	}
 	// 播放类接口
 	{
@@ -36,6 +51,10 @@ func Init(r *gin.Engine) {
 	{
 		r.GET("/channels/:id/records", api.RecordsList)
 	}
+	// 报警类
+	{
+		r.GET("/alarms", api.AlarmsList)
+	}
 	// zlm webhook
 	{
 		r.POST("/index/hook/:method", api.ZLMWebHook)
@@ -25,9 +25,9 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/channels": {
+        "/alarms": {
             "get": {
-                "description": "可以根据查询条件查询通道列表",
+                "description": "查询设备上报的报警记录，可按通道、报警类型和报警时间筛选",
                 "consumes": [
                     "application/x-www-form-urlencoded"
                 ],
@@ -35,10 +35,34 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "channels"
+                    "alarms"
                 ],
-                "summary": "通道列表接口",
+                "summary": "报警列表接口",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "报警通道id",
+                        "name": "channelid",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "报警类型",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "报警开始时间，时间戳",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "报警结束时间，时间戳",
+                        "name": "end",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
                         "description": "条数(0-100) 默认20",
@@ -56,19 +80,13 @@ const docTemplate = `{
                         "description": "排序,例:-key,根据key倒序,key,根据key正序",
                         "name": "sort",
                         "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "查询条件,使用规则详情请看帮助",
-                        "name": "filters",
-                        "in": "query"
                     }
                 ],
                 "responses": {
                     "0": {
                         "description": "",
                         "schema": {
-                            "$ref": "#/definitions/api.ChannelsListResponse"
+                            "$ref": "#/definitions/api.AlarmsListResponse"
                         }
                     },
                     "1000": {
@@ -98,9 +116,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/channels/{id}": {
-            "post": {
-                "description": "调整通道信息",
+        "/channels": {
+            "get": {
+                "description": "可以根据查询条件查询通道列表",
                 "consumes": [
                     "application/x-www-form-urlencoded"
                 ],
@@ -110,39 +128,38 @@ const docTemplate = `{
                 "tags": [
                     "channels"
                 ],
-                "summary": "通道修改接口",
+                "summary": "通道列表接口",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "通道id",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "type": "integer",
+                        "description": "条数(0-100) 默认20",
+                        "name": "limit",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
-                        "description": "通道备注",
-                        "name": "memo",
-                        "in": "formData"
+                        "type": "integer",
+                        "description": "间隔 默认0",
+                        "name": "skip",
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "播放类型，pull 媒体服务器拉流，push 摄像头推流,默认push",
-                        "name": "streamtype",
-                        "in": "formData"
+                        "description": "排序,例:-key,根据key倒序,key,根据key正序",
+                        "name": "sort",
+                        "in": "query"
                     },
                     {
                         "type": "string",
-                        "description": "静态拉流地址，streamtype=pull 时生效。",
-                        "name": "url",
-                        "in": "formData"
+                        "description": "查询条件,使用规则详情请看帮助",
+                        "name": "filters",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "0": {
                         "description": "",
                         "schema": {
-                            "$ref": "#/definitions/sipapi.Channels"
+                            "$ref": "#/definitions/api.ChannelsListResponse"
                         }
                     },
                     "1000": {
@@ -170,9 +187,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "删除通道信息",
+            }
+        },
+        "/channels/bbox": {
+            "get": {
+                "description": "查询经纬度矩形范围内设置了坐标的通道，用于地图按可视区域加载",
                 "consumes": [
                     "application/x-www-form-urlencoded"
                 ],
@@ -182,21 +201,51 @@ const docTemplate = `{
                 "tags": [
                     "channels"
                 ],
-                "summary": "通道删除接口",
+                "summary": "范围内通道接口",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "通道id",
-                        "name": "id",
-                        "in": "path",
+                        "type": "number",
+                        "description": "最小经度",
+                        "name": "minlng",
+                        "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "最小纬度",
+                        "name": "minlat",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "最大经度",
+                        "name": "maxlng",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "number",
+                        "description": "最大纬度",
+                        "name": "maxlat",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "条数 默认1000",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "0": {
                         "description": "",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sipapi.Channels"
+                            }
                         }
                     },
                     "1000": {
@@ -226,9 +275,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/channels/{id}/records": {
+        "/channels/nearby": {
             "get": {
-                "description": "用来获取通道设备存储的可回放时间段列表，注意控制时间跨度，跨度越大，数据量越多，返回越慢，甚至会超时（最多10s）。",
+                "description": "查询中心点半径范围内设置了坐标的通道，按距离由近到远返回",
                 "consumes": [
                     "application/x-www-form-urlencoded"
                 ],
@@ -236,37 +285,45 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "records"
+                    "channels"
                 ],
-                "summary": "回放文件时间列表",
+                "summary": "附近通道接口",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "通道id",
-                        "name": "id",
-                        "in": "path",
+                        "type": "number",
+                        "description": "中心点经度",
+                        "name": "lng",
+                        "in": "query",
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "开始时间，时间戳",
-                        "name": "start",
+                        "type": "number",
+                        "description": "中心点纬度",
+                        "name": "lat",
                         "in": "query",
                         "required": true
                     },
+                    {
+                        "type": "number",
+                        "description": "半径，单位m，默认1000",
+                        "name": "radius",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "description": "结束时间，时间戳",
-                        "name": "end",
-                        "in": "query",
-                        "required": true
+                        "description": "条数 默认1000",
+                        "name": "limit",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "0": {
                         "description": "",
                         "schema": {
-                            "$ref": "#/definitions/sipapi.Records"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sipapi.NearbyChannel"
+                            }
                         }
                     },
                     "1000": {
@@ -296,9 +353,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/channels/{id}/streams": {
+        "/channels/{id}": {
             "post": {
-                "description": "直播一个通道最多存在一个流，回放每请求一次生成一个流",
+                "description": "调整通道信息",
                 "consumes": [
                     "application/x-www-form-urlencoded"
                 ],
@@ -306,9 +363,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "streams"
+                    "channels"
                 ],
-                "summary": "监控播放（直播/回放）",
+                "summary": "通道修改接口",
                 "parameters": [
                     {
                         "type": "string",
@@ -318,21 +375,33 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "是否回放，1回放，0直播，默认0",
-                        "name": "replay",
+                        "type": "string",
+                        "description": "通道备注",
+                        "name": "memo",
                         "in": "formData"
                     },
                     {
-                        "type": "integer",
-                        "description": "回放开始时间，时间戳，replay=1时必传",
-                        "name": "start",
+                        "type": "string",
+                        "description": "播放类型，pull 媒体服务器拉流，push 摄像头推流,默认push",
+                        "name": "streamtype",
                         "in": "formData"
                     },
                     {
-                        "type": "integer",
-                        "description": "回放结束时间，时间戳，replay=1时必传",
-                        "name": "end",
+                        "type": "string",
+                        "description": "静态拉流地址，streamtype=pull 时生效。",
+                        "name": "url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "经度",
+                        "name": "longitude",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "number",
+                        "description": "纬度",
+                        "name": "latitude",
                         "in": "formData"
                     }
                 ],
@@ -340,7 +409,7 @@ const docTemplate = `{
                     "0": {
                         "description": "",
                         "schema": {
-                            "$ref": "#/definitions/sipapi.Streams"
+                            "$ref": "#/definitions/sipapi.Channels"
                         }
                     },
                     "1000": {
@@ -368,11 +437,9 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/devices": {
-            "get": {
-                "description": "可以根据查询条件查询设备列表",
+            },
+            "delete": {
+                "description": "删除通道信息",
                 "consumes": [
                     "application/x-www-form-urlencoded"
                 ],
@@ -380,40 +447,23 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "devices"
+                    "channels"
                 ],
-                "summary": "设备列表接口",
+                "summary": "通道删除接口",
                 "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "条数(0-100) 默认20",
-                        "name": "limit",
-                        "in": "query"
-                    },
-                    {
-                        "type": "integer",
-                        "description": "间隔 默认0",
-                        "name": "skip",
-                        "in": "query"
-                    },
-                    {
-                        "type": "string",
-                        "description": "排序,例:-key,根据key倒序,key,根据key正序",
-                        "name": "sort",
-                        "in": "query"
-                    },
                     {
                         "type": "string",
-                        "description": "查询条件,使用规则详情请看帮助",
-                        "name": "filters",
-                        "in": "query"
+                        "description": "通道id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "0": {
                         "description": "",
                         "schema": {
-                            "$ref": "#/definitions/api.DevicesListResponse"
+                            "type": "string"
                         }
                     },
                     "1000": {
@@ -441,9 +491,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/channels/{id}/cruise": {
             "post": {
-                "description": "通过此接口新增一个设备，获取设备id",
+                "description": "设置巡航轨迹、巡航速度和停留时间，开始或停止巡航、扫描，返回设备的响应码",
                 "consumes": [
                     "application/x-www-form-urlencoded"
                 ],
@@ -451,30 +503,48 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "devices"
+                    "channels"
                 ],
-                "summary": "设备新增接口",
+                "summary": "巡航、扫描控制接口",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "设备密码(GB28181认证密码)",
-                        "name": "pwd",
-                        "in": "formData",
+                        "description": "通道id",
+                        "name": "id",
+                        "in": "path",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "设备名称",
-                        "name": "name",
+                        "description": "指令 add 加入巡航点,delete 删除巡航点,speed 巡航速度,dwell 停留时间,start 开始巡航,stop 停止巡航/扫描,scanstart 开始扫描,scanleft 设置扫描左边界,scanright 设置扫描右边界,scanspeed 扫描速度",
+                        "name": "cmd",
                         "in": "formData",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "巡航组号或扫描组号 0-255，默认0",
+                        "name": "group",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "预置位号，add/delete 时使用，delete 时为0删除整条巡航",
+                        "name": "presetid",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "巡航速度、停留时间(秒)或扫描速度 0-4095",
+                        "name": "value",
+                        "in": "formData"
                     }
                 ],
                 "responses": {
                     "0": {
                         "description": "",
                         "schema": {
-                            "$ref": "#/definitions/sipapi.Devices"
+                            "type": "integer"
                         }
                     },
                     "1000": {
@@ -504,9 +574,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/devices/{id}": {
-            "post": {
-                "description": "调整设备信息",
+        "/channels/{id}/positions": {
+            "get": {
+                "description": "查询通道在时间段内上报的移动位置，按定位时间正序返回，通道最新位置见通道信息的position",
                 "consumes": [
                     "application/x-www-form-urlencoded"
                 ],
@@ -514,35 +584,40 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "devices"
+                    "channels"
                 ],
-                "summary": "设备修改接口",
+                "summary": "移动位置轨迹接口",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "设备id",
+                        "description": "通道id",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "设备密码(GB28181认证密码)",
-                        "name": "pwd",
-                        "in": "formData"
+                        "type": "integer",
+                        "description": "开始时间，时间戳",
+                        "name": "start",
+                        "in": "query",
+                        "required": true
                     },
                     {
-                        "type": "string",
-                        "description": "设备名称",
-                        "name": "name",
-                        "in": "formData"
+                        "type": "integer",
+                        "description": "结束时间，时间戳",
+                        "name": "end",
+                        "in": "query",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "0": {
                         "description": "",
                         "schema": {
-                            "$ref": "#/definitions/sipapi.Devices"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sipapi.Positions"
+                            }
                         }
                     },
                     "1000": {
@@ -570,9 +645,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "删除设备信息",
+            }
+        },
+        "/channels/{id}/presets": {
+            "get": {
+                "description": "查询设备上实际存在的预置位，名称优先使用平台设置的名称",
                 "consumes": [
                     "application/x-www-form-urlencoded"
                 ],
@@ -580,7 +657,706 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "devices"
+                    "channels"
+                ],
+                "summary": "预置位列表接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通道id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sipapi.Presets"
+                            }
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "将云台当前位置设置为预置位，返回设备的响应码",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "channels"
+                ],
+                "summary": "设置预置位接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通道id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "预置位号 1-255",
+                        "name": "presetid",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "预置位名称",
+                        "name": "name",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "type": "integer"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/channels/{id}/presets/{presetid}": {
+            "post": {
+                "description": "云台转到预置位，返回设备的响应码",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "channels"
+                ],
+                "summary": "调用预置位接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通道id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "预置位号 1-255",
+                        "name": "presetid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "type": "integer"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "删除设备上的预置位及平台保存的名称，返回设备的响应码",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "channels"
+                ],
+                "summary": "删除预置位接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通道id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "预置位号 1-255",
+                        "name": "presetid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "type": "integer"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/channels/{id}/ptz": {
+            "post": {
+                "description": "控制通道云台方向、变倍、聚焦、光圈，持续动作直到发送stop，返回设备的响应码",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "channels"
+                ],
+                "summary": "云台控制接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通道id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "指令 up,down,left,right,upleft,upright,downleft,downright,zoomin,zoomout,focusnear,focusfar,irisopen,irisclose,stop",
+                        "name": "cmd",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "水平、垂直、聚焦、光圈速度 0-255，默认128",
+                        "name": "speed",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "变倍速度 0-15，默认8",
+                        "name": "zoomspeed",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "type": "integer"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/channels/{id}/records": {
+            "get": {
+                "description": "用来获取通道设备存储的可回放时间段列表，注意控制时间跨度，跨度越大，数据量越多，返回越慢，甚至会超时（最多10s）。",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "records"
+                ],
+                "summary": "回放文件时间列表：对外接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通道id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "开始时间，时间戳",
+                        "name": "start",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "结束时间，时间戳",
+                        "name": "end",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/sipapi.Records"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/channels/{id}/streams": {
+            "post": {
+                "description": "直播一个通道最多存在一个流，回放每请求一次生成一个流",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "streams"
+                ],
+                "summary": "监控播放（直播/回放）：接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "通道id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "是否回放，1回放，0直播，默认0",
+                        "name": "replay",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "回放开始时间，时间戳，replay=1时必传",
+                        "name": "start",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "回放结束时间，时间戳，replay=1时必传",
+                        "name": "end",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/sipapi.Streams"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices": {
+            "get": {
+                "description": "可以根据查询条件查询设备列表",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "设备列表接口",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "条数(0-100) 默认20",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "间隔 默认0",
+                        "name": "skip",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "排序,例:-key,根据key倒序,key,根据key正序",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "查询条件,使用规则详情请看帮助",
+                        "name": "filters",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/api.DevicesListResponse"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "通过此接口新增一个设备，获取设备id",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "设备新增接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "设备密码(GB28181认证密码)",
+                        "name": "pwd",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备名称",
+                        "name": "name",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "注册认证摘要算法 MD5 MD5-sess SHA-256 SHA-256-sess，默认MD5",
+                        "name": "algorithm",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/sipapi.Devices"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/devices/{id}": {
+            "post": {
+                "description": "调整设备信息",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "设备修改接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "设备id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备密码(GB28181认证密码)",
+                        "name": "pwd",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "设备名称",
+                        "name": "name",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "注册认证摘要算法 MD5 MD5-sess SHA-256 SHA-256-sess",
+                        "name": "algorithm",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "心跳间隔，单位秒，默认60",
+                        "name": "keepaliveinterval",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "心跳超时次数，连续未收到心跳的次数达到后设备离线，默认3",
+                        "name": "keepalivetimeout",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "移动位置上报间隔，单位秒，为0不订阅移动位置",
+                        "name": "positioninterval",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/sipapi.Devices"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "删除设备信息",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
                 ],
                 "summary": "设备删除接口",
                 "parameters": [
@@ -700,6 +1476,165 @@ const docTemplate = `{
                 }
             }
         },
+        "/devices/{id}/status": {
+            "get": {
+                "description": "向设备查询在线、录像、编码、设备时间和报警状态，查询结果同时保存为设备的最新状态",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "devices"
+                ],
+                "summary": "设备状态查询接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "设备id",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "$ref": "#/definitions/sipapi.DeviceStatus"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/registerbans": {
+            "get": {
+                "description": "查询注册认证失败记录，按设备id和来源ip分别记录，lockeduntil大于当前时间的处于锁定中",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "registerbans"
+                ],
+                "summary": "注册锁定列表接口",
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sipapi.RegisterBan"
+                            }
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "解除设备id或ip的注册锁定，key为空时全部解除",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "registerbans"
+                ],
+                "summary": "注册锁定解除接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "设备id或ip，为空解除全部",
+                        "name": "key",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/streams": {
             "get": {
                 "description": "可以根据查询条件查询视频流列表",
@@ -828,9 +1763,87 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/tree": {
+            "get": {
+                "description": "按层级加载设备目录的组织结构，不传deviceid返回设备列表，传deviceid不传id返回设备下顶级节点，传deviceid和id返回该节点的下级节点",
+                "consumes": [
+                    "application/x-www-form-urlencoded"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tree"
+                ],
+                "summary": "组织树接口",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "节点所属设备id",
+                        "name": "deviceid",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "节点id",
+                        "name": "id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "0": {
+                        "description": "",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/sipapi.TreeNode"
+                            }
+                        }
+                    },
+                    "1000": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1001": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1002": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "1003": {
+                        "description": "",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
+        "api.AlarmsListResponse": {
+            "type": "object",
+            "properties": {
+                "List": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/sipapi.Alarms"
+                    }
+                },
+                "Total": {
+                    "type": "integer"
+                }
+            }
+        },
         "api.ChannelsListResponse": {
             "type": "object",
             "properties": {
@@ -895,19 +1908,88 @@ const docTemplate = `{
                     "description": "DNUM 当前设备数",
                     "type": "integer"
                 },
-                "id": {
+                "id": {
+                    "type": "integer"
+                },
+                "lid": {
+                    "description": "LID 当前服务id",
+                    "type": "string"
+                },
+                "mediaServer": {
+                    "type": "boolean"
+                },
+                "region": {
+                    "description": "Region 当前域",
+                    "type": "string"
+                },
+                "tcp": {
+                    "description": "TCP sip服务器tcp监听地址，为空不启用，以配置文件为准不保存数据库",
+                    "type": "string"
+                },
+                "udp": {
+                    "type": "string"
+                },
+                "uptime": {
+                    "type": "integer"
+                }
+            }
+        },
+        "sipapi.AlarmStatus": {
+            "type": "object",
+            "properties": {
+                "deviceid": {
+                    "type": "string"
+                },
+                "dutystatus": {
+                    "description": "DutyStatus 布防状态 ONDUTY OFFDUTY ALARM",
+                    "type": "string"
+                }
+            }
+        },
+        "sipapi.Alarms": {
+            "type": "object",
+            "properties": {
+                "addtime": {
+                    "type": "integer"
+                },
+                "channelid": {
+                    "description": "ChannelID 报警通道或报警设备编号",
+                    "type": "string"
+                },
+                "description": {
+                    "description": "Description 报警描述",
+                    "type": "string"
+                },
+                "deviceid": {
+                    "description": "DeviceID 上报报警的设备编号",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "latitude": {
+                    "description": "Latitude 纬度",
+                    "type": "number"
+                },
+                "longitude": {
+                    "description": "Longitude 经度",
+                    "type": "number"
+                },
+                "method": {
+                    "description": "Method 报警方式 1电话报警 2设备报警 3短信报警 4GPS报警 5视频报警 6设备故障报警 7其他报警",
                     "type": "integer"
                 },
-                "lid": {
-                    "description": "LID 当前服务id",
-                    "type": "string"
+                "priority": {
+                    "description": "Priority 报警级别 1一级警情 2二级警情 3三级警情 4四级警情",
+                    "type": "integer"
                 },
-                "mediaServer": {
-                    "type": "boolean"
+                "time": {
+                    "description": "Time 报警时间",
+                    "type": "integer"
                 },
-                "region": {
-                    "description": "Region 当前域",
-                    "type": "string"
+                "type": {
+                    "description": "Type 报警类型，与报警方式对应",
+                    "type": "integer"
                 },
                 "uptime": {
                     "type": "integer"
@@ -928,6 +2010,10 @@ const docTemplate = `{
                 "addtime": {
                     "type": "integer"
                 },
+                "businessgroupid": {
+                    "description": "BusinessGroupID 所属业务分组",
+                    "type": "string"
+                },
                 "channelid": {
                     "description": "ChannelID 通道编码",
                     "type": "string"
@@ -950,6 +2036,14 @@ const docTemplate = `{
                 "id": {
                     "type": "integer"
                 },
+                "latitude": {
+                    "description": "Latitude 纬度",
+                    "type": "number"
+                },
+                "longitude": {
+                    "description": "Longitude 经度",
+                    "type": "number"
+                },
                 "manufacturer": {
                     "type": "string"
                 },
@@ -970,6 +2064,14 @@ const docTemplate = `{
                 "parental": {
                     "type": "integer"
                 },
+                "parentid": {
+                    "description": "ParentID 上级节点编号，设备未上报时为所属行政区划",
+                    "type": "string"
+                },
+                "position": {
+                    "description": "Position 移动设备最新位置",
+                    "$ref": "#/definitions/sipapi.MobilePosition"
+                },
                 "registerway": {
                     "type": "integer"
                 },
@@ -1007,24 +2109,80 @@ const docTemplate = `{
                 }
             }
         },
+        "sipapi.DeviceStatus": {
+            "type": "object",
+            "properties": {
+                "alarmstatus": {
+                    "description": "Alarms 报警设备状态",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/sipapi.AlarmStatus"
+                    }
+                },
+                "devicetime": {
+                    "description": "DeviceTime 设备时间",
+                    "type": "string"
+                },
+                "encode": {
+                    "description": "Encode 是否编码 ON OFF",
+                    "type": "string"
+                },
+                "online": {
+                    "description": "Online 是否在线 ONLINE OFFLINE",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "Reason 不正常工作原因",
+                    "type": "string"
+                },
+                "record": {
+                    "description": "Record 是否录像 ON OFF",
+                    "type": "string"
+                },
+                "result": {
+                    "description": "Result 查询结果 OK ERROR",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status 是否正常工作 OK ERROR",
+                    "type": "string"
+                },
+                "uptime": {
+                    "description": "UpdatedAt 查询时间",
+                    "type": "integer"
+                }
+            }
+        },
         "sipapi.Devices": {
             "type": "object",
             "properties": {
                 "active": {
-                    "description": "ActiveAt 最后心跳检测时间",
+                    "description": "ActiveAt 最后心跳检测时间，设备离线后保留为最后活跃时间",
                     "type": "integer"
                 },
                 "addtime": {
                     "type": "integer"
                 },
+                "algorithm": {
+                    "description": "Algorithm 注册认证使用的摘要算法 MD5 MD5-sess SHA-256 SHA-256-sess，为空使用MD5",
+                    "type": "string"
+                },
                 "deviceid": {
                     "description": "DeviceID 设备id",
                     "type": "string"
                 },
+                "devicestatus": {
+                    "description": "DeviceStatus 最近一次查询到的设备状态",
+                    "$ref": "#/definitions/sipapi.DeviceStatus"
+                },
                 "devicetype": {
                     "description": "设备类型DVR，NVR",
                     "type": "string"
                 },
+                "expires": {
+                    "description": "Expires 注册过期时间，过期后设备下线",
+                    "type": "integer"
+                },
                 "firmware": {
                     "description": "Firmware 固件版本",
                     "type": "string"
@@ -1036,6 +2194,14 @@ const docTemplate = `{
                 "id": {
                     "type": "integer"
                 },
+                "keepaliveinterval": {
+                    "description": "KeepaliveInterval 心跳间隔，单位秒，为0使用默认值60",
+                    "type": "integer"
+                },
+                "keepalivetimeout": {
+                    "description": "KeepaliveTimeout 心跳超时次数，连续未收到心跳的次数达到后设备离线，为0使用默认值3",
+                    "type": "integer"
+                },
                 "manufacturer": {
                     "description": "Manufacturer 制造厂商",
                     "type": "string"
@@ -1052,6 +2218,10 @@ const docTemplate = `{
                     "description": "Port via 端口",
                     "type": "string"
                 },
+                "positioninterval": {
+                    "description": "PositionInterval 移动位置订阅上报间隔，单位秒，为0不订阅",
+                    "type": "integer"
+                },
                 "proto": {
                     "description": "Proto 协议",
                     "type": "string"
@@ -1080,6 +2250,10 @@ const docTemplate = `{
                     "description": "Source",
                     "type": "string"
                 },
+                "status": {
+                    "description": "Status 设备状态 ON 在线 OFF 离线，心跳超时后置为离线",
+                    "type": "string"
+                },
                 "sysinfo": {
                     "$ref": "#/definitions/m.SysInfo"
                 },
@@ -1095,6 +2269,218 @@ const docTemplate = `{
                 }
             }
         },
+        "sipapi.MobilePosition": {
+            "type": "object",
+            "properties": {
+                "altitude": {
+                    "type": "number"
+                },
+                "direction": {
+                    "type": "number"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                },
+                "speed": {
+                    "type": "number"
+                },
+                "time": {
+                    "type": "integer"
+                }
+            }
+        },
+        "sipapi.NearbyChannel": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "description": "Active 最后活跃时间",
+                    "type": "integer"
+                },
+                "address": {
+                    "description": "Address ip地址",
+                    "type": "string"
+                },
+                "addtime": {
+                    "type": "integer"
+                },
+                "businessgroupid": {
+                    "description": "BusinessGroupID 所属业务分组",
+                    "type": "string"
+                },
+                "channelid": {
+                    "description": "ChannelID 通道编码",
+                    "type": "string"
+                },
+                "civilcode": {
+                    "type": "string"
+                },
+                "deviceid": {
+                    "description": "DeviceID 设备编号",
+                    "type": "string"
+                },
+                "distance": {
+                    "description": "Distance 与查询中心点的距离，单位m",
+                    "type": "number"
+                },
+                "fps": {
+                    "description": "视频FPS",
+                    "type": "integer"
+                },
+                "height": {
+                    "description": "视频高",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "latitude": {
+                    "description": "Latitude 纬度",
+                    "type": "number"
+                },
+                "longitude": {
+                    "description": "Longitude 经度",
+                    "type": "number"
+                },
+                "manufacturer": {
+                    "type": "string"
+                },
+                "memo": {
+                    "description": "Memo 备注（用来标示通道信息）",
+                    "type": "string"
+                },
+                "model": {
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Name 通道名称（设备端设置名称）",
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "parental": {
+                    "type": "integer"
+                },
+                "parentid": {
+                    "description": "ParentID 上级节点编号，设备未上报时为所属行政区划",
+                    "type": "string"
+                },
+                "position": {
+                    "description": "Position 移动设备最新位置",
+                    "$ref": "#/definitions/sipapi.MobilePosition"
+                },
+                "registerway": {
+                    "type": "integer"
+                },
+                "safetyway": {
+                    "type": "integer"
+                },
+                "secrecy": {
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "Status 状态  on 在线",
+                    "type": "string"
+                },
+                "streamtype": {
+                    "description": "pull 媒体服务器主动拉流，push 监控设备主动推流",
+                    "type": "string"
+                },
+                "uptime": {
+                    "type": "integer"
+                },
+                "uri": {
+                    "type": "string"
+                },
+                "url": {
+                    "description": "streamtype=pull时，拉流地址",
+                    "type": "string"
+                },
+                "vf": {
+                    "description": "视频编码格式",
+                    "type": "string"
+                },
+                "width": {
+                    "description": "视频宽",
+                    "type": "integer"
+                }
+            }
+        },
+        "sipapi.Positions": {
+            "type": "object",
+            "properties": {
+                "addtime": {
+                    "type": "integer"
+                },
+                "altitude": {
+                    "description": "Altitude 海拔高度，单位m",
+                    "type": "number"
+                },
+                "channelid": {
+                    "description": "ChannelID 上报位置的通道编号",
+                    "type": "string"
+                },
+                "deviceid": {
+                    "description": "DeviceID 通道所属设备编号",
+                    "type": "string"
+                },
+                "direction": {
+                    "description": "Direction 方向，正北方向顺时针夹角 0-360",
+                    "type": "number"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "latitude": {
+                    "description": "Latitude 纬度",
+                    "type": "number"
+                },
+                "longitude": {
+                    "description": "Longitude 经度",
+                    "type": "number"
+                },
+                "speed": {
+                    "description": "Speed 速度，单位km/h",
+                    "type": "number"
+                },
+                "time": {
+                    "description": "Time 定位时间",
+                    "type": "integer"
+                },
+                "uptime": {
+                    "type": "integer"
+                }
+            }
+        },
+        "sipapi.Presets": {
+            "type": "object",
+            "properties": {
+                "addtime": {
+                    "type": "integer"
+                },
+                "channelid": {
+                    "description": "ChannelID 通道编码",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "Name 预置位名称",
+                    "type": "string"
+                },
+                "presetid": {
+                    "description": "PresetID 预置位号 1-255",
+                    "type": "integer"
+                },
+                "uptime": {
+                    "type": "integer"
+                }
+            }
+        },
         "sipapi.RecordDate": {
             "type": "object",
             "properties": {
@@ -1140,6 +2526,31 @@ const docTemplate = `{
                 }
             }
         },
+        "sipapi.RegisterBan": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "description": "Failures 连续认证失败次数",
+                    "type": "integer"
+                },
+                "key": {
+                    "description": "Key 设备id或来源ip",
+                    "type": "string"
+                },
+                "lastfailure": {
+                    "description": "LastFailure 最后一次认证失败时间",
+                    "type": "integer"
+                },
+                "lockeduntil": {
+                    "description": "LockedUntil 锁定截止时间，为0表示未锁定",
+                    "type": "integer"
+                },
+                "type": {
+                    "description": "Type 锁定对象类型 deviceid 或 ip",
+                    "type": "string"
+                }
+            }
+        },
         "sipapi.Streams": {
             "type": "object",
             "properties": {
@@ -1154,9 +2565,6 @@ const docTemplate = `{
                     "description": "通道ID",
                     "type": "string"
                 },
-                "cseqno": {
-                    "type": "integer"
-                },
                 "deviceid": {
                     "description": "设备ID",
                     "type": "string"
@@ -1211,6 +2619,37 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "sipapi.TreeNode": {
+            "type": "object",
+            "properties": {
+                "deviceid": {
+                    "description": "DeviceID 节点所属设备，加载下级节点时使用",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID 节点编号",
+                    "type": "string"
+                },
+                "leaf": {
+                    "description": "Leaf 是否叶子节点，非叶子节点可继续加载下级",
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "parentid": {
+                    "type": "string"
+                },
+                "status": {
+                    "description": "Status 设备和通道在线状态",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type 节点类型 device civilcode platform business virtual channel",
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
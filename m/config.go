@@ -41,6 +41,8 @@ type Cascade struct {
 	CityID   string `json:"cityid" yaml:"cityid"`
 	CityName string `json:"cityname" yaml:"cityname"`
 	CataMod  int    `json:"catamod" yaml:"catamod"`
+	// Algorithm 向上级注册使用的摘要算法，上级提供多个认证头时优先使用，为空使用第一个认证头
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
 }
 
 // 录像相关配置
@@ -72,6 +74,20 @@ type MediaServer struct {
 type SysInfo struct {
 	db.DBModel
 	UDP string `json:"udp" yaml:"udp" mapstructure:"udp" gorm:"addr"`
+	// TCP sip服务器tcp监听地址，为空不启用，以配置文件为准不保存数据库
+	TCP string `json:"tcp" yaml:"tcp" mapstructure:"tcp" gorm:"-"`
+	// TLS sip服务器tls配置，以配置文件为准不保存数据库
+	TLS TLSConfig `json:"-" yaml:"tls" mapstructure:"tls" gorm:"-"`
+	// Timer sip事务定时器，以配置文件为准不保存数据库
+	Timer TimerConfig `json:"-" yaml:"timer" mapstructure:"timer" gorm:"-"`
+	// AutoRegister 自动注册策略，以配置文件为准不保存数据库
+	AutoRegister AutoRegisterConfig `json:"-" yaml:"autoregister" mapstructure:"autoregister" gorm:"-"`
+	// AuthLock 注册认证失败锁定策略，以配置文件为准不保存数据库
+	AuthLock AuthLockConfig `json:"-" yaml:"authlock" mapstructure:"authlock" gorm:"-"`
+	// MTU udp发送请求的大小上限，超过时改用tcp发送，为0使用默认值1300，以配置文件为准不保存数据库
+	MTU int `json:"-" yaml:"mtu" mapstructure:"mtu" gorm:"-"`
+	// CatalogSubscribe 设备目录和移动位置订阅有效期，单位秒，为0使用默认值3600，以配置文件为准不保存数据库
+	CatalogSubscribe int `json:"-" yaml:"catalogsubscribe" mapstructure:"catalogsubscribe" gorm:"-"`
 	// Region 当前域
 	Region string `json:"region"   yaml:"region" mapstructure:"region"`
 	// CID 通道id固定头部
@@ -91,6 +107,44 @@ type SysInfo struct {
 	MediaServerRtpPort int `gorm:"-"  json:"-"`
 }
 
+// TLSConfig sip tls(sips)监听配置
+type TLSConfig struct {
+	// Addr 监听地址，为空不启用tls
+	Addr string `json:"addr" yaml:"addr" mapstructure:"addr"`
+	// Cert 服务器证书
+	Cert string `json:"cert" yaml:"cert" mapstructure:"cert"`
+	// Key 服务器证书私钥
+	Key string `json:"key" yaml:"key" mapstructure:"key"`
+	// CA 校验设备证书的ca，为空不校验设备证书
+	CA string `json:"ca" yaml:"ca" mapstructure:"ca"`
+}
+
+// AutoRegisterConfig 自动注册策略，未通过接口创建的设备使用域密码注册，认证成功后自动创建设备
+type AutoRegisterConfig struct {
+	// PWD 域密码，为空不启用自动注册
+	PWD string `json:"pwd" yaml:"pwd" mapstructure:"pwd"`
+	// Allow 允许自动注册的设备来源ip或网段，如 192.168.1.0/24，为空不限制
+	Allow []string `json:"allow" yaml:"allow" mapstructure:"allow"`
+}
+
+// AuthLockConfig 注册认证失败锁定策略，按设备id和来源ip分别计数
+type AuthLockConfig struct {
+	// Max 连续认证失败次数上限，达到后锁定，默认5
+	Max int `json:"max" yaml:"max" mapstructure:"max"`
+	// Duration 锁定时长，单位秒，默认600
+	Duration int `json:"duration" yaml:"duration" mapstructure:"duration"`
+}
+
+// TimerConfig sip事务定时器 RFC 3261 17.1.1.1，单位毫秒，为0使用默认值
+type TimerConfig struct {
+	// T1 RTT预估值，默认500
+	T1 int `json:"t1" yaml:"t1" mapstructure:"t1"`
+	// T2 非INVITE请求最大重传间隔，默认4000
+	T2 int `json:"t2" yaml:"t2" mapstructure:"t2"`
+	// T4 消息在网络中的最大存活时间，默认5000
+	T4 int `json:"t4" yaml:"t4" mapstructure:"t4"`
+}
+
 func DefaultInfo() *SysInfo {
 	return MConfig.GB28181
 }
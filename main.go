@@ -63,8 +63,11 @@ func init() {
 
 // 定时任务
 func _cron() {
-	c := cron.New()                                 // 新建一个定时任务对象
-	c.AddFunc("0 */5 * * * *", sipapi.CheckStreams) // 定时关闭推送流
-	c.AddFunc("0 */5 * * * *", sipapi.ClearFiles)   // 定时清理录制文件
+	c := cron.New()                                    // 新建一个定时任务对象
+	c.AddFunc("0 */5 * * * *", sipapi.CheckStreams)    // 定时关闭推送流
+	c.AddFunc("0 */5 * * * *", sipapi.ClearFiles)      // 定时清理录制文件
+	c.AddFunc("0 * * * * *", sipapi.CheckDevices)      // 定时清理注册过期的设备
+	c.AddFunc("*/30 * * * * *", sipapi.CheckKeepalive) // 定时检查设备心跳超时
+	c.AddFunc("*/30 * * * * *", sipapi.CheckSubscribe) // 定时刷新设备目录和移动位置订阅
 	c.Start()
 }
@@ -0,0 +1,105 @@
+package sipapi
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/panjjo/gosip/db"
+	sip "github.com/panjjo/gosip/sip/s"
+	"github.com/panjjo/gosip/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Alarms 报警记录 GB/T 28181 9.4
+type Alarms struct {
+	db.DBModel
+	// DeviceID 上报报警的设备编号
+	DeviceID string `json:"deviceid" gorm:"column:deviceid"`
+	// ChannelID 报警通道或报警设备编号
+	ChannelID string `json:"channelid" gorm:"column:channelid"`
+	// Priority 报警级别 1一级警情 2二级警情 3三级警情 4四级警情
+	Priority int `json:"priority" gorm:"column:priority"`
+	// Method 报警方式 1电话报警 2设备报警 3短信报警 4GPS报警 5视频报警 6设备故障报警 7其他报警
+	Method int `json:"method" gorm:"column:method"`
+	// Type 报警类型，与报警方式对应
+	Type int `json:"type" gorm:"column:alarmtype"`
+	// Time 报警时间
+	Time int64 `json:"time" gorm:"column:alarmtime"`
+	// Longitude 经度
+	Longitude float64 `json:"longitude" gorm:"column:longitude"`
+	// Latitude 纬度
+	Latitude float64 `json:"latitude" gorm:"column:latitude"`
+	// Description 报警描述
+	Description string `json:"description" gorm:"column:description"`
+}
+
+// MessageAlarm 报警通知xml结构
+type MessageAlarm struct {
+	CmdType     string `xml:"CmdType"`
+	SN          int    `xml:"SN"`
+	DeviceID    string `xml:"DeviceID"`
+	Priority    string `xml:"AlarmPriority"`
+	Method      string `xml:"AlarmMethod"`
+	Time        string `xml:"AlarmTime"`
+	Description string `xml:"AlarmDescription"`
+	Longitude   string `xml:"Longitude"`
+	Latitude    string `xml:"Latitude"`
+	Type        string `xml:"Info>AlarmType"`
+}
+
+// 取得设备发来的报警通知，保存后推送通知
+func sipMessageAlarm(u Devices, body []byte) error {
+	if _, ok := _activeDevices.Get(u.DeviceID); !ok {
+		logrus.Warnln("alarm from inactive device,", u.DeviceID)
+		return errors.New("device not active")
+	}
+	message := &MessageAlarm{}
+	if err := utils.XMLDecode(body, message); err != nil {
+		logrus.Errorln("Message Unmarshal xml err:", err, "body:", string(body))
+		return err
+	}
+	// 只接受设备自身及其通道的报警
+	if !deviceOwns(u.DeviceID, message.DeviceID) {
+		logrus.Warnln("alarm for device not owned,", u.DeviceID, message.DeviceID)
+		return errors.New("device not owned")
+	}
+	alarm := Alarms{DeviceID: u.DeviceID, ChannelID: message.DeviceID, Description: message.Description}
+	alarm.Priority, _ = strconv.Atoi(message.Priority)
+	alarm.Method, _ = strconv.Atoi(message.Method)
+	alarm.Type, _ = strconv.Atoi(message.Type)
+	alarm.Longitude, _ = strconv.ParseFloat(message.Longitude, 64)
+	alarm.Latitude, _ = strconv.ParseFloat(message.Latitude, 64)
+	alarm.Time = time.Now().Unix()
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", message.Time, time.Local); err == nil {
+		alarm.Time = t.Unix()
+	}
+	if err := db.Create(db.DBClient, &alarm); err != nil {
+		logrus.Errorln("save alarm error,", err)
+		return err
+	}
+	go sipAlarmResponse(u, message)
+	go notify(notifyAlarmsNew(alarm))
+	return nil
+}
+
+// sipAlarmResponse 报警通知应答。
+// 收到报警后除SIP 200 OK外，平台还需发送CmdType为Alarm的MESSAGE响应，设备收到后才确认报警已送达 GB/T 28181 9.4.2、A.2.6
+func sipAlarmResponse(to Devices, message *MessageAlarm) {
+	hb := sip.NewHeaderBuilder().SetTo(to.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
+		Transport: to.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE)
+	req := sip.NewRequest("", sip.MESSAGE, to.addr.URI, sip.DefaultSipVersion, hb.Build(), sip.GetAlarmResponseXML(message.DeviceID, message.SN))
+	req.SetDestination(to.source)
+	tx, err := srv.Request(req)
+	if err != nil {
+		logrus.Warnln("sipAlarmResponse  error,", err)
+		return
+	}
+	_, err = sipResponse(tx)
+	if err != nil {
+		logrus.Warnln("sipAlarmResponse  response error,", err)
+		return
+	}
+}
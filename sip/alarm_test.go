@@ -0,0 +1,19 @@
+package sipapi
+
+import "testing"
+
+func TestAlarmRejected(t *testing.T) {
+	_activeDevices = ActiveDevices{}
+	body := []byte(`<?xml version="1.0"?><Notify><CmdType>Alarm</CmdType><SN>3</SN><DeviceID>34020000001340000001</DeviceID><AlarmPriority>1</AlarmPriority><AlarmMethod>2</AlarmMethod></Notify>`)
+
+	// 未注册的来源不能上报报警
+	if err := sipMessageAlarm(Devices{DeviceID: "34020000001320000001"}, body); err == nil {
+		t.Fatal("alarm from inactive device accepted")
+	}
+	_activeDevices.Store("34020000001320000001", Devices{DeviceID: "34020000001320000001"})
+	defer _activeDevices.Delete("34020000001320000001")
+	noID := []byte(`<?xml version="1.0"?><Notify><CmdType>Alarm</CmdType><SN>3</SN><AlarmPriority>1</AlarmPriority></Notify>`)
+	if err := sipMessageAlarm(Devices{DeviceID: "34020000001320000001"}, noID); err == nil {
+		t.Fatal("alarm without deviceid accepted")
+	}
+}
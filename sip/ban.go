@@ -0,0 +1,177 @@
+package sipapi
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 注册认证失败锁定的默认值
+const (
+	defaultAuthLockMax      = 5
+	defaultAuthLockDuration = 600
+)
+
+// 失败记录数量上限，超过时淘汰最早失败的记录，防止伪造大量设备id或来源耗尽内存
+const registerBansMax = 1024
+
+// 锁定对象类型
+const (
+	RegisterBanDevice = "deviceid"
+	RegisterBanIP     = "ip"
+)
+
+// RegisterBan 注册认证失败记录，连续失败次数达到上限后锁定，锁定期间的注册直接返回403
+type RegisterBan struct {
+	// Type 锁定对象类型 deviceid 或 ip
+	Type string `json:"type"`
+	// Key 设备id或来源ip
+	Key string `json:"key"`
+	// Failures 连续认证失败次数
+	Failures int `json:"failures"`
+	// LastFailure 最后一次认证失败时间
+	LastFailure int64 `json:"lastfailure"`
+	// LockedUntil 锁定截止时间，为0表示未锁定
+	LockedUntil int64 `json:"lockeduntil"`
+}
+
+type registerBans struct {
+	items map[string]*RegisterBan
+	l     *sync.Mutex
+}
+
+var _registerBans *registerBans
+
+func newRegisterBans() *registerBans {
+	return &registerBans{items: map[string]*RegisterBan{}, l: &sync.Mutex{}}
+}
+
+// authLockPolicy 失败次数上限和锁定时长(秒)，失败记录超过锁定时长未再失败时重新计数
+func authLockPolicy() (int, int64) {
+	max, duration := _sysinfo.AuthLock.Max, _sysinfo.AuthLock.Duration
+	if max <= 0 {
+		max = defaultAuthLockMax
+	}
+	if duration <= 0 {
+		duration = defaultAuthLockDuration
+	}
+	return max, int64(duration)
+}
+
+func registerBanKeys(deviceID string, ip net.IP) [][2]string {
+	keys := [][2]string{{RegisterBanDevice, deviceID}}
+	if ip != nil {
+		keys = append(keys, [2]string{RegisterBanIP, ip.String()})
+	}
+	return keys
+}
+
+// locked 设备id或来源ip是否处于锁定中
+func (b *registerBans) locked(deviceID string, ip net.IP) bool {
+	now := time.Now().Unix()
+	b.l.Lock()
+	defer b.l.Unlock()
+	for _, k := range registerBanKeys(deviceID, ip) {
+		if ban, ok := b.items[k[0]+":"+k[1]]; ok && ban.LockedUntil > now {
+			return true
+		}
+	}
+	return false
+}
+
+// fail 记录一次认证失败，返回是否因此被锁定
+func (b *registerBans) fail(deviceID string, ip net.IP) bool {
+	max, duration := authLockPolicy()
+	now := time.Now().Unix()
+	b.l.Lock()
+	defer b.l.Unlock()
+	keys := registerBanKeys(deviceID, ip)
+	if len(b.items)+len(keys) > registerBansMax {
+		b.clean(now, duration)
+		b.evict(now, len(b.items)+len(keys)-registerBansMax)
+	}
+	var locked bool
+	for _, k := range keys {
+		ban, ok := b.items[k[0]+":"+k[1]]
+		if !ok || now-ban.LastFailure > duration || (ban.LockedUntil > 0 && ban.LockedUntil <= now) {
+			ban = &RegisterBan{Type: k[0], Key: k[1]}
+			b.items[k[0]+":"+k[1]] = ban
+		}
+		ban.Failures++
+		ban.LastFailure = now
+		if ban.Failures >= max {
+			ban.LockedUntil = now + duration
+			locked = true
+		}
+	}
+	return locked
+}
+
+// succeed 认证成功，清除设备的失败记录。
+// 来源ip的失败记录不清除：同一来源可能使用一个有效账号掩护对其他设备id的猜测，ip记录在锁定时长内未再失败后自动重新计数
+func (b *registerBans) succeed(deviceID string) {
+	b.l.Lock()
+	delete(b.items, RegisterBanDevice+":"+deviceID)
+	b.l.Unlock()
+}
+
+// clean 清理已解除锁定且超过锁定时长未再失败的记录，调用方需持有锁
+func (b *registerBans) clean(now, duration int64) {
+	for k, ban := range b.items {
+		if ban.LockedUntil <= now && now-ban.LastFailure > duration {
+			delete(b.items, k)
+		}
+	}
+}
+
+// evict 淘汰n条最早失败的记录，优先淘汰未锁定的记录，调用方需持有锁
+func (b *registerBans) evict(now int64, n int) {
+	if n <= 0 {
+		return
+	}
+	keys := make([]string, 0, len(b.items))
+	for k := range b.items {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		bi, bj := b.items[keys[i]], b.items[keys[j]]
+		if li, lj := bi.LockedUntil > now, bj.LockedUntil > now; li != lj {
+			return lj
+		}
+		return bi.LastFailure < bj.LastFailure
+	})
+	if n > len(keys) {
+		n = len(keys)
+	}
+	for _, k := range keys[:n] {
+		delete(b.items, k)
+	}
+}
+
+// RegisterBans 当前的认证失败和锁定记录，已过期的记录会被清理
+func RegisterBans() []RegisterBan {
+	_, duration := authLockPolicy()
+	now := time.Now().Unix()
+	_registerBans.l.Lock()
+	defer _registerBans.l.Unlock()
+	_registerBans.clean(now, duration)
+	list := []RegisterBan{}
+	for _, ban := range _registerBans.items {
+		list = append(list, *ban)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastFailure > list[j].LastFailure })
+	return list
+}
+
+// ClearRegisterBan 解除设备id或ip的锁定，key为空时全部解除
+func ClearRegisterBan(key string) {
+	_registerBans.l.Lock()
+	defer _registerBans.l.Unlock()
+	if key == "" {
+		_registerBans.items = map[string]*RegisterBan{}
+		return
+	}
+	delete(_registerBans.items, RegisterBanDevice+":"+key)
+	delete(_registerBans.items, RegisterBanIP+":"+key)
+}
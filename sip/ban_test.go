@@ -0,0 +1,75 @@
+package sipapi
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/panjjo/gosip/m"
+)
+
+func TestRegisterBans(t *testing.T) {
+	old := _sysinfo
+	_sysinfo = &m.SysInfo{AuthLock: m.AuthLockConfig{Max: 3, Duration: 60}}
+	defer func() { _sysinfo = old }()
+
+	bans := newRegisterBans()
+	ip := net.ParseIP("192.168.1.64")
+	for i := 0; i < 2; i++ {
+		if bans.fail("34020000001320000001", ip) {
+			t.Fatalf("locked after %d failures", i+1)
+		}
+	}
+	if bans.locked("34020000001320000001", ip) {
+		t.Fatal("locked before max failures")
+	}
+	// 认证成功只清除设备的失败记录，ip继续计数
+	bans.succeed("34020000001320000001")
+	if !bans.fail("34020000001320000001", ip) {
+		t.Fatal("ip not locked after max failures")
+	}
+	if !bans.locked("34020000001320000002", ip) {
+		t.Fatal("other device from locked ip not rejected")
+	}
+	if bans.locked("34020000001320000001", net.ParseIP("192.168.1.65")) {
+		t.Fatal("device locked before its own max failures")
+	}
+
+	// 锁定到期后重新计数
+	for _, ban := range bans.items {
+		ban.LockedUntil = ban.LastFailure - 1
+	}
+	if bans.locked("34020000001320000002", ip) {
+		t.Fatal("ban not expired")
+	}
+	if bans.fail("34020000001320000002", ip) {
+		t.Fatal("expired ban not reset")
+	}
+}
+
+func TestRegisterBansCap(t *testing.T) {
+	old := _sysinfo
+	_sysinfo = &m.SysInfo{AuthLock: m.AuthLockConfig{Max: 3, Duration: 60}}
+	defer func() { _sysinfo = old }()
+
+	bans := newRegisterBans()
+	// 锁定一个设备
+	for i := 0; i < 3; i++ {
+		bans.fail("34020000001320000001", nil)
+	}
+	for i := 0; i < registerBansMax*2; i++ {
+		bans.fail(fmt.Sprintf("3402000000132%07d", i+2), net.IPv4(10, 0, byte(i>>8), byte(i)))
+		if len(bans.items) > registerBansMax {
+			t.Fatalf("%d items, over cap", len(bans.items))
+		}
+	}
+	// 未锁定的记录优先淘汰
+	if !bans.locked("34020000001320000001", nil) {
+		t.Fatal("locked device evicted")
+	}
+	// 最近的失败记录保留
+	last := registerBansMax*2 - 1
+	if _, ok := bans.items[RegisterBanIP+":"+net.IPv4(10, 0, byte(last>>8), byte(last)).String()]; !ok {
+		t.Fatal("latest failure evicted")
+	}
+}
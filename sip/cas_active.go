@@ -50,15 +50,15 @@ func casKeepAliveFunc() {
 		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE).SetSeqNo(keepAliveSeq)
 	req := sip.NewRequest("", sip.MESSAGE, toaddr.URI, sip.DefaultSipVersion, hb.Build(), []byte(sip.GetKeepAliveXML(config.GB28181.LID, keepAliveSN)))
-	req.SetDestination(sip.ReAddr)
-	tx, err := cascadeSrv.CasRequest(req)
+	req.SetDestination(cassrv.RemoteAddr())
+	tx, err := cassrv.CasRequest(req)
 	if err != nil {
 		logrus.Warn("keepalive request error, err=", err.Error())
 		return
 	}
 	logrus.Infof("keepalive request, seq=%d", keepAliveSeq)
 
-	_, err = cascadeSrv.CasSipResponse(tx)
+	_, err = cassrv.CasSipResponse(tx)
 	if err != nil {
 		logrus.Warn("keepalive response error, err=", err.Error())
 		// 如果接收心跳应答失败，重新发送注册消息
@@ -5,12 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
 	sip "github.com/panjjo/gosip/sip/s"
 	"github.com/panjjo/gosip/utils"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"strings"
-	"time"
 
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/transform"
@@ -32,7 +32,7 @@ func getCameraNum() int64 {
 	for {
 		nvrs := []Devices{}
 		// 查找活跃注册NVR设备
-		db.FindT(db.DBClient, new(Devices), &nvrs, db.M{"active > ?": time.Now().Unix() - 1800, "regist=?": true}, "", skip, count, false)
+		db.FindT(db.DBClient, new(Devices), &nvrs, db.M{"status=?": m.DeviceStatusON, "regist=?": true}, "", skip, count, false)
 		for _, nvr := range nvrs {
 			num, _ := db.FindT(db.DBClient, new(Devices), &nvrs, db.M{"pdid=?": nvr.DeviceID}, "", skip, count, true)
 			dnum += num
@@ -62,7 +62,7 @@ func sipMessageCatalogMongo(u Devices, body string) error {
 		nvrs := []Devices{}
 		// 查找活跃注册NVR设备
 		//_, _ = dbClient.Find(userTB, M{"regist": true, "active": M{"$gt": time.Now().Unix() - 1800}}, skip, count, "", false, &nvrs, nil)
-		_, _ = db.FindT(db.DBClient, new(Devices), &nvrs, db.M{"regist": true, "active>?": time.Now().Unix() - 1800}, "", skip, count, false)
+		_, _ = db.FindT(db.DBClient, new(Devices), &nvrs, db.M{"regist": true, "status=?": m.DeviceStatusON}, "", skip, count, false)
 		var dskip int
 		for _, nvr := range nvrs {
 			devices := []DeviceItem{}
@@ -106,8 +106,8 @@ func sipMessageCatalogMongo(u Devices, body string) error {
 					Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 				}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE).SetSeqNo(msgSeq)
 				req := sip.NewRequest("", sip.MESSAGE, toaddr.URI, sip.DefaultSipVersion, hb.Build(), b)
-				req.SetDestination(sip.ReAddr)
-				tx, err := cascadeSrv.CasRequest(req)
+				req.SetDestination(cassrv.RemoteAddr())
+				tx, err := cassrv.CasRequest(req)
 				if err != nil {
 					logrus.Warn("catalog request error, str=", err.Error())
 					continue
@@ -115,7 +115,7 @@ func sipMessageCatalogMongo(u Devices, body string) error {
 				logrus.Infof("cas catalog request, deviceid=%s, chanid=%s", config.GB28181.LID, d.DeviceID)
 				logrus.Debugf("cas catalog request str:\n%s", req.String())
 
-				_, err = cascadeSrv.CasSipResponse(tx)
+				_, err = cassrv.CasSipResponse(tx)
 				if err != nil {
 					logrus.Warnf("catalog response error, chanid=%s, err=%s", d.DeviceID, err.Error())
 					continue
@@ -307,16 +307,16 @@ func sendCatalog(sn int, deviceID, channelID, name string, nvrNum, subNum int) e
 		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE).SetSeqNo(msgSeq)
 	req := sip.NewRequest("", sip.MESSAGE, toaddr.URI, sip.DefaultSipVersion, hb.Build(), b)
-	req.SetDestination(sip.ReAddr)
+	req.SetDestination(cassrv.RemoteAddr())
 	// tx, err := srv.Request(req)
-	tx, err := cascadeSrv.CasRequest(req)
+	tx, err := cassrv.CasRequest(req)
 	if err != nil {
 		logrus.Warnf("mysql catalog request error, err=%s", err.Error())
 		return err
 	}
 	logrus.Debugf("mysql catalog request, pid:%s, sid:%s, name:%s", deviceID, channelID, name)
 	// _, err = sip.SipResponse(tx)
-	_, err = cascadeSrv.CasSipResponse(tx)
+	_, err = cassrv.CasSipResponse(tx)
 	if err != nil {
 		logrus.Warnf("mysql catalog response error, sid=%s, err=%s", channelID, err.Error())
 		return err
@@ -467,14 +467,14 @@ func sipMessageCatalogNvrMysql(SN int) error {
 				Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 			}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE).SetSeqNo(msgSeq)
 			req := sip.NewRequest("", sip.MESSAGE, toaddr.URI, sip.DefaultSipVersion, hb.Build(), b)
-			req.SetDestination(sip.ReAddr)
+			req.SetDestination(cassrv.RemoteAddr())
 			// tx, err := srv.Request(req)
-			tx, err := cascadeSrv.CasRequest(req)
+			tx, err := cassrv.CasRequest(req)
 			if err != nil {
 				logrus.Warnf("sipMessageCatalogNvrMysql catalog request error, err=%s", err.Error())
 				continue
 			}
-			_, err = cascadeSrv.CasSipResponse(tx)
+			_, err = cassrv.CasSipResponse(tx)
 			if err != nil {
 				logrus.Warnf("sipMessageCatalogNvrMysql catalog response error, sid=%s, err=%s", device.ChannelID, err.Error())
 				continue
@@ -0,0 +1,68 @@
+package sipapi
+
+import (
+	"github.com/panjjo/gosip/db"
+	sip "github.com/panjjo/gosip/sip/s"
+	"github.com/sirupsen/logrus"
+)
+
+// CascadeDialogs 上级平台建立的会话，服务重启后仍可以处理上级的BYE并停止推流
+type CascadeDialogs struct {
+	db.DBModel
+	// header callid
+	CallID string `json:"callid" gorm:"column:callid;index"`
+	// 上级请求的通道ID
+	ChannelID string `json:"channelid" gorm:"column:channelid"`
+	// sip会话，用于匹配会话内请求
+	Dialog *sip.Dialog `gorm:"column:dialog" sql:"type:json" json:"-"`
+	// 推流信息，停止推流使用
+	Stream    string `json:"stream" gorm:"column:stream"`
+	SSRC      int    `json:"ssrc" gorm:"column:ssrc"`
+	StreamKey string `json:"streamkey" gorm:"column:streamkey"`
+}
+
+// 保存上级平台建立的会话
+func saveCascadeDialog(channelID string, dialog *sip.Dialog) {
+	casDialogs.Store(dialog.CallID, dialog)
+	if err := db.Create(db.DBClient, &CascadeDialogs{CallID: dialog.CallID, ChannelID: channelID, Dialog: dialog}); err != nil {
+		logrus.Warnf("save cascade dialog failed, callid:%s, err:%s", dialog.CallID, err)
+	}
+}
+
+// 查找上级平台的会话，内存中不存在时（服务重启）从数据库恢复
+func loadCascadeDialog(callID string) (*sip.Dialog, bool) {
+	if d, ok := casDialogs.Load(callID); ok {
+		return d.(*sip.Dialog), true
+	}
+	cd := CascadeDialogs{}
+	if err := db.GetQ(db.DBClient, &cd, db.M{"callid=?": callID}); err != nil || cd.Dialog == nil {
+		return nil, false
+	}
+	casDialogs.Store(callID, cd.Dialog)
+	return cd.Dialog, true
+}
+
+// 记录会话的推流信息
+func saveCascadeStream(c *ChannelStream, stream string, ssrc int) {
+	update := db.M{"stream": stream, "ssrc": ssrc, "streamkey": c.StreamKey}
+	if _, err := db.UpdateAll(db.DBClient, new(CascadeDialogs), db.M{"callid=?": c.CallID}, update); err != nil {
+		logrus.Warnf("save cascade stream failed, callid:%s, err:%s", c.CallID, err)
+	}
+}
+
+// 会话的推流信息，内存中的推流记录丢失后用来停止推流
+func cascadeStream(callID string) *ChannelStream {
+	cd := CascadeDialogs{}
+	if err := db.GetQ(db.DBClient, &cd, db.M{"callid=?": callID}); err != nil {
+		return &ChannelStream{}
+	}
+	return &ChannelStream{ChannelID: cd.ChannelID, CallID: cd.CallID, Stream: cd.Stream, SSRC: cd.SSRC, StreamKey: cd.StreamKey}
+}
+
+// 删除上级平台的会话
+func deleteCascadeDialog(callID string) {
+	casDialogs.Delete(callID)
+	if err := db.DelQ(db.DBClient, new(CascadeDialogs), db.M{"callid=?": callID}); err != nil {
+		logrus.Warnf("delete cascade dialog failed, callid:%s, err:%s", callID, err)
+	}
+}
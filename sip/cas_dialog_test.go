@@ -0,0 +1,73 @@
+package sipapi
+
+import (
+	"testing"
+
+	"github.com/panjjo/gosip/db"
+	sip "github.com/panjjo/gosip/sip/s"
+)
+
+func TestCasMatchDialog(t *testing.T) {
+	uas := &sip.Dialog{
+		CallID:    "cas-call-1",
+		LocalTag:  "uastag",
+		RemoteTag: "uactag",
+		LocalURI:  "sip:34020000001320000001@3402000000",
+		RemoteURI: "sip:34020000002000000001@3402000000",
+	}
+	casDialogs.Store(uas.CallID, uas)
+	defer casDialogs.Delete(uas.CallID)
+
+	// 上级平台一侧的会话，tag和地址与本端相反
+	uac := &sip.Dialog{
+		CallID:       uas.CallID,
+		LocalTag:     uas.RemoteTag,
+		RemoteTag:    uas.LocalTag,
+		LocalURI:     uas.RemoteURI,
+		RemoteURI:    uas.LocalURI,
+		RemoteTarget: uas.LocalURI,
+		LocalSeq:     1,
+	}
+	bye, err := uac.NewRequest(sip.BYE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !casMatchDialog(bye) {
+		t.Fatal("bye does not match cascade dialog")
+	}
+	if uas.RemoteSeq != 2 {
+		t.Fatalf("remote seq %d, want 2", uas.RemoteSeq)
+	}
+	uac.RemoteTag = "othertag"
+	if other, _ := uac.NewRequest(sip.BYE); casMatchDialog(other) {
+		t.Fatal("bye with other tag matched")
+	}
+}
+
+func TestLegacyStreamDialog(t *testing.T) {
+	legacy := legacyStream{
+		CallID: "legacy-call-1",
+		Ftag:   db.M{"tag": "fromtag"},
+		Ttag:   db.M{"tag": "totag"},
+		CseqNo: 5,
+	}
+	d := legacy.dialog("sip:34020000002000000001@3402000000", "sip:34020000001320000001@3402000000")
+	bye, err := d.NewRequest(sip.BYE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callID, _ := bye.CallID()
+	from, _ := bye.From()
+	to, _ := bye.To()
+	cseq, _ := bye.CSeq()
+	if string(*callID) != "legacy-call-1" || from.Params.String() != "tag=fromtag" || to.Params.String() != "tag=totag" {
+		t.Fatalf("bye headers %s", bye.String())
+	}
+	// 旧记录的cseq继续递增
+	if cseq.SeqNo != 6 {
+		t.Fatalf("bye cseq %d, want 6", cseq.SeqNo)
+	}
+	if bye.Recipient().String() != "sip:34020000001320000001@3402000000" {
+		t.Fatalf("request uri %s", bye.Recipient())
+	}
+}
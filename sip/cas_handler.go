@@ -3,6 +3,7 @@ package sipapi
 import (
 	"fmt"
 	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
 	sip "github.com/panjjo/gosip/sip/s"
 	"github.com/panjjo/gosip/utils"
 	"github.com/sirupsen/logrus"
@@ -42,6 +43,8 @@ var (
 	lastPort int
 	// 街道信息
 	streetMap *sync.Map
+	// 上级平台建立的会话，key=callid value=*sip.Dialog
+	casDialogs *sync.Map
 )
 
 func init() {
@@ -62,6 +65,7 @@ func init() {
 	nvrRecord = &sync.Map{}
 	portLock = &sync.Mutex{}
 	streetMap = &sync.Map{}
+	casDialogs = &sync.Map{}
 }
 
 func casHandlerMessage(req *sip.Request, tx *sip.Transaction) {
@@ -169,33 +173,36 @@ func casHandlerSubscribe(req *sip.Request, tx *sip.Transaction) {
 }
 
 func casSendFirstRegister() {
-	randStr := utils.RandString(16)
-	registerRequest := fmt.Sprintf(
-		"REGISTER sip:%s@%s SIP/2.0\r\n"+
-			"Via: SIP/2.0/UDP %s;rport;branch=z9hG4bK%s\r\n"+
-			"Max-Forwards: 70\r\n"+
-			"To: <sip:%s@%s>\r\n"+
-			"From: <sip:%s@%s>;tag=456789%s\r\n"+
-			"Call-ID: %s\r\n"+
-			"CSeq: %d REGISTER\r\n"+
-			"Contact: <sip:%s@%s>\r\n"+
-			"Expires: %d\r\n"+
-			"User-Agent: %s\r\n"+
-			"Content-Length: 0\r\n\r\n",
-		config.Cascade.SID, config.Cascade.SUDP,
-		config.Cascade.LAddr, randStr,
-		config.GB28181.LID, config.Cascade.LAddr,
-		config.GB28181.LID, config.Cascade.LAddr, randStr,
-		randStr, regSeq,
-		config.GB28181.LID, config.Cascade.LAddr,
-		EXPIRESTIME, USERAGENT)
-
-	cassrv.CasWrite([]byte(registerRequest))
+	// from
+	furi, _ := sip.ParseSipURI(fmt.Sprintf("sip:%s@%s", config.GB28181.LID, config.Cascade.LAddr))
+	fromaddr := &sip.Address{
+		URI:    &furi,
+		Params: sip.NewParams(),
+	}
+	fromaddr.Params.Add("tag", sip.String{Str: utils.RandString(20)})
+	// to
+	turi, _ := sip.ParseSipURI(fmt.Sprintf("sip:%s@%s", config.Cascade.SID, config.Cascade.SUDP))
+	toaddr := &sip.Address{
+		URI:    &turi,
+		Params: sip.NewParams(),
+	}
+	hb := sip.NewHeaderBuilder().SetTo(toaddr).SetFrom(fromaddr).AddVia(&sip.ViaHop{
+		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}).SetContact(&sip.Address{URI: &furi}).SetMethod(sip.REGISTER).SetSeqNo(regSeq)
+	req := sip.NewRequest("", sip.REGISTER, toaddr.URI, sip.DefaultSipVersion, hb.Build(), nil)
+	req.AppendHeader(&sip.GenericHeader{HeaderName: "Expires", Contents: strconv.Itoa(EXPIRESTIME)})
+	req.SetDestination(cassrv.RemoteAddr())
+	tx, err := cassrv.CasRequest(req)
+	if err != nil {
+		logrus.Errorf("first register request failed, err=%s", err.Error())
+		return
+	}
 	logrus.Infof("first register, from id:%s, to id:%s", config.GB28181.LID, config.Cascade.SID)
-	logrus.Debugf("first register, str:\n%s", registerRequest)
-	cassrv.CasNewPacket([]byte(registerRequest), sip.LoAddr)
+	logrus.Debugf("first register, str:\n%s", req.String())
+	casHandlerRegister(req, tx)
 }
 
+// 处理向上级注册的响应，需要鉴权时发送带Authorization的第二次注册
 func casHandlerRegister(req *sip.Request, tx *sip.Transaction) {
 	response, err := cassrv.GetCasRegResponse(tx)
 	if err != nil {
@@ -223,30 +230,43 @@ func casHandlerRegister(req *sip.Request, tx *sip.Transaction) {
 		logrus.Warn("register response could not find WWW-Authenticate")
 		return
 	}
-	authHd := hdrs[0].(*sip.GenericHeader)
-	auth := sip.AuthFromValue(authHd.Contents)
+	auth := casChallenge(hdrs)
+	if auth == nil {
+		logrus.Warn("register response WWW-Authenticate invalid")
+		return
+	}
 
 	// digest access authentication
 	uri := fmt.Sprintf("sip:%s@%s", config.Cascade.SID, config.Cascade.SUDP)
-	HA1 := config.GB28181.LID + ":" + auth.Get("realm") + ":" + config.Cascade.SPWD
-	HA2 := "REGISTER" + ":" + uri
-	authResp := utils.GetMD5(utils.GetMD5(HA1) + ":" + auth.Get("nonce") + ":" + utils.GetMD5(HA2))
+	auth.SetUsername(config.GB28181.LID).SetPassword(config.Cascade.SPWD).SetMethod(string(sip.REGISTER)).SetURI(uri)
+	if auth.Get("qop") != "" {
+		auth.SetCnonce(utils.RandString(16)).SetNc("00000001")
+	}
+	auth.CalcResponse()
 
 	secReq := sip.NewRequestFromResponse(sip.REGISTER, response)
-	authStr := fmt.Sprintf("Digest username=\"%s\", realm=\"%s\", nonce=\"%s\", uri=\"%s\", response=\"%s\", algorithm=MD5", config.GB28181.LID, auth.Get("realm"), auth.Get("nonce"), uri, authResp)
-	secReq.AppendHeader(&sip.GenericHeader{HeaderName: "Authorization", Contents: authStr})
+	secReq.SetRecipient(req.Recipient())
+	sip.CopyHeaders("Contact", req, secReq)
+	secReq.AppendHeader(&sip.GenericHeader{HeaderName: "Authorization", Contents: auth.String()})
 	secReq.AppendHeader(&sip.GenericHeader{HeaderName: "User-Agent", Contents: USERAGENT})
 	secReq.AppendHeader(&sip.GenericHeader{HeaderName: "Content-Length", Contents: "0"})
 	secReq.AppendHeader(&sip.GenericHeader{HeaderName: "Expires", Contents: strconv.Itoa(EXPIRESTIME)})
+	secReq.SetDestination(req.Destination())
 
-	cascadeSrv.CasWrite([]byte(secReq.String()))
+	secTx, err := cassrv.CasRequest(secReq)
+	if err != nil {
+		logrus.Errorf("second register request failed, err=%s", err.Error())
+		return
+	}
 	logrus.Infof("second register request, uri:%s", uri)
 	logrus.Debugf("second register request, str:\n%s", secReq.String())
 	sq, _ := secReq.CSeq()
 	regSeq = uint(sq.SeqNo) + 1
 
-	response, _ = cascadeSrv.CasSipResponse(tx)
-	if response != nil {
+	response, err = cassrv.CasSipResponse(secTx)
+	if err != nil {
+		logrus.Warnf("second register response failed, err=%s", err.Error())
+	} else {
 		logrus.Info("second register response")
 		logrus.Debugf("second register response, str:\n%s", response.String())
 	}
@@ -256,6 +276,28 @@ func casHandlerRegister(req *sip.Request, tx *sip.Transaction) {
 	}
 }
 
+// casChallenge 选择上级的认证头，上级按算法提供多个认证头时优先使用配置的算法 RFC 8760
+func casChallenge(hdrs []sip.Header) *sip.Authorization {
+	var auth *sip.Authorization
+	for _, hdr := range hdrs {
+		h, ok := hdr.(*sip.GenericHeader)
+		if !ok {
+			continue
+		}
+		a := sip.AuthFromValue(h.Contents)
+		if auth == nil {
+			auth = a
+		}
+		if config.Cascade.Algorithm != "" && sip.AlgorithmEqual(a.Get("algorithm"), config.Cascade.Algorithm) {
+			return a
+		}
+	}
+	if auth != nil && config.Cascade.Algorithm != "" {
+		logrus.Warnf("upstream not offer algorithm %s, use %s", config.Cascade.Algorithm, auth.Get("algorithm"))
+	}
+	return auth
+}
+
 func casHandlerInvite(req *sip.Request, tx *sip.Transaction) {
 	logrus.Infof("cas invite request, str:\n%s", req.String())
 
@@ -299,7 +341,7 @@ func casHandlerInvite(req *sip.Request, tx *sip.Transaction) {
 	devices := Devices{}
 	// 判断是sip注册或者rtsp流
 	// streamType := 1 // 流类型，1-sip，2-rtsp
-	cnt, _ := db.FindT(db.DBClient, new(Devices), &devices, db.M{"deviceid": deviceID, "active> ?": time.Now().Unix() - 1800}, "", 0, 100, true)
+	cnt, _ := db.FindT(db.DBClient, new(Devices), &devices, db.M{"deviceid": deviceID, "status=?": m.DeviceStatusON}, "", 0, 100, true)
 	//cnt, _ := dbClient.Count(deviceTB, M{"deviceid": deviceID, "active": M{"$gt": time.Now().Unix() - 1800}})
 	// sip注册
 	if cnt > 0 {
@@ -514,6 +556,11 @@ func casHandlerInvite(req *sip.Request, tx *sip.Transaction) {
 		sendRtpMap.Delete(RTPKEY)
 		return
 	}
+	if dialog, err := sip.NewDialogFromRequest(req, resp); err == nil {
+		saveCascadeDialog(deviceID, dialog)
+	} else {
+		logrus.Warnf("cas invite dialog failed, err=%s", err.Error())
+	}
 
 	// sendRtp
 	host := m.Connection.IP.String()
@@ -598,6 +645,11 @@ func casHandlerInfo(req *sip.Request, tx *sip.Transaction) {
 
 	var ssrc string
 	callID, _ := req.CallID()
+	if !casMatchDialog(req) {
+		logrus.Warnf("cas info dialog not found, callid:%s", string(*callID))
+		tx.CasResponse(sip.NewResponseFromRequest("", req, 481, "Call/Transaction Does Not Exist", []byte("")))
+		return
+	}
 	if v, ok := hisCallMap.Load(string(*callID)); ok {
 		ssrc = v.(string)
 	}
@@ -625,9 +677,28 @@ func casHandlerBye(req *sip.Request, tx *sip.Transaction) {
 	to, _ := req.To()
 	deviceID := to.Address.User().String()
 	callID, _ := req.CallID()
+	if !casMatchDialog(req) {
+		logrus.Warnf("cas bye dialog not found, callid:%s", string(*callID))
+		tx.CasResponse(sip.NewResponseFromRequest("", req, 481, "Call/Transaction Does Not Exist", []byte("")))
+		return
+	}
 	hisCallMap.Delete(string(*callID))
 	closeChannelStream(deviceID, string(*callID))
+	deleteCascadeDialog(string(*callID))
 
 	tx.CasResponse(sip.NewResponseFromRequest("", req, http.StatusOK, http.StatusText(http.StatusOK), []byte("")))
 	logrus.Infof("cas bye handler finished, callid:%s", string(*callID))
 }
+
+// 判断上级平台的会话内请求是否属于已建立的会话
+func casMatchDialog(req *sip.Request) bool {
+	callID, ok := req.CallID()
+	if !ok {
+		return false
+	}
+	d, ok := loadCascadeDialog(string(*callID))
+	if !ok {
+		return false
+	}
+	return d.Match(req)
+}
@@ -38,6 +38,7 @@ type playParams struct {
 	S, E       time.Time
 	SSRC       string
 	Resp       *sip.Response
+	Dialog     *sip.Dialog // 与下级设备的会话，发送回放控制INFO和BYE
 	DeviceID   string
 	UserID     string
 	ext        int64  // 推流等待的过期时间，用于判断是否请求成功但推流失败。超过还未接收到推流定义为失败，重新请求推流或者关闭此ssrc
@@ -326,22 +327,8 @@ func sendNewRtpServer(isUDP int, c *ChannelStream, ssrc string) error {
 	p.stream = ssrc
 	callIDMap.Store(c.CallID, p)
 
-	// 成功后保存mongo，用来后续系统关闭推流使用
-	//dbClient.Insert(STREAMTB, ChannelStream{
-	//	ChannelID: c.ChannelID,
-	//	Host:      c.Host,
-	//	Port:      c.Port,
-	//	CallID:    c.CallID,
-	//	Stream:    ssrc,
-	//	SSRC:      int(tmpSeq),
-	//	Status:    0,
-	//	Stop:      false,
-	//	Time:      time.Now().Format("2006-01-02 15:04:05"),
-	//	StreamKey: c.StreamKey,
-	//	LocPort:   locPort,
-	//	PlayT:     c.PlayT,
-	//	IsActive:  c.IsActive,
-	//})
+	// 成功后保存推流信息，服务重启后收到上级BYE时停止推流使用
+	saveCascadeStream(c, ssrc, int(tmpSeq))
 	logrus.Infof("start to send gb stream, stream=%s, ssrc=%d, ip=%s, port=%d", ssrc, tmpSeq, c.Host, c.Port)
 	return nil
 }
@@ -377,8 +364,7 @@ func stopSendRtp(stream string, ssrc int, key string) error {
 }
 
 func closeChannelStream(deviceID, callID string) {
-	cstm := &ChannelStream{}
-	//dbClient.Get(STREAMTB, M{"callid": callID}, cstm)
+	cstm := cascadeStream(callID)
 	playbackMap.Delete(callID)
 	if cstm.ChannelID == "" || cstm.Stream == "" {
 		logrus.Debugf("don't start send rtp, did:%s, callid:%s", deviceID, callID)
@@ -39,7 +39,6 @@ func cascadeInit() {
 	// 创建级联服务
 	time.Sleep(time.Duration(2) * time.Second)
 	cassrv = sip.CasNewServer()
-	cassrv.RegistHandler(sip.REGISTER, casHandlerRegister)
 	cassrv.RegistHandler(sip.MESSAGE, casHandlerMessage)
 	cassrv.RegistHandler(sip.SUBSCRIBE, casHandlerSubscribe)
 	cassrv.RegistHandler(sip.INVITE, casHandlerInvite)
@@ -47,8 +46,9 @@ func cascadeInit() {
 	cassrv.RegistHandler(sip.ACK, casHandlerAck)
 	cassrv.RegistHandler(sip.BYE, casHandlerBye)
 	cassrv.CreateCasUDPServer(config.Cascade.SUDP, config.Cascade.LUDP)
+	// 先启动监听，注册需要等待上级响应
+	go cassrv.ListenCasUDPServer()
 	casSendFirstRegister()
 	casKeepAliveCron()
-	go cassrv.ListenCasUDPServer()
 	// go CasRestfulAPI()
 }
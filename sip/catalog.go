@@ -0,0 +1,158 @@
+package sipapi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
+	"github.com/panjjo/gosip/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// 目录分包响应汇总超时时间，单位秒，超时未收齐的查询不做通道删除
+const catalogSyncTimeout = 60
+
+// catalogSync 一次目录查询的分包汇总，收齐SumNum条后与数据库通道对比
+type catalogSync struct {
+	// 已收到的通道编号
+	seen map[string]bool
+	// 最后收到分包时间
+	at int64
+}
+
+var (
+	_catalogSyncs  = map[string]*catalogSync{}
+	_catalogSyncsL = &sync.Mutex{}
+)
+
+// catalogReceived 记录收到的目录分包，收齐SumNum条后返回本次查询的全部通道编号
+func catalogReceived(message *MessageDeviceListResponse) (map[string]bool, bool) {
+	now := time.Now().Unix()
+	key := fmt.Sprintf("%s:%d", message.DeviceID, message.SN)
+	_catalogSyncsL.Lock()
+	defer _catalogSyncsL.Unlock()
+	for k, s := range _catalogSyncs {
+		if s.at+catalogSyncTimeout < now {
+			logrus.Warnln("catalog sync timeout,", k, "received:", len(s.seen))
+			delete(_catalogSyncs, k)
+		}
+	}
+	s, ok := _catalogSyncs[key]
+	if !ok {
+		s = &catalogSync{seen: map[string]bool{}}
+		_catalogSyncs[key] = s
+	}
+	s.at = now
+	for _, item := range message.Item {
+		s.seen[item.ChannelID] = true
+	}
+	if len(s.seen) < message.SumNum {
+		return nil, false
+	}
+	delete(_catalogSyncs, key)
+	return s.seen, true
+}
+
+// 解析设备所包含的通道信息并保存到数据库
+// 目录可能分多个包返回，每包直接更新或创建通道和组织节点，收齐SumNum条后将目录中不存在的通道和组织节点删除
+func sipMessageCatalog(u Devices, body []byte) error {
+	if _, ok := _activeDevices.Get(u.DeviceID); !ok {
+		logrus.Warnln("catalog from inactive device,", u.DeviceID)
+		return errors.New("device not active")
+	}
+	message := &MessageDeviceListResponse{}
+	if err := utils.XMLDecode(body, message); err != nil {
+		logrus.Errorln("Message Unmarshal xml err:", err, "body:", string(body))
+		return err
+	}
+	// 通道归属发送目录的已注册设备，不使用xml中的设备编号
+	message.DeviceID = u.DeviceID
+	for _, d := range message.Item {
+		switch catalogNodeType(d.ChannelID) {
+		case TreeNodeChannel:
+			saveCatalogChannel(message.DeviceID, d)
+		case "":
+			logrus.Infoln("unknown catalog item,id:", d.ChannelID, "deviceid:", message.DeviceID)
+		default:
+			saveCatalogOrganization(message.DeviceID, d)
+		}
+	}
+	if seen, ok := catalogReceived(message); ok {
+		removeCatalogChannels(message.DeviceID, seen)
+		removeCatalogOrganizations(message.DeviceID, seen)
+	}
+	return nil
+}
+
+// saveCatalogChannel 使用目录项更新通道，通道不存在时创建
+func saveCatalogChannel(deviceID string, d Channels) {
+	channel := Channels{ChannelID: d.ChannelID, DeviceID: deviceID}
+	// 包含已从目录中移除的通道，重新出现时恢复
+	err := db.Get(db.DBClient.Unscoped(), &channel)
+	if err != nil && !db.RecordNotFound(err) {
+		logrus.Warnln("get catalog channel error,", d.ChannelID, "deviceid:", deviceID, err)
+		return
+	}
+	status := channel.Status
+	channel.Active = time.Now().Unix()
+	channel.updateFromCatalog(d)
+	if channel.Status == "" {
+		channel.Status = m.DeviceStatusON
+	}
+	if err != nil {
+		// 设备新增的通道，使用设备上报的通道编号
+		channel.StreamType = m.StreamTypePush
+		if err := db.Create(db.DBClient, &channel); err != nil {
+			logrus.Warnln("create catalog channel error,", d.ChannelID, "deviceid:", deviceID, err)
+			return
+		}
+		logrus.Infoln("new catalog channel,channelid:", d.ChannelID, "deviceid:", deviceID)
+		go notify(notifyChannelsAdd(channel))
+		return
+	}
+	if channel.DeletedAt != nil {
+		channel.DeletedAt = nil
+		db.Save(db.DBClient.Unscoped(), &channel)
+		logrus.Infoln("catalog channel restored,channelid:", d.ChannelID, "deviceid:", deviceID)
+		go notify(notifyChannelsAdd(channel))
+		return
+	}
+	db.Save(db.DBClient, &channel)
+	if channel.Status != status {
+		go notify(notifyChannelsActive(channel))
+	}
+}
+
+// removeCatalogChannels 设备目录中已不存在的通道标记为删除
+// 通道可能由平台配置了备注等信息，只做软删除，通道重新出现在目录中时恢复
+func removeCatalogChannels(deviceID string, seen map[string]bool) {
+	channels := []Channels{}
+	if _, err := db.FindT(db.DBClient, new(Channels), &channels, db.M{"deviceid=?": deviceID}, "", 0, -1, false); err != nil {
+		logrus.Warnln("find device channels error,", deviceID, err)
+		return
+	}
+	for _, channel := range channels {
+		if seen[channel.ChannelID] {
+			continue
+		}
+		removeChannel(channel)
+	}
+}
+
+// removeChannel 设备已删除的通道置为离线并标记为删除
+func removeChannel(channel Channels) {
+	channel.Status = m.DeviceStatusOFF
+	if _, err := db.UpdateAll(db.DBClient, new(Channels), db.M{"id=?": channel.ID}, Channels{Status: channel.Status}); err != nil {
+		logrus.Warnln("remove catalog channel error,", channel.ChannelID, err)
+		return
+	}
+	if err := db.DelQ(db.DBClient, new(Channels), db.M{"id=?": channel.ID}); err != nil {
+		logrus.Warnln("remove catalog channel error,", channel.ChannelID, err)
+		return
+	}
+	logrus.Infoln("catalog channel removed,channelid:", channel.ChannelID, "deviceid:", channel.DeviceID)
+	go notify(notifyChannelsRemove(channel))
+}
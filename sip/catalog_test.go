@@ -0,0 +1,43 @@
+package sipapi
+
+import "testing"
+
+func catalogPacket(sn, sum int, ids ...string) *MessageDeviceListResponse {
+	message := &MessageDeviceListResponse{DeviceID: "34020000001110000001", SN: sn, SumNum: sum}
+	for _, id := range ids {
+		message.Item = append(message.Item, Channels{ChannelID: id})
+	}
+	return message
+}
+
+func TestCatalogReceived(t *testing.T) {
+	if _, ok := catalogReceived(catalogPacket(1, 3, "34020000001320000001", "34020000001320000002")); ok {
+		t.Fatal("catalog completed before SumNum")
+	}
+	// 其他查询的分包不计入
+	if _, ok := catalogReceived(catalogPacket(2, 3, "34020000001320000003")); ok {
+		t.Fatal("packet of other query counted")
+	}
+	// 重复的分包不计数
+	if _, ok := catalogReceived(catalogPacket(1, 3, "34020000001320000002")); ok {
+		t.Fatal("duplicate item counted")
+	}
+	seen, ok := catalogReceived(catalogPacket(1, 3, "34020000001320000003"))
+	if !ok {
+		t.Fatal("catalog not completed")
+	}
+	for _, id := range []string{"34020000001320000001", "34020000001320000002", "34020000001320000003"} {
+		if !seen[id] {
+			t.Errorf("%s not in catalog", id)
+		}
+	}
+	// 收齐后重新开始汇总
+	if _, ok := catalogReceived(catalogPacket(1, 3, "34020000001320000001")); ok {
+		t.Fatal("completed catalog reused")
+	}
+	_catalogSyncsL.Lock()
+	for k := range _catalogSyncs {
+		delete(_catalogSyncs, k)
+	}
+	_catalogSyncsL.Unlock()
+}
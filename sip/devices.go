@@ -4,7 +4,6 @@ import (
 	"encoding/xml"
 	"fmt"
 	"net"
-	"time"
 
 	"github.com/panjjo/gosip/db"
 	"github.com/panjjo/gosip/m"
@@ -49,14 +48,28 @@ type Devices struct {
 	// Model 型号
 	Model  string `json:"model"  gorm:"column:model"`
 	URIStr string `json:"uri"  gorm:"column:uri"`
-	// ActiveAt 最后心跳检测时间
+	// ActiveAt 最后心跳检测时间，设备离线后保留为最后活跃时间
 	ActiveAt int64 `json:"active" gorm:"column:active"`
+	// Status 设备状态 ON 在线 OFF 离线，心跳超时后置为离线
+	Status string `json:"status" gorm:"column:status"`
+	// KeepaliveInterval 心跳间隔，单位秒，为0使用默认值60
+	KeepaliveInterval int `json:"keepaliveinterval" gorm:"column:keepaliveinterval"`
+	// KeepaliveTimeout 心跳超时次数，连续未收到心跳的次数达到后设备离线，为0使用默认值3
+	KeepaliveTimeout int `json:"keepalivetimeout" gorm:"column:keepalivetimeout"`
+	// PositionInterval 移动位置订阅上报间隔，单位秒，为0不订阅
+	PositionInterval int `json:"positioninterval" gorm:"column:positioninterval"`
 	// Regist 是否注册
 	Regist bool `json:"regist"  gorm:"column:regist"`
+	// Expires 注册过期时间，过期后设备下线
+	Expires int64 `json:"expires" gorm:"column:expires"`
 	// PWD 密码
 	PWD string `json:"pwd" gorm:"column:pwd"`
+	// Algorithm 注册认证使用的摘要算法 MD5 MD5-sess SHA-256 SHA-256-sess，为空使用MD5
+	Algorithm string `json:"algorithm" gorm:"column:algorithm"`
 	// Source
 	Source string `json:"source"  gorm:"column:source"`
+	// DeviceStatus 最近一次查询到的设备状态
+	DeviceStatus DeviceStatus `json:"devicestatus" gorm:"column:devicestatus;type:text"`
 
 	Sys m.SysInfo `json:"sysinfo" gorm:"-"`
 
@@ -115,6 +128,14 @@ type Channels struct {
 	Model        string `xml:"Model" json:"model"  gorm:"column:model"`
 	Owner        string `xml:"Owner"  json:"owner"  gorm:"column:owner"`
 	CivilCode    string `xml:"CivilCode" json:"civilcode"  gorm:"column:civilcode"`
+	// ParentID 上级节点编号，设备未上报时为所属行政区划
+	ParentID string `xml:"ParentID" json:"parentid"  gorm:"column:parentid"`
+	// BusinessGroupID 所属业务分组
+	BusinessGroupID string `xml:"BusinessGroupID" json:"businessgroupid"  gorm:"column:businessgroupid"`
+	// Longitude 经度
+	Longitude float64 `xml:"Longitude" json:"longitude"  gorm:"column:longitude"`
+	// Latitude 纬度
+	Latitude float64 `xml:"Latitude" json:"latitude"  gorm:"column:latitude"`
 	// Address ip地址
 	Address     string `xml:"Address"  json:"address"  gorm:"column:address"`
 	Parental    int    `xml:"Parental"  json:"parental"  gorm:"column:parental"`
@@ -139,6 +160,8 @@ type Channels struct {
 	StreamType string `json:"streamtype"  gorm:"column:streamtype"`
 	// streamtype=pull时，拉流地址
 	URL string `json:"url"  gorm:"column:url"`
+	// Position 移动设备最新位置
+	Position MobilePosition `xml:"-" json:"position" gorm:"column:position;type:text"`
 
 	addr *sip.Address `gorm:"-"`
 }
@@ -219,10 +242,23 @@ func parserDevicesFromReqeust(req *sip.Request) (Devices, bool) {
 	return u, true
 }
 
+// deviceOwns id是否为设备本身或设备下的通道，用来校验设备上报消息中的DeviceID
+func deviceOwns(deviceID, id string) bool {
+	if id == "" {
+		return false
+	}
+	if id == deviceID {
+		return true
+	}
+	channel := Channels{}
+	return db.GetQ(db.DBClient, &channel, db.M{"deviceid=?": deviceID, "channelid=?": id}) == nil
+}
+
 // 向设备发送获取信息（注册设备）
 func sipDeviceInfo(to Devices) {
 	hb := sip.NewHeaderBuilder().SetTo(to.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
-		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+		Transport: to.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE)
 	req := sip.NewRequest("", sip.MESSAGE, to.addr.URI, sip.DefaultSipVersion, hb.Build(), sip.GetDeviceInfoXML(to.DeviceID))
 	req.SetDestination(to.source)
@@ -241,7 +277,8 @@ func sipDeviceInfo(to Devices) {
 // sipCatalog 获取注册设备包含的列表
 func sipCatalog(to Devices) {
 	hb := sip.NewHeaderBuilder().SetTo(to.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
-		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+		Transport: to.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE)
 	req := sip.NewRequest("", sip.MESSAGE, to.addr.URI, sip.DefaultSipVersion, hb.Build(), sip.GetCatalogXML(to.DeviceID))
 	req.SetDestination(to.source)
@@ -293,39 +330,28 @@ type MessageDeviceListResponse struct {
 	Item     []Channels `xml:"DeviceList>Item"`
 }
 
-// 解析设备所包含的通道信息并保存到数据库
-func sipMessageCatalog(u Devices, body []byte) error {
-	message := &MessageDeviceListResponse{}
-	if err := utils.XMLDecode(body, message); err != nil {
-		logrus.Errorln("Message Unmarshal xml err:", err, "body:", string(body))
-		return err
+// updateFromCatalog 使用设备目录中的通道信息更新通道
+func (c *Channels) updateFromCatalog(d Channels) {
+	c.URIStr = fmt.Sprintf("sip:%s@%s", d.ChannelID, _sysinfo.Region)
+	c.Status = transDeviceStatus(d.Status)
+	c.Name = d.Name
+	c.Manufacturer = d.Manufacturer
+	c.Model = d.Model
+	c.Owner = d.Owner
+	c.CivilCode = d.CivilCode
+	c.ParentID = catalogParent(c.DeviceID, d)
+	c.BusinessGroupID = d.BusinessGroupID
+	if d.Longitude != 0 || d.Latitude != 0 {
+		// 设备未上报坐标时保留平台设置的坐标
+		c.Longitude = d.Longitude
+		c.Latitude = d.Latitude
 	}
-	if message.SumNum > 0 {
-		for _, d := range message.Item {
-			channel := Channels{ChannelID: d.ChannelID, DeviceID: message.DeviceID}
-			if err := db.Get(db.DBClient, &channel); err == nil {
-				channel.Active = time.Now().Unix()
-				channel.URIStr = fmt.Sprintf("sip:%s@%s", d.ChannelID, _sysinfo.Region)
-				channel.Status = transDeviceStatus(d.Status)
-				channel.Name = d.Name
-				channel.Manufacturer = d.Manufacturer
-				channel.Model = d.Model
-				channel.Owner = d.Owner
-				channel.CivilCode = d.CivilCode
-				// Address ip地址
-				channel.Address = d.Address
-				channel.Parental = d.Parental
-				channel.SafetyWay = d.SafetyWay
-				channel.RegisterWay = d.RegisterWay
-				channel.Secrecy = d.Secrecy
-				db.Save(db.DBClient, &channel)
-				go notify(notifyChannelsActive(channel))
-			} else {
-				logrus.Infoln("deviceid not found,deviceid:", d.DeviceID, "pdid:", message.DeviceID, "err", err)
-			}
-		}
-	}
-	return nil
+	// Address ip地址
+	c.Address = d.Address
+	c.Parental = d.Parental
+	c.SafetyWay = d.SafetyWay
+	c.RegisterWay = d.RegisterWay
+	c.Secrecy = d.Secrecy
 }
 
 var deviceStatusMap = map[string]string{
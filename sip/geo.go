@@ -0,0 +1,81 @@
+package sipapi
+
+import (
+	"math"
+	"sort"
+
+	"github.com/panjjo/gosip/db"
+)
+
+// 地球平均半径，单位m
+const earthRadius = 6371000.0
+
+// Distance 两个经纬度坐标间的球面距离，单位m
+func Distance(lng1, lat1, lng2, lat2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ChannelsInBounds 查询经纬度范围内的通道，未设置坐标的通道不返回
+func ChannelsInBounds(minLng, minLat, maxLng, maxLat float64, limit int) ([]Channels, error) {
+	channels := []Channels{}
+	where := db.M{
+		"longitude>=?":                  minLng,
+		"longitude<=?":                  maxLng,
+		"latitude>=?":                   minLat,
+		"latitude<=?":                   maxLat,
+		"(longitude<>0 OR latitude<>0)": nil,
+	}
+	_, err := db.FindT(db.DBClient, new(Channels), &channels, where, "channelid", 0, limit, false)
+	return channels, err
+}
+
+// NearbyChannel 附近通道
+type NearbyChannel struct {
+	Channels
+	// Distance 与查询中心点的距离，单位m
+	Distance float64 `json:"distance"`
+}
+
+// ChannelsNearby 查询中心点半径范围内的通道，按距离由近到远返回
+// 先按半径换算的经纬度范围查询，再按球面距离过滤
+func ChannelsNearby(lng, lat, radius float64, limit int) ([]NearbyChannel, error) {
+	minLng, minLat, maxLng, maxLat := nearbyBounds(lng, lat, radius)
+	channels, err := ChannelsInBounds(minLng, minLat, maxLng, maxLat, -1)
+	if err != nil {
+		return nil, err
+	}
+	return nearbyChannels(lng, lat, radius, limit, channels), nil
+}
+
+// nearbyBounds 中心点半径范围的外接经纬度范围
+func nearbyBounds(lng, lat, radius float64) (minLng, minLat, maxLng, maxLat float64) {
+	dLat := radius / earthRadius * 180 / math.Pi
+	minLat, maxLat = math.Max(lat-dLat, -90), math.Min(lat+dLat, 90)
+	minLng, maxLng = -180.0, 180.0
+	// 靠近两极或跨越180度经线时不限制经度
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0.01 {
+		if dLng := dLat / cos; lng-dLng >= -180 && lng+dLng <= 180 {
+			minLng, maxLng = lng-dLng, lng+dLng
+		}
+	}
+	return
+}
+
+// nearbyChannels 按球面距离过滤半径范围内的通道，由近到远返回limit条
+func nearbyChannels(lng, lat, radius float64, limit int, channels []Channels) []NearbyChannel {
+	list := []NearbyChannel{}
+	for _, c := range channels {
+		if d := Distance(lng, lat, c.Longitude, c.Latitude); d <= radius {
+			list = append(list, NearbyChannel{Channels: c, Distance: d})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Distance < list[j].Distance })
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
@@ -0,0 +1,68 @@
+package sipapi
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	cases := []struct {
+		lng1, lat1, lng2, lat2 float64
+		want, delta            float64
+	}{
+		{116.397, 39.909, 116.397, 39.909, 0, 0},
+		// 纬度1度约111.2km
+		{120, 30, 120, 31, 111195, 1},
+		// 赤道上经度1度
+		{0, 0, 1, 0, 111195, 1},
+		// 北京到上海约1067km
+		{116.397, 39.909, 121.473, 31.230, 1067000, 3000},
+		// 跨越180度经线
+		{179.5, 0, -179.5, 0, 111195, 1},
+	}
+	for _, c := range cases {
+		if got := Distance(c.lng1, c.lat1, c.lng2, c.lat2); math.Abs(got-c.want) > c.delta {
+			t.Errorf("%v,%v-%v,%v: %.0f, want %.0f", c.lng1, c.lat1, c.lng2, c.lat2, got, c.want)
+		}
+	}
+}
+
+func TestNearbyBounds(t *testing.T) {
+	minLng, minLat, maxLng, maxLat := nearbyBounds(116.397, 39.909, 1000)
+	// 范围需包含半径圆上的各点
+	for _, p := range [][2]float64{{116.397, 39.9179}, {116.397, 39.9001}, {116.4087, 39.909}, {116.3853, 39.909}} {
+		if d := Distance(116.397, 39.909, p[0], p[1]); d > 1000 {
+			t.Fatalf("test point %v out of radius: %.0f", p, d)
+		}
+		if p[0] < minLng || p[0] > maxLng || p[1] < minLat || p[1] > maxLat {
+			t.Errorf("point %v out of bounds %v %v %v %v", p, minLng, minLat, maxLng, maxLat)
+		}
+	}
+	// 跨越180度经线或靠近极点时不限制经度
+	for _, c := range [][2]float64{{179.99, 0}, {0, 89.999}} {
+		if minLng, _, maxLng, _ := nearbyBounds(c[0], c[1], 10000); minLng != -180 || maxLng != 180 {
+			t.Errorf("%v: lng bounds %v %v", c, minLng, maxLng)
+		}
+	}
+	if _, minLat, _, maxLat := nearbyBounds(0, 89.99, 10000); maxLat != 90 || minLat >= 89.99 {
+		t.Errorf("lat bounds %v %v", minLat, maxLat)
+	}
+}
+
+func TestNearbyChannels(t *testing.T) {
+	channels := []Channels{
+		{ChannelID: "far", Longitude: 116.397, Latitude: 39.920},
+		{ChannelID: "near", Longitude: 116.397, Latitude: 39.910},
+		{ChannelID: "middle", Longitude: 116.397, Latitude: 39.913},
+	}
+	list := nearbyChannels(116.397, 39.909, 1000, 0, channels)
+	if len(list) != 2 || list[0].ChannelID != "near" || list[1].ChannelID != "middle" {
+		t.Fatalf("nearby %+v", list)
+	}
+	if list[0].Distance > list[1].Distance || list[0].Distance < 100 || list[0].Distance > 120 {
+		t.Fatalf("distance %v %v", list[0].Distance, list[1].Distance)
+	}
+	if list := nearbyChannels(116.397, 39.909, 1000, 1, channels); len(list) != 1 || list[0].ChannelID != "near" {
+		t.Fatalf("limited nearby %+v", list)
+	}
+}
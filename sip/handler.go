@@ -2,9 +2,12 @@ package sipapi
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
 	sip "github.com/panjjo/gosip/sip/s"
 	"github.com/panjjo/gosip/utils"
 	"github.com/sirupsen/logrus"
@@ -55,10 +58,16 @@ func handlerMessage(req *sip.Request, tx *sip.Transaction) {
 		return
 	case "Keepalive":
 		// heardbeat
-		if err := sipMessageKeepalive(u, body); err == nil {
+		err := sipMessageKeepalive(u, body)
+		if err == nil {
 			tx.Respond(sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
-			// 心跳后同步注册设备列表信息
-			sipCatalog(u)
+			// 心跳时检查订阅，通道变化由订阅通知更新。订阅需要等待设备响应，不阻塞心跳处理
+			go checkSubscriptions(u)
+			return
+		}
+		if err == errKeepaliveUnregistered {
+			// 未注册的设备拒绝心跳，设备收到后重新注册
+			tx.Respond(sip.NewResponseFromRequest("", req, http.StatusForbidden, http.StatusText(http.StatusForbidden), nil))
 			return
 		}
 	case "RecordInfo":
@@ -70,25 +79,60 @@ func handlerMessage(req *sip.Request, tx *sip.Transaction) {
 		sipMessageDeviceInfo(u, body)
 		tx.Respond(sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
 		return
+	case "DeviceStatus":
+		// 设备状态
+		sipMessageDeviceStatus(u, body)
+		tx.Respond(sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+		return
+	case "Alarm":
+		// 报警通知
+		sipMessageAlarm(u, body)
+		tx.Respond(sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+		return
+	case "MobilePosition":
+		// 移动设备位置
+		sipMessageMobilePosition(u, body)
+		tx.Respond(sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+		return
+	case "PresetQuery":
+		// 设备预置位列表
+		sipMessagePresetQuery(u, body)
+		tx.Respond(sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+		return
 	}
 	tx.Respond(sip.NewResponseFromRequest("", req, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil))
 }
 
 // 对设备的Register消息进行处理
 func handlerRegister(req *sip.Request, tx *sip.Transaction) {
+	fromUser, ok := parserDevicesFromReqeust(req)
+	if !ok {
+		return
+	}
+	ip := sourceIP(fromUser.source)
+	if _registerBans.locked(fromUser.DeviceID, ip) {
+		// 认证失败次数过多，锁定期间直接拒绝
+		tx.Respond(sip.NewResponseFromRequest("", req, http.StatusForbidden, http.StatusText(http.StatusForbidden), nil))
+		return
+	}
+	user := Devices{DeviceID: fromUser.DeviceID}
+	err := db.Get(db.DBClient, &user)
+	if db.RecordNotFound(err) && autoRegisterAllowed(fromUser) {
+		// 未创建的设备使用域密码认证，认证成功后按首次激活保存
+		user = Devices{DeviceID: fromUser.DeviceID, Name: fromUser.DeviceID, PWD: _sysinfo.AutoRegister.PWD}
+		err = nil
+	}
+	// nonce过期时返回stale=true，设备使用新nonce重新计算即可，不需要重新输入密码
+	var stale bool
 	// 判断是否存在授权字段
 	if hdrs := req.GetHeaders("Authorization"); len(hdrs) > 0 {
-		fromUser, ok := parserDevicesFromReqeust(req)
-		if !ok {
-			return
-		}
-		user := Devices{DeviceID: fromUser.DeviceID}
-		if err := db.Get(db.DBClient, &user); err == nil {
+		if err == nil {
 			if !user.Regist {
 				// 如果数据库里用户未激活，替换user数据
 				fromUser.ID = user.ID
 				fromUser.Name = user.Name
 				fromUser.PWD = user.PWD
+				fromUser.Algorithm = user.Algorithm
 				user = fromUser
 			}
 			user.addr = fromUser.addr
@@ -98,27 +142,99 @@ func handlerRegister(req *sip.Request, tx *sip.Transaction) {
 			auth.SetUsername(user.DeviceID)
 			auth.SetMethod(string(req.Method()))
 			auth.SetURI(auth.Get("uri"))
-			if auth.CalcResponse() == auth.Get("response") {
-				// 验证成功
-				// 记录活跃设备
-				user.source = fromUser.source
-				user.addr = fromUser.addr
-				_activeDevices.Store(user.DeviceID, user)
-				if !user.Regist {
-					// 第一次激活，保存数据库
-					user.Regist = true
-					db.DBClient.Save(&user)
-					logrus.Infoln("new user regist,id:", user.DeviceID)
+			// 只接受为设备配置的算法，防止降级到MD5
+			if sip.AlgorithmEqual(auth.Get("algorithm"), user.Algorithm) && auth.CalcResponse() == auth.Get("response") {
+				// 密码正确后校验nonce，只接受下发给该设备且未过期、未重放的nonce
+				nerr := _nonces.Check(nonceKey(user.DeviceID, ip), auth.Get("nonce"), auth.Get("nc"))
+				if nerr == nil {
+					// 验证成功，nonce校验通过后才清除失败计数，防止重放的Authorization清除计数
+					_registerBans.succeed(user.DeviceID)
+					expires := registerExpires(req)
+					if expires == 0 {
+						// Expires为0表示注销
+						tx.Respond(registerResponse(req, 0))
+						// 设备主动注销时仍在线，通过会话发送BYE关闭推流
+						user.source = fromUser.source
+						sipUnregister(user, "unregister", true)
+						return
+					}
+					// 记录活跃设备
+					user.source = fromUser.source
+					user.addr = fromUser.addr
+					user.Expires = time.Now().Unix() + expires
+					if user.Status != m.DeviceStatusON {
+						go notify(notifyDevicesAcitve(user.DeviceID, m.DeviceStatusON))
+					}
+					user.Status = m.DeviceStatusON
+					user.ActiveAt = time.Now().Unix()
+					if user.TransPort != fromUser.TransPort {
+						// 记录设备使用的传输协议，后续请求使用相同协议发送
+						user.TransPort = fromUser.TransPort
+					}
+					db.UpdateAll(db.DBClient, new(Devices), db.M{"deviceid=?": user.DeviceID}, Devices{TransPort: user.TransPort, Expires: user.Expires, Status: user.Status, ActiveAt: user.ActiveAt})
+					_activeDevices.Store(user.DeviceID, user)
+					if !user.Regist {
+						// 第一次激活，保存数据库
+						user.Regist = true
+						db.DBClient.Save(&user)
+						logrus.Infoln("new user regist,id:", user.DeviceID)
+					}
+					tx.Respond(registerResponse(req, expires))
+					// 注册成功后查询设备信息，获取制作厂商等信息
+					go notify(notifyDevicesRegister(user))
+					go sipDeviceInfo(fromUser)
+					// 重新注册后设备可能已丢失订阅，重新同步目录并订阅
+					deleteSubscriptions(user.DeviceID)
+					go checkSubscriptions(user)
+					return
+				}
+				logrus.Warnln("register nonce check failed,", user.DeviceID, nerr)
+				stale = nerr == sip.ErrNonceStale
+				// 过期的nonce只需要重新认证，未知或重放的nonce按认证失败计数
+				if !stale && registerAuthFailed(req, tx, user.DeviceID, ip) {
+					return
 				}
-				tx.Respond(sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
-				// 注册成功后查询设备信息，获取制作厂商等信息
-				go notify(notifyDevicesRegister(user))
-				go sipDeviceInfo(fromUser)
+			} else if registerAuthFailed(req, tx, user.DeviceID, ip) {
 				return
 			}
+		} else if db.RecordNotFound(err) && registerAuthFailed(req, tx, fromUser.DeviceID, ip) {
+			return
 		}
 	}
+	algorithm := sip.AlgorithmMD5
+	if err == nil && user.Algorithm != "" {
+		algorithm = user.Algorithm
+	}
+	// 只为已创建或允许自动注册的设备记录nonce，未知设备的注册请求不占用nonce存储
+	// nonce按设备和来源ip保存，其他来源的注册请求不会使设备正在使用的nonce失效
+	nonce := utils.RandString(32)
+	if err == nil {
+		nonce = _nonces.New(nonceKey(fromUser.DeviceID, ip))
+	}
+	challenge := fmt.Sprintf("Digest nonce=\"%s\", algorithm=%s, realm=\"%s\",qop=\"auth\"", nonce, algorithm, _sysinfo.Region)
+	if stale {
+		challenge += ",stale=true"
+	}
 	resp := sip.NewResponseFromRequest("", req, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized), nil)
-	resp.AppendHeader(&sip.GenericHeader{HeaderName: "WWW-Authenticate", Contents: fmt.Sprintf("Digest nonce=\"%s\", algorithm=MD5, realm=\"%s\",qop=\"auth\"", utils.RandString(32), _sysinfo.Region)})
+	resp.AppendHeader(&sip.GenericHeader{HeaderName: "WWW-Authenticate", Contents: challenge})
 	tx.Respond(resp)
 }
+
+// nonceKey nonce所属的设备和来源ip，不使用端口，tcp重连后端口会变化
+func nonceKey(deviceID string, ip net.IP) string {
+	if ip == nil {
+		return deviceID
+	}
+	return deviceID + "@" + ip.String()
+}
+
+// registerAuthFailed 记录注册认证失败，达到次数上限时返回403并返回true
+func registerAuthFailed(req *sip.Request, tx *sip.Transaction, deviceID string, ip net.IP) bool {
+	logrus.Warnln("register auth failed,", deviceID, ip)
+	if !_registerBans.fail(deviceID, ip) {
+		return false
+	}
+	logrus.Warnln("register auth locked,", deviceID, ip)
+	tx.Respond(sip.NewResponseFromRequest("", req, http.StatusForbidden, http.StatusText(http.StatusForbidden), nil))
+	return true
+}
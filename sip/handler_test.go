@@ -0,0 +1,29 @@
+package sipapi
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	sip "github.com/panjjo/gosip/sip/s"
+)
+
+func TestNonceKeyPerSource(t *testing.T) {
+	nonces := sip.NewNonces(time.Minute)
+	device := net.ParseIP("192.168.1.64")
+	other := net.ParseIP("10.0.0.8")
+	nonce := nonces.New(nonceKey("34020000001320000001", device))
+	// 其他来源使用相同设备id请求注册，不影响设备正在使用的nonce
+	nonces.New(nonceKey("34020000001320000001", other))
+	nonces.New(nonceKey("34020000001320000001", other))
+	if err := nonces.Check(nonceKey("34020000001320000001", device), nonce, "00000001"); err != nil {
+		t.Fatalf("device nonce invalidated: %v", err)
+	}
+	// nonce不能在其他来源使用
+	if err := nonces.Check(nonceKey("34020000001320000001", other), nonce, "00000002"); err != sip.ErrNonceUnknown {
+		t.Fatalf("nonce used from other source, err %v", err)
+	}
+	if nonceKey("34020000001320000001", nil) != "34020000001320000001" {
+		t.Fatal("nonce key without source ip")
+	}
+}
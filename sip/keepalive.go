@@ -1,13 +1,24 @@
 package sipapi
 
 import (
+	"errors"
 	"time"
 
 	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
 	"github.com/panjjo/gosip/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// 默认心跳间隔和超时次数 GB/T 28181 9.6
+const (
+	defaultKeepaliveInterval = 60
+	defaultKeepaliveTimeout  = 3
+)
+
+// errKeepaliveUnregistered 设备未注册或注册已失效，需要设备重新注册
+var errKeepaliveUnregistered = errors.New("device not registered")
+
 // MessageNotify 心跳包xml结构
 type MessageNotify struct {
 	CmdType  string `xml:"CmdType"`
@@ -24,29 +35,116 @@ func sipMessageKeepalive(u Devices, body []byte) error {
 		logrus.Errorln("Message Unmarshal xml err:", err, "body:", string(body))
 		return err
 	}
-	device, ok := _activeDevices.Get(u.DeviceID)
-	if !ok {
-		device = Devices{DeviceID: u.DeviceID}
-		if err := db.Get(db.DBClient, &device); err != nil {
-			logrus.Warnln("Device Keepalive not found ", u.DeviceID, err)
-		}
+	device := Devices{DeviceID: u.DeviceID}
+	if err := db.Get(db.DBClient, &device); err != nil {
+		logrus.Warnln("Device Keepalive not found ", u.DeviceID, err)
+		return errKeepaliveUnregistered
 	}
-	if message.Status == "OK" {
-		device.ActiveAt = time.Now().Unix()
+	if !device.keepaliveRegistered(time.Now().Unix()) {
+		// 已注销或注册过期，不能通过心跳恢复在线
+		logrus.Infoln("Device Keepalive without register ", u.DeviceID, device.Expires)
+		return errKeepaliveUnregistered
+	}
+	status := m.DeviceStatusON
+	if message.Status != "OK" {
+		status = m.DeviceStatusOFF
+	}
+	if status == m.DeviceStatusON {
+		// 保留注册过期时间，过期后仍由注册清理下线
+		u.Expires = device.Expires
+		u.PositionInterval = device.PositionInterval
 		_activeDevices.Store(u.DeviceID, u)
 	} else {
-		device.ActiveAt = -1
 		_activeDevices.Delete(u.DeviceID)
+		channelsOffline(u.DeviceID)
+	}
+	if device.Status != status {
+		go notify(notifyDevicesAcitve(u.DeviceID, status))
 	}
-	go notify(notifyDevicesAcitve(u.DeviceID, message.Status))
 	_, err := db.UpdateAll(db.DBClient, new(Devices), map[string]interface{}{"deviceid=?": u.DeviceID}, Devices{
-		Host:     u.Host,
-		Port:     u.Port,
-		Rport:    u.Rport,
-		RAddr:    u.RAddr,
-		Source:   u.Source,
-		URIStr:   u.URIStr,
-		ActiveAt: device.ActiveAt,
+		Host:      u.Host,
+		Port:      u.Port,
+		Rport:     u.Rport,
+		RAddr:     u.RAddr,
+		Source:    u.Source,
+		TransPort: u.TransPort,
+		URIStr:    u.URIStr,
+		ActiveAt:  time.Now().Unix(),
+		Status:    status,
 	})
 	return err
 }
+
+// keepaliveDeadline 设备最后心跳时间加上允许的超时时长，超过后设备离线
+func (d Devices) keepaliveDeadline() int64 {
+	interval, timeout := d.KeepaliveInterval, d.KeepaliveTimeout
+	if interval <= 0 {
+		interval = defaultKeepaliveInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultKeepaliveTimeout
+	}
+	return d.ActiveAt + int64(interval*timeout)
+}
+
+// keepaliveRegistered 设备注册是否有效，有效时才接受心跳。
+// 旧版本注册的设备没有记录过期时间(Expires为0)，按已注册处理，离线由心跳超时判断
+func (d Devices) keepaliveRegistered(now int64) bool {
+	return d.Expires == 0 || d.Expires > now
+}
+
+// deviceOffline 设备离线，设备及其所有通道状态置为OFF，ActiveAt保留为最后活跃时间
+func deviceOffline(deviceID string) {
+	_activeDevices.Delete(deviceID)
+	deleteSubscriptions(deviceID)
+	db.UpdateAll(db.DBClient, new(Devices), db.M{"deviceid=?": deviceID}, Devices{Status: m.DeviceStatusOFF})
+	channelsOffline(deviceID)
+	go notify(notifyDevicesAcitve(deviceID, m.DeviceStatusOFF))
+}
+
+// channelsOffline 设备的在线通道全部置为离线
+func channelsOffline(deviceID string) {
+	channels := []Channels{}
+	var skip int
+	for {
+		list := []Channels{}
+		db.FindT(db.DBClient, new(Channels), &list, db.M{"deviceid=?": deviceID, "status=?": m.DeviceStatusON}, "", skip, 100, false)
+		channels = append(channels, list...)
+		if len(list) < 100 {
+			break
+		}
+		skip += 100
+	}
+	if len(channels) == 0 {
+		return
+	}
+	db.UpdateAll(db.DBClient, new(Channels), db.M{"deviceid=?": deviceID, "status=?": m.DeviceStatusON}, Channels{Status: m.DeviceStatusOFF})
+	for _, channel := range channels {
+		channel.Status = m.DeviceStatusOFF
+		go notify(notifyChannelsActive(channel))
+	}
+}
+
+// CheckKeepalive 定时检查设备心跳，连续多个心跳周期未收到心跳的设备离线
+func CheckKeepalive() {
+	now := time.Now().Unix()
+	timeouts := []Devices{}
+	var skip int
+	for {
+		devices := []Devices{}
+		db.FindT(db.DBClient, new(Devices), &devices, db.M{"status=?": m.DeviceStatusON}, "", skip, 100, false)
+		for _, device := range devices {
+			if device.keepaliveDeadline() < now {
+				timeouts = append(timeouts, device)
+			}
+		}
+		if len(devices) < 100 {
+			break
+		}
+		skip += 100
+	}
+	for _, device := range timeouts {
+		logrus.Infoln("device keepalive timeout,id:", device.DeviceID, "active:", device.ActiveAt)
+		deviceOffline(device.DeviceID)
+	}
+}
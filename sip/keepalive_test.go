@@ -0,0 +1,52 @@
+package sipapi
+
+import "testing"
+
+func TestKeepaliveRegistered(t *testing.T) {
+	now := int64(1700000000)
+	cases := []struct {
+		expires int64
+		want    bool
+	}{
+		{now + 60, true},
+		// 注册过期或已注销
+		{now, false},
+		{now - 60, false},
+		// 旧版本设备未记录过期时间
+		{0, true},
+	}
+	for _, c := range cases {
+		if got := (Devices{Expires: c.expires}).keepaliveRegistered(now); got != c.want {
+			t.Errorf("expires %d: %v, want %v", c.expires, got, c.want)
+		}
+	}
+}
+
+func TestKeepaliveDeadline(t *testing.T) {
+	active := int64(1700000000)
+	cases := []struct {
+		name              string
+		interval, timeout int
+		want              int64
+	}{
+		// 未配置时使用默认60秒间隔、3次超时
+		{"default", 0, 0, active + 180},
+		{"interval", 30, 0, active + 90},
+		{"timeout", 0, 5, active + 300},
+		{"device", 10, 2, active + 20},
+		{"negative", -1, -1, active + 180},
+	}
+	for _, c := range cases {
+		d := Devices{ActiveAt: active, KeepaliveInterval: c.interval, KeepaliveTimeout: c.timeout}
+		if got := d.keepaliveDeadline(); got != c.want {
+			t.Errorf("%s: deadline %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestKeepaliveInvalidBody(t *testing.T) {
+	// xml解析失败时不查询设备
+	if err := sipMessageKeepalive(Devices{DeviceID: "34020000001320000001"}, []byte("<Notify>")); err == nil || err == errKeepaliveUnregistered {
+		t.Fatalf("err %v, want xml error", err)
+	}
+}
@@ -17,8 +17,14 @@ const (
 	NotifyMethodDevicesRegister = "devices.regiester"
 	// NotifyMethodDeviceActive 通道活跃通知
 	NotifyMethodChannelsActive = "channels.active"
+	// NotifyMethodChannelsAdd 设备目录新增通道通知
+	NotifyMethodChannelsAdd = "channels.add"
+	// NotifyMethodChannelsRemove 设备目录删除通道通知
+	NotifyMethodChannelsRemove = "channels.remove"
 	// NotifyMethodRecordStop 视频录制结束
 	NotifyMethodRecordStop = "records.stop"
+	// NotifyMethodAlarmsNew 设备报警通知
+	NotifyMethodAlarmsNew = "alarms.new"
 )
 
 // Notify 消息通知结构
@@ -77,6 +83,27 @@ func notifyChannelsActive(d Channels) *Notify {
 	}
 }
 
+// 设备目录新增通道通知
+func notifyChannelsAdd(d Channels) *Notify {
+	return &Notify{
+		Method: NotifyMethodChannelsAdd,
+		Data:   d,
+	}
+}
+
+// 设备目录删除通道通知，通道已置为离线
+func notifyChannelsRemove(d Channels) *Notify {
+	return &Notify{
+		Method: NotifyMethodChannelsRemove,
+		Data: map[string]interface{}{
+			"channelid": d.ChannelID,
+			"deviceid":  d.DeviceID,
+			"status":    d.Status,
+			"time":      time.Now().Unix(),
+		},
+	}
+}
+
 // 录像停止告警信息
 func notifyRecordStop(url string, req url.Values) *Notify {
 	d := map[string]interface{}{
@@ -90,3 +117,11 @@ func notifyRecordStop(url string, req url.Values) *Notify {
 		Data:   d,
 	}
 }
+
+// 设备报警通知
+func notifyAlarmsNew(a Alarms) *Notify {
+	return &Notify{
+		Method: NotifyMethodAlarmsNew,
+		Data:   a,
+	}
+}
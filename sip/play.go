@@ -1,6 +1,7 @@
 package sipapi
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -14,8 +15,8 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// sip 请求播放
-func SipPlay(data *Streams) (*Streams, error) {
+// sip 请求播放，ctx取消时未完成的INVITE会被CANCEL
+func SipPlay(ctx context.Context, data *Streams) (*Streams, error) {
 
 	channel := Channels{ChannelID: data.ChannelID}
 	if err := db.Get(db.DBClient, &channel); err != nil {
@@ -33,8 +34,8 @@ func SipPlay(data *Streams) (*Streams, error) {
 		// 拉流
 
 	default:
-		// 推流模式要求设备在线且活跃
-		if time.Now().Unix()-channel.Active > 30*60 || channel.Status != m.DeviceStatusON {
+		// 推流模式要求设备在线且活跃，通道状态由心跳超时检测维护
+		if channel.Status != m.DeviceStatusON {
 			return nil, errors.New("通道已离线")
 		}
 		user, ok := _activeDevices.Get(channel.DeviceID)
@@ -53,7 +54,7 @@ func SipPlay(data *Streams) (*Streams, error) {
 		}
 
 		var err error
-		data, err = sipPlayPush(data, channel, user)
+		data, err = sipPlayPush(ctx, data, channel, user)
 		if err != nil {
 			return nil, fmt.Errorf("获取视频失败:%v", err)
 		}
@@ -70,6 +71,11 @@ func SipPlay(data *Streams) (*Streams, error) {
 		StreamList.Succ.Store(data.ChannelID, data)
 	}
 	db.Save(db.DBClient, data)
+	if _, ok := StreamList.Pending.LoadAndDelete(data.StreamID); !ok && data.StreamType == m.StreamTypePush {
+		// 播放完成前已请求停止，停止时流尚未保存，在此关闭会话
+		SipStopPlay(data.StreamID)
+		return nil, errors.New("获取视频失败:播放已停止")
+	}
 	return data, nil
 }
 
@@ -134,8 +140,8 @@ func sipCasPlayPush(data playParams, device DeviceItem, user Devices) (playParam
 	// defining message
 	msg := &sdp.Message{
 		Origin: sdp.Origin{
-			Username: _serverDevices.DeviceID,           // SIP服务器id
-			Address:  string(_sysinfo.MediaServerRtpIP), //ip,
+			Username: _serverDevices.DeviceID,            // SIP服务器id
+			Address:  _sysinfo.MediaServerRtpIP.String(), //ip,
 		},
 		Name: name,
 		Connection: sdp.ConnectionData{
@@ -157,9 +163,12 @@ func sipCasPlayPush(data playParams, device DeviceItem, user Devices) (playParam
 	b = s.AppendTo(b)
 	deviceURI, _ := sip.ParseURI(device.URIStr) // 通道地址
 	device.addr = &sip.Address{URI: deviceURI}
-	_serverDevices.addr.Params.Add("tag", sip.String{Str: utils.RandString(10)})
-	hb := sip.NewHeaderBuilder().SetTo(device.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
-		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	// 每个会话使用独立的from tag
+	from := _serverDevices.addr.Clone()
+	from.Params.Add("tag", sip.String{Str: utils.RandString(10)})
+	hb := sip.NewHeaderBuilder().SetTo(device.addr).SetFrom(from).AddVia(&sip.ViaHop{
+		Transport: user.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 	}).SetContentType(&sip.ContentTypeSDP).SetMethod(sip.INVITE).SetContact(_serverDevices.addr)
 	req := sip.NewRequest("", sip.INVITE, user.addr.URI, sip.DefaultSipVersion, hb.Build(), b)
 
@@ -181,16 +190,17 @@ func sipCasPlayPush(data playParams, device DeviceItem, user Devices) (playParam
 	}
 	data.Resp = response
 	logrus.Infof("invite resp:\n%s\n", response.String())
+	data.Dialog, err = sip.NewDialogFromResponse(req, response)
+	if err != nil {
+		logrus.Errorf("sipPlayPush dialog failed, channel id=%s, err=%s", device.DeviceID, err)
+		return data, err
+	}
 
 	// ACK
-	ackReq := sip.NewRequestFromResponse(sip.ACK, response)
-	ackReq.AppendHeader(&sip.GenericHeader{HeaderName: "User-Agent", Contents: USERAGENT})
-	ackReq.AppendHeader(&sip.GenericHeader{HeaderName: "Max-Forwards", Contents: "70"})
-	ackReq.AppendHeader(&sip.GenericHeader{HeaderName: "Content-Length", Contents: "0"})
-	resTo, _ := response.To()
-	ackReq.SetRecipient(resTo.Address)
-	err = tx.Request(ackReq)
-	// err = tx.Request(sip.NewRequestFromResponse(sip.ACK, response))
+	ackReq, err := data.Dialog.NewAck()
+	if err == nil {
+		err = tx.Request(ackReq)
+	}
 	if err != nil {
 		logrus.Errorf("sipPlayPush ack failed, channel id=%s, err=%s", device.DeviceID, err)
 		return data, err
@@ -202,36 +212,11 @@ func sipCasPlayPush(data playParams, device DeviceItem, user Devices) (playParam
 		data.SSRC = "0" + data.SSRC
 	}
 	data.streamType = m.StreamTypePush
-	from, _ := response.From()
-	to, _ := response.To()
-	//callid, _ := response.CallID()
-	toParams := map[string]string{}
-	for k, v := range to.Params.Items() {
-		toParams[k] = v.String()
-	}
-	fromParams := map[string]string{}
-	for k, v := range from.Params.Items() {
-		fromParams[k] = v.String()
-	}
-	// 成功后保存mongo，用来后续系统关闭推流使用
-	//dbClient.Insert(streamTB, DeviceStream{
-	//	T:          data.T,
-	//	SSRC:       data.SSRC,
-	//	DeviceID:   data.DeviceID, // 通道ID
-	//	UserID:     data.UserID,   // 设备ID
-	//	Status:     0,
-	//	Time:       time.Now().Format("2006-01-02 15:04:05"),
-	//	CallID:     (string)(*callid),
-	//	Ttag:       toParams,
-	//	Ftag:       fromParams,
-	//	StreamName: data.streamName,
-	//	StreamType: streamTypePush, //  pull 媒体服务器主动拉流，push 监控设备主动推流
-	//})
 	return data, err
 }
 
 // 向媒体服务器推流
-func sipPlayPush(data *Streams, channel Channels, device Devices) (*Streams, error) {
+func sipPlayPush(ctx context.Context, data *Streams, channel Channels, device Devices) (*Streams, error) {
 	var (
 		s sdp.Session
 		b []byte
@@ -292,52 +277,77 @@ func sipPlayPush(data *Streams, channel Channels, device Devices) (*Streams, err
 	b = s.AppendTo(b)
 	uri, _ := sip.ParseURI(channel.URIStr)
 	channel.addr = &sip.Address{URI: uri}
-	_serverDevices.addr.Params.Add("tag", sip.String{Str: utils.RandString(20)})
-	hb := sip.NewHeaderBuilder().SetTo(channel.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
-		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	// 每个会话使用独立的from tag
+	from := _serverDevices.addr.Clone()
+	from.Params.Add("tag", sip.String{Str: utils.RandString(20)})
+	hb := sip.NewHeaderBuilder().SetTo(channel.addr).SetFrom(from).AddVia(&sip.ViaHop{
+		Transport: device.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 	}).SetContentType(&sip.ContentTypeSDP).SetMethod(sip.INVITE).SetContact(_serverDevices.addr)
 	req := sip.NewRequest("", sip.INVITE, channel.addr.URI, sip.DefaultSipVersion, hb.Build(), b)
 	req.SetDestination(device.source)
 	req.AppendHeader(&sip.GenericHeader{HeaderName: "Subject", Contents: fmt.Sprintf("%s:%s,%s:%s", channel.ChannelID, data.StreamID, _serverDevices.DeviceID, data.StreamID)})
 	req.SetRecipient(channel.addr.URI)
+	// 停止播放时取消ctx，INVITE未收到最终响应时发送CANCEL，已建立会话时发送BYE
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	StreamList.Pending.Store(data.StreamID, cancel)
 	tx, err := srv.Request(req)
 	if err != nil {
+		StreamList.Pending.Delete(data.StreamID)
 		logrus.Warningln("sipPlayPush fail.id:", device.DeviceID, channel.ChannelID, "err:", err)
 		return data, err
 	}
 	// response
-	response, err := sipResponse(tx)
+	response, err := sipInviteResponse(ctx, tx)
 	if err != nil {
+		StreamList.Pending.Delete(data.StreamID)
 		logrus.Warningln("sipPlayPush response fail.id:", device.DeviceID, channel.ChannelID, "err:", err)
 		return data, err
 	}
-	data.Resp = response
-	// ACK
-	tx.Request(sip.NewRequestFromResponse(sip.ACK, response))
-
-	callid, _ := response.CallID()
-	data.CallID = string(*callid)
-
-	cseq, _ := response.CSeq()
-	if cseq != nil {
-		data.CseqNo = cseq.SeqNo
+	data.Dialog, err = sip.NewDialogFromResponse(req, response)
+	if err != nil {
+		StreamList.Pending.Delete(data.StreamID)
+		logrus.Warningln("sipPlayPush dialog fail.id:", device.DeviceID, channel.ChannelID, "err:", err)
+		return data, err
 	}
-
-	from, _ := response.From()
-	to, _ := response.To()
-	for k, v := range to.Params.Items() {
-		data.Ttag[k] = v.String()
+	data.CallID = data.Dialog.CallID
+	// ACK
+	if ack, err := data.Dialog.NewAck(); err == nil {
+		tx.Request(ack)
 	}
-	for k, v := range from.Params.Items() {
-		data.Ftag[k] = v.String()
+	if ctx.Err() != nil {
+		// 未收到临时响应时CANCEL不会发出，或CANCEL与200 OK交错，会话已建立，需要BYE关闭
+		StreamList.Pending.Delete(data.StreamID)
+		sipPlayBye(data, device)
+		return data, fmt.Errorf("play cancelled: %w", ctx.Err())
 	}
 	data.Status = 0
 
 	return data, err
 }
 
+// sipPlayBye 关闭已建立的推流会话
+func sipPlayBye(play *Streams, device Devices) error {
+	req, err := play.Dialog.NewRequest(sip.BYE)
+	if err != nil {
+		return err
+	}
+	req.SetDestination(device.source)
+	tx, err := srv.Request(req)
+	if err != nil {
+		return err
+	}
+	_, err = sipResponse(tx)
+	return err
+}
+
 // sip 停止播放
 func SipStopPlay(ssrc string) {
+	if cancel, ok := StreamList.Pending.LoadAndDelete(ssrc); ok {
+		// 播放尚未完成，INVITE未收到最终响应时发送CANCEL，已收到2xx时由播放流程发送BYE
+		cancel.(context.CancelFunc)()
+	}
 	zlmCloseStream(ssrc)
 	data, ok := StreamList.Response.Load(ssrc)
 	if !ok {
@@ -346,21 +356,12 @@ func SipStopPlay(ssrc string) {
 	play := data.(*Streams)
 	if play.StreamType == m.StreamTypePush {
 		// 推流，需要发送关闭请求
-		resp := play.Resp
 		u, ok := _activeDevices.Load(play.DeviceID)
-		if !ok {
+		if !ok || play.Dialog == nil {
 			return
 		}
-		user := u.(Devices)
-		req := sip.NewRequestFromResponse(sip.BYE, resp)
-		req.SetDestination(user.source)
-		tx, err := srv.Request(req)
-		if err != nil {
+		if err := sipPlayBye(play, u.(Devices)); err != nil {
 			logrus.Warningln("sipStopPlay bye fail.id:", play.DeviceID, play.ChannelID, "err:", err)
-		}
-		_, err = sipResponse(tx)
-		if err != nil {
-			logrus.Warnln("sipStopPlay response fail", err)
 			play.Msg = err.Error()
 		} else {
 			play.Status = 1
@@ -393,7 +394,7 @@ func sipPlay(data playParams) (interface{}, error) {
 		return nil, err
 	}
 
-	if time.Now().Unix()-device.Active > 30*60 {
+	if device.Status != m.DeviceStatusON {
 		return nil, errors.New("相机已离线")
 	}
 	user, ok := _activeDevices.Get(device.PDID)
@@ -440,7 +441,6 @@ func sipPlay(data playParams) (interface{}, error) {
 
 // sip 历史视频播放请求
 func sipPlayback(did, ssrc, body string) (string, error) {
-	device := DeviceItem{}
 	//err := dbClient.Get(deviceTB, M{"deviceid": did}, &device)
 	err := db.GetQ(db.DBClient, new(Devices), db.M{"deviceid": did}, nil)
 	if err != nil {
@@ -454,12 +454,14 @@ func sipPlayback(did, ssrc, body string) (string, error) {
 	}
 	play := d.(playParams)
 
-	req := sip.NewRequestFromResponse(sip.INFO, play.Resp)
-	deviceURI, _ := sip.ParseURI(device.URIStr) // 通道地址
-	req.SetRecipient(deviceURI)
-	req.AppendHeader(&sip.GenericHeader{HeaderName: "Max-Forwards", Contents: "70"})
+	if play.Dialog == nil {
+		return "", errors.New("invite dialog is not exist")
+	}
+	req, err := play.Dialog.NewRequest(sip.INFO)
+	if err != nil {
+		return "", err
+	}
 	req.AppendHeader(&sip.GenericHeader{HeaderName: "Content-Type", Contents: string(sip.ContentTypeRtsp)})
-	req.AppendHeader(&sip.GenericHeader{HeaderName: "User-Agent", Contents: USERAGENT})
 	req.SetBody([]byte(body), true)
 
 	tx, err := srv.Request(req)
@@ -0,0 +1,129 @@
+package sipapi
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Positions 移动设备位置记录
+type Positions struct {
+	db.DBModel
+	// ChannelID 上报位置的通道编号
+	ChannelID string `json:"channelid" gorm:"column:channelid"`
+	// DeviceID 通道所属设备编号
+	DeviceID string `json:"deviceid" gorm:"column:deviceid"`
+	// Longitude 经度
+	Longitude float64 `json:"longitude" gorm:"column:longitude"`
+	// Latitude 纬度
+	Latitude float64 `json:"latitude" gorm:"column:latitude"`
+	// Speed 速度，单位km/h
+	Speed float64 `json:"speed" gorm:"column:speed"`
+	// Direction 方向，正北方向顺时针夹角 0-360
+	Direction float64 `json:"direction" gorm:"column:direction"`
+	// Altitude 海拔高度，单位m
+	Altitude float64 `json:"altitude" gorm:"column:altitude"`
+	// Time 定位时间
+	Time int64 `json:"time" gorm:"column:positiontime"`
+}
+
+// MobilePosition 通道最新位置
+type MobilePosition struct {
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+	Speed     float64 `json:"speed"`
+	Direction float64 `json:"direction"`
+	Altitude  float64 `json:"altitude"`
+	Time      int64   `json:"time"`
+}
+
+func (p MobilePosition) Value() (driver.Value, error) {
+	return string(utils.JSONEncode(&p)), nil
+}
+
+func (p *MobilePosition) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		if len(v) == 0 {
+			return nil
+		}
+		return utils.JSONDecode(v, p)
+	case string:
+		if v == "" {
+			return nil
+		}
+		return utils.JSONDecode([]byte(v), p)
+	case nil:
+		return nil
+	}
+	return errors.New(fmt.Sprint("Failed to unmarshal MobilePosition value:", value))
+}
+
+// MessageMobilePosition 移动设备位置通知xml结构
+type MessageMobilePosition struct {
+	CmdType   string `xml:"CmdType"`
+	SN        int    `xml:"SN"`
+	DeviceID  string `xml:"DeviceID"`
+	Time      string `xml:"Time"`
+	Longitude string `xml:"Longitude"`
+	Latitude  string `xml:"Latitude"`
+	Speed     string `xml:"Speed"`
+	Direction string `xml:"Direction"`
+	Altitude  string `xml:"Altitude"`
+}
+
+// position 转换为设备deviceID上报的位置记录，没有定位时间时使用当前时间
+func (message MessageMobilePosition) position(deviceID string) (Positions, error) {
+	position := Positions{ChannelID: message.DeviceID, DeviceID: deviceID}
+	var err error
+	if position.Longitude, err = strconv.ParseFloat(message.Longitude, 64); err != nil {
+		return position, errors.New("mobileposition longitude error")
+	}
+	if position.Latitude, err = strconv.ParseFloat(message.Latitude, 64); err != nil {
+		return position, errors.New("mobileposition latitude error")
+	}
+	position.Speed, _ = strconv.ParseFloat(message.Speed, 64)
+	position.Direction, _ = strconv.ParseFloat(message.Direction, 64)
+	position.Altitude, _ = strconv.ParseFloat(message.Altitude, 64)
+	position.Time = time.Now().Unix()
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", message.Time, time.Local); err == nil {
+		position.Time = t.Unix()
+	}
+	return position, nil
+}
+
+// 取得设备发来的移动位置，保存轨迹并更新通道最新位置
+func sipMessageMobilePosition(u Devices, body []byte) error {
+	if _, ok := _activeDevices.Get(u.DeviceID); !ok {
+		logrus.Warnln("mobileposition from inactive device,", u.DeviceID)
+		return errors.New("device not active")
+	}
+	message := &MessageMobilePosition{}
+	if err := utils.XMLDecode(body, message); err != nil {
+		logrus.Errorln("Message Unmarshal xml err:", err, "body:", string(body))
+		return err
+	}
+	position, err := message.position(u.DeviceID)
+	if err != nil {
+		return err
+	}
+	if err := db.Create(db.DBClient, &position); err != nil {
+		logrus.Errorln("save mobileposition error,", err)
+		return err
+	}
+	_, err = db.UpdateAll(db.DBClient, new(Channels), db.M{"channelid=?": position.ChannelID, "deviceid=?": u.DeviceID}, Channels{Position: MobilePosition{
+		Longitude: position.Longitude,
+		Latitude:  position.Latitude,
+		Speed:     position.Speed,
+		Direction: position.Direction,
+		Altitude:  position.Altitude,
+		Time:      position.Time,
+	}})
+	return err
+}
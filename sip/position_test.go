@@ -0,0 +1,59 @@
+package sipapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/panjjo/gosip/utils"
+)
+
+func TestMobilePositionMessage(t *testing.T) {
+	body := []byte(`<?xml version="1.0"?><Notify><CmdType>MobilePosition</CmdType><SN>5</SN><DeviceID>34020000001320000001</DeviceID><Time>2023-06-01T08:30:00</Time><Longitude>116.397</Longitude><Latitude>39.909</Latitude><Speed>36.5</Speed><Direction>90</Direction><Altitude>50</Altitude></Notify>`)
+	message := MessageMobilePosition{}
+	if err := utils.XMLDecode(body, &message); err != nil {
+		t.Fatal(err)
+	}
+	position, err := message.position("34020000001110000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := time.ParseInLocation("2006-01-02T15:04:05", "2023-06-01T08:30:00", time.Local)
+	if position.ChannelID != "34020000001320000001" || position.DeviceID != "34020000001110000001" ||
+		position.Longitude != 116.397 || position.Latitude != 39.909 || position.Speed != 36.5 ||
+		position.Direction != 90 || position.Altitude != 50 || position.Time != want.Unix() {
+		t.Fatalf("position %+v", position)
+	}
+
+	// 没有定位时间使用当前时间
+	message.Time = ""
+	if position, _ := message.position("34020000001110000001"); time.Now().Unix()-position.Time > 1 {
+		t.Fatalf("position time %d", position.Time)
+	}
+	for _, m := range []MessageMobilePosition{{Longitude: "abc", Latitude: "39.9"}, {Longitude: "116.3"}} {
+		if _, err := m.position("34020000001110000001"); err == nil {
+			t.Errorf("%+v: want error", m)
+		}
+	}
+}
+
+func TestMobilePositionValue(t *testing.T) {
+	p := MobilePosition{Longitude: 116.397, Latitude: 39.909, Speed: 10, Time: 1685579400}
+	value, err := p.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := MobilePosition{}
+	if err := restored.Scan(value); err != nil {
+		t.Fatal(err)
+	}
+	if restored != p {
+		t.Fatalf("restored %+v, want %+v", restored, p)
+	}
+	// 没有位置的通道
+	for _, v := range []interface{}{nil, "", []byte{}} {
+		empty := MobilePosition{}
+		if err := empty.Scan(v); err != nil || empty != (MobilePosition{}) {
+			t.Errorf("scan %v: %+v %v", v, empty, err)
+		}
+	}
+}
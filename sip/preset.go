@@ -0,0 +1,194 @@
+package sipapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/panjjo/gosip/db"
+	sip "github.com/panjjo/gosip/sip/s"
+	"github.com/panjjo/gosip/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Presets 预置位名称
+type Presets struct {
+	db.DBModel
+	// ChannelID 通道编码
+	ChannelID string `json:"channelid" gorm:"column:channelid"`
+	// PresetID 预置位号 1-255
+	PresetID int `json:"presetid" gorm:"column:presetid"`
+	// Name 预置位名称
+	Name string `json:"name" gorm:"column:name"`
+}
+
+// MessagePresetResponse 预置位查询返回结构
+type MessagePresetResponse struct {
+	CmdType  string       `xml:"CmdType"`
+	SN       int          `xml:"SN"`
+	DeviceID string       `xml:"DeviceID"`
+	SumNum   int          `xml:"SumNum"`
+	Item     []PresetItem `xml:"PresetList>Item"`
+}
+
+// PresetItem 设备端预置位
+type PresetItem struct {
+	PresetID   string `xml:"PresetID"`
+	PresetName string `xml:"PresetName"`
+}
+
+// 当前查询预置位的通道集合 key=channelid+sn value=*presetQuery
+var _presetList *sync.Map
+
+// presetQuery 一次预置位查询的分包汇总，收齐SumNum条后返回
+type presetQuery struct {
+	items []PresetItem
+	seen  map[string]bool
+	resp  chan []PresetItem
+	l     *sync.Mutex
+}
+
+func newPresetQuery() *presetQuery {
+	return &presetQuery{seen: map[string]bool{}, resp: make(chan []PresetItem, 1), l: &sync.Mutex{}}
+}
+
+// received 记录收到的分包，收齐SumNum条后返回全部预置位，设备未返回SumNum时按单包处理
+func (q *presetQuery) received(message *MessagePresetResponse) {
+	q.l.Lock()
+	defer q.l.Unlock()
+	for _, item := range message.Item {
+		if !q.seen[item.PresetID] {
+			q.seen[item.PresetID] = true
+			q.items = append(q.items, item)
+		}
+	}
+	if len(q.items) < message.SumNum {
+		return
+	}
+	select {
+	case q.resp <- q.items:
+	default:
+	}
+}
+
+// 取得设备发来的预置位列表，可能分多个包返回
+func sipMessagePresetQuery(u Devices, body []byte) error {
+	message := &MessagePresetResponse{}
+	if err := utils.XMLDecode(body, message); err != nil {
+		logrus.Errorln("Message Unmarshal xml err:", err, "body:", string(body))
+		return err
+	}
+	presetKey := fmt.Sprintf("%s%d", message.DeviceID, message.SN)
+	if query, ok := _presetList.Load(presetKey); ok {
+		query.(*presetQuery).received(message)
+		return nil
+	}
+	return errors.New("presetlist channel not found")
+}
+
+// SipPresetList 查询设备上存在的预置位，名称优先使用平台保存的名称
+func SipPresetList(to *Channels) ([]Presets, error) {
+	sn := utils.RandInt(100000, 999999)
+	query := newPresetQuery()
+	device, ok := _activeDevices.Get(to.DeviceID)
+	if !ok {
+		return nil, errors.New("设备不在线")
+	}
+	channelURI, _ := sip.ParseURI(to.URIStr)
+	to.addr = &sip.Address{URI: channelURI}
+	presetKey := fmt.Sprintf("%s%d", to.ChannelID, sn)
+	_presetList.Store(presetKey, query)
+	defer _presetList.Delete(presetKey)
+	hb := sip.NewHeaderBuilder().SetTo(to.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
+		Transport: device.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE)
+	req := sip.NewRequest("", sip.MESSAGE, to.addr.URI, sip.DefaultSipVersion, hb.Build(), sip.GetPresetQueryXML(to.ChannelID, sn))
+	req.SetDestination(device.source)
+	tx, err := srv.Request(req)
+	if err != nil {
+		return nil, err
+	}
+	response, err := tx.GetResponse()
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New(response.Reason())
+	}
+	var items []PresetItem
+	select {
+	case items = <-query.resp:
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("获取数据超时")
+	}
+	saved := []Presets{}
+	db.FindT(db.DBClient, new(Presets), &saved, db.M{"channelid=?": to.ChannelID}, "", 0, 256, false)
+	return mergePresets(to.ChannelID, items, saved), nil
+}
+
+// mergePresets 设备返回的预置位按编号排序，平台保存了名称的使用保存的名称
+func mergePresets(channelID string, items []PresetItem, saved []Presets) []Presets {
+	names := map[int]string{}
+	for _, preset := range saved {
+		names[preset.PresetID] = preset.Name
+	}
+	list := []Presets{}
+	for _, item := range items {
+		id, err := strconv.Atoi(item.PresetID)
+		if err != nil {
+			continue
+		}
+		preset := Presets{ChannelID: channelID, PresetID: id, Name: item.PresetName}
+		if name, ok := names[id]; ok && name != "" {
+			preset.Name = name
+		}
+		list = append(list, preset)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].PresetID < list[j].PresetID })
+	return list
+}
+
+// SipPresetSet 将云台当前位置设置为预置位并保存名称，返回设备的响应码
+func SipPresetSet(to *Channels, presetID int, name string) (int, error) {
+	cmd, err := PresetCmd(PresetSet, presetID)
+	if err != nil {
+		return 0, err
+	}
+	code, err := sipDeviceControl(to, cmd)
+	if err != nil || code != http.StatusOK {
+		return code, err
+	}
+	preset := Presets{}
+	if err := db.GetQ(db.DBClient, &preset, db.M{"channelid=?": to.ChannelID, "presetid=?": presetID}); err != nil && !db.RecordNotFound(err) {
+		return code, err
+	}
+	preset.ChannelID, preset.PresetID, preset.Name = to.ChannelID, presetID, name
+	return code, db.Save(db.DBClient, &preset)
+}
+
+// SipPresetCall 调用预置位，返回设备的响应码
+func SipPresetCall(to *Channels, presetID int) (int, error) {
+	cmd, err := PresetCmd(PresetCall, presetID)
+	if err != nil {
+		return 0, err
+	}
+	return sipDeviceControl(to, cmd)
+}
+
+// SipPresetDelete 删除预置位及保存的名称，返回设备的响应码
+func SipPresetDelete(to *Channels, presetID int) (int, error) {
+	cmd, err := PresetCmd(PresetDel, presetID)
+	if err != nil {
+		return 0, err
+	}
+	code, err := sipDeviceControl(to, cmd)
+	if err != nil || code != http.StatusOK {
+		return code, err
+	}
+	return code, db.DelQ(db.DBClient, new(Presets), db.M{"channelid=?": to.ChannelID, "presetid=?": presetID})
+}
@@ -0,0 +1,86 @@
+package sipapi
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestPresetQueryPackets(t *testing.T) {
+	query := newPresetQuery()
+	query.received(&MessagePresetResponse{SumNum: 3, Item: []PresetItem{{PresetID: "1"}, {PresetID: "2"}}})
+	if len(query.resp) != 0 {
+		t.Fatal("presets returned before SumNum")
+	}
+	// 重复的预置位不计数
+	query.received(&MessagePresetResponse{SumNum: 3, Item: []PresetItem{{PresetID: "2"}}})
+	if len(query.resp) != 0 {
+		t.Fatal("duplicate preset counted")
+	}
+	query.received(&MessagePresetResponse{SumNum: 3, Item: []PresetItem{{PresetID: "3", PresetName: "门口"}}})
+	items := <-query.resp
+	if len(items) != 3 || items[2].PresetName != "门口" {
+		t.Fatalf("presets %+v", items)
+	}
+
+	// 未返回SumNum按单包处理
+	single := newPresetQuery()
+	single.received(&MessagePresetResponse{Item: []PresetItem{{PresetID: "1"}}})
+	if items := <-single.resp; len(items) != 1 {
+		t.Fatalf("presets %+v", items)
+	}
+}
+
+func TestMergePresets(t *testing.T) {
+	items := []PresetItem{{PresetID: "3", PresetName: "preset3"}, {PresetID: "x"}, {PresetID: "1", PresetName: "preset1"}, {PresetID: "2"}}
+	saved := []Presets{{PresetID: 1, Name: "门口"}, {PresetID: 2, Name: ""}, {PresetID: 9, Name: "已删除"}}
+	list := mergePresets("34020000001320000001", items, saved)
+	// 只返回设备上存在的预置位，按编号排序，非数字编号忽略
+	if len(list) != 3 {
+		t.Fatalf("presets %+v", list)
+	}
+	want := []struct {
+		id   int
+		name string
+	}{{1, "门口"}, {2, ""}, {3, "preset3"}}
+	for i, w := range want {
+		if list[i].PresetID != w.id || list[i].Name != w.name || list[i].ChannelID != "34020000001320000001" {
+			t.Errorf("preset %d: %+v, want %d %q", i, list[i], w.id, w.name)
+		}
+	}
+}
+
+func TestSipMessagePresetQuery(t *testing.T) {
+	old := _presetList
+	_presetList = &sync.Map{}
+	defer func() { _presetList = old }()
+	query := newPresetQuery()
+	_presetList.Store("34020000001320000001123456", query)
+
+	body := []byte(`<?xml version="1.0" encoding="GB2312"?>
+<Response>
+<CmdType>PresetQuery</CmdType>
+<SN>123456</SN>
+<DeviceID>34020000001320000001</DeviceID>
+<SumNum>2</SumNum>
+<PresetList Num="2">
+<Item><PresetID>1</PresetID><PresetName>gate</PresetName></Item>
+<Item><PresetID>2</PresetID><PresetName>hall</PresetName></Item>
+</PresetList>
+</Response>`)
+	if err := sipMessagePresetQuery(Devices{}, body); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case items := <-query.resp:
+		if len(items) != 2 || items[1].PresetName != "hall" {
+			t.Fatalf("presets %+v", items)
+		}
+	default:
+		t.Fatal("presets not delivered")
+	}
+	// 没有对应查询的响应返回错误
+	if err := sipMessagePresetQuery(Devices{}, bytes.Replace(body, []byte("123456"), []byte("654321"), 1)); err == nil {
+		t.Fatal("want error for unknown SN")
+	}
+}
@@ -0,0 +1,221 @@
+package sipapi
+
+import (
+	"errors"
+	"fmt"
+
+	sip "github.com/panjjo/gosip/sip/s"
+)
+
+// 云台控制指令 GB/T 28181 附录A.3
+const (
+	PTZStop      = "stop"
+	PTZUp        = "up"
+	PTZDown      = "down"
+	PTZLeft      = "left"
+	PTZRight     = "right"
+	PTZUpLeft    = "upleft"
+	PTZUpRight   = "upright"
+	PTZDownLeft  = "downleft"
+	PTZDownRight = "downright"
+	PTZZoomIn    = "zoomin"
+	PTZZoomOut   = "zoomout"
+	PTZFocusNear = "focusnear"
+	PTZFocusFar  = "focusfar"
+	PTZIrisOpen  = "irisopen"
+	PTZIrisClose = "irisclose"
+)
+
+// 指令码(字节4)：PTZ指令高2位为00，FI指令高4位为0100
+var ptzCodes = map[string]byte{
+	PTZStop:      0x00,
+	PTZRight:     0x01,
+	PTZLeft:      0x02,
+	PTZDown:      0x04,
+	PTZUp:        0x08,
+	PTZDownRight: 0x05,
+	PTZDownLeft:  0x06,
+	PTZUpRight:   0x09,
+	PTZUpLeft:    0x0A,
+	PTZZoomIn:    0x10,
+	PTZZoomOut:   0x20,
+	PTZFocusFar:  0x41,
+	PTZFocusNear: 0x42,
+	PTZIrisOpen:  0x44,
+	PTZIrisClose: 0x48,
+}
+
+// 云台地址，国标中设备由DeviceID区分，地址固定使用1
+const ptzAddress = 1
+
+// PTZControl 云台控制参数
+type PTZControl struct {
+	// Cmd 控制指令
+	Cmd string
+	// Speed 水平、垂直、聚焦、光圈速度 0-255
+	Speed int
+	// ZoomSpeed 变倍速度 0-15
+	ZoomSpeed int
+}
+
+// ptzCmd 生成8字节PTZCmd的16进制字符串
+// 字节1 A5H，字节2 高4位版本号0 低4位为前3个半字节的校验，字节3 地址低8位，字节4 指令码，
+// 字节5、6 数据，字节7 高4位数据 低4位地址高4位，字节8 前7个字节和的低8位
+func ptzCmd(code, data1, data2, data3 byte) string {
+	// 字节2 校验 (0xA+0x5+0x0)%16=0xF
+	cmd := [8]byte{0xA5, 0x0F, byte(ptzAddress & 0xFF), code, data1, data2, data3<<4 | byte(ptzAddress>>8)&0x0F}
+	var sum int
+	for _, b := range cmd[:7] {
+		sum += int(b)
+	}
+	cmd[7] = byte(sum % 0x100)
+	return fmt.Sprintf("%X", cmd[:])
+}
+
+// PTZCmd 生成云台控制的PTZCmd
+func (p PTZControl) PTZCmd() (string, error) {
+	code, ok := ptzCodes[p.Cmd]
+	if !ok {
+		return "", errors.New("不支持的云台指令")
+	}
+	if p.Speed < 0 || p.Speed > 0xFF {
+		return "", errors.New("速度范围0-255")
+	}
+	if p.ZoomSpeed < 0 || p.ZoomSpeed > 0x0F {
+		return "", errors.New("变倍速度范围0-15")
+	}
+	switch {
+	case code == 0x00:
+		return ptzCmd(code, 0, 0, 0), nil
+	case code&0xF0 == 0x40:
+		// 字节5 聚焦速度，字节6 光圈速度
+		return ptzCmd(code, byte(p.Speed), byte(p.Speed), 0), nil
+	default:
+		// 字节5 水平速度，字节6 垂直速度，字节7高4位 变倍速度
+		return ptzCmd(code, byte(p.Speed), byte(p.Speed), byte(p.ZoomSpeed)), nil
+	}
+}
+
+// 预置位指令 GB/T 28181 附录A.3.4
+const (
+	PresetSet  = 0x81
+	PresetCall = 0x82
+	PresetDel  = 0x83
+)
+
+// PresetCmd 生成预置位设置、调用、删除的PTZCmd，字节6为预置位号 1-255
+func PresetCmd(code byte, preset int) (string, error) {
+	if preset < 1 || preset > 0xFF {
+		return "", errors.New("预置位号范围1-255")
+	}
+	return ptzCmd(code, 0, byte(preset), 0), nil
+}
+
+// 巡航、扫描指令 GB/T 28181 附录A.3.5 A.3.6
+const (
+	CruiseAdd       = "add"
+	CruiseDel       = "delete"
+	CruiseSpeed     = "speed"
+	CruiseDwell     = "dwell"
+	CruiseStart     = "start"
+	CruiseStop      = "stop"
+	CruiseScanStart = "scanstart"
+	CruiseScanLeft  = "scanleft"
+	CruiseScanRight = "scanright"
+	CruiseScanSpeed = "scanspeed"
+)
+
+// CruiseControl 巡航、扫描控制参数
+type CruiseControl struct {
+	// Cmd 控制指令
+	Cmd string
+	// Group 巡航组号或扫描组号 0-255
+	Group int
+	// Preset 预置位号，删除巡航点时为0表示删除整条巡航
+	Preset int
+	// Value 巡航速度、停留时间(秒)或扫描速度 0-4095
+	Value int
+}
+
+// PTZCmd 生成巡航、扫描的PTZCmd，字节5为组号
+func (p CruiseControl) PTZCmd() (string, error) {
+	if p.Group < 0 || p.Group > 0xFF {
+		return "", errors.New("组号范围0-255")
+	}
+	group := byte(p.Group)
+	switch p.Cmd {
+	case CruiseAdd, CruiseDel:
+		min := 1
+		if p.Cmd == CruiseDel {
+			min = 0
+		}
+		if p.Preset < min || p.Preset > 0xFF {
+			return "", errors.New("预置位号范围1-255")
+		}
+		code := byte(0x84)
+		if p.Cmd == CruiseDel {
+			code = 0x85
+		}
+		return ptzCmd(code, group, byte(p.Preset), 0), nil
+	case CruiseSpeed, CruiseDwell, CruiseScanSpeed:
+		if p.Value < 0 || p.Value > 0xFFF {
+			return "", errors.New("数值范围0-4095")
+		}
+		code := map[string]byte{CruiseSpeed: 0x86, CruiseDwell: 0x87, CruiseScanSpeed: 0x8A}[p.Cmd]
+		// 字节6 数据低8位，字节7高4位 数据高4位
+		return ptzCmd(code, group, byte(p.Value&0xFF), byte(p.Value>>8)), nil
+	case CruiseStart:
+		return ptzCmd(0x88, group, 0, 0), nil
+	case CruiseScanStart, CruiseScanLeft, CruiseScanRight:
+		// 字节6 00开始扫描，01设置左边界，02设置右边界
+		op := map[string]byte{CruiseScanStart: 0x00, CruiseScanLeft: 0x01, CruiseScanRight: 0x02}[p.Cmd]
+		return ptzCmd(0x89, group, op, 0), nil
+	case CruiseStop:
+		// 停止巡航、扫描使用云台停止指令
+		return ptzCmd(0x00, 0, 0, 0), nil
+	}
+	return "", errors.New("不支持的巡航指令")
+}
+
+// SipPTZ 向通道所属设备发送云台控制指令，返回设备的响应码
+func SipPTZ(to *Channels, ptz PTZControl) (int, error) {
+	cmd, err := ptz.PTZCmd()
+	if err != nil {
+		return 0, err
+	}
+	return sipDeviceControl(to, cmd)
+}
+
+// SipCruise 向通道所属设备发送巡航、扫描控制指令，返回设备的响应码
+func SipCruise(to *Channels, cruise CruiseControl) (int, error) {
+	cmd, err := cruise.PTZCmd()
+	if err != nil {
+		return 0, err
+	}
+	return sipDeviceControl(to, cmd)
+}
+
+// sipDeviceControl 发送DeviceControl消息，返回设备的响应码
+func sipDeviceControl(to *Channels, cmd string) (int, error) {
+	device, ok := _activeDevices.Get(to.DeviceID)
+	if !ok {
+		return 0, errors.New("设备不在线")
+	}
+	channelURI, _ := sip.ParseURI(to.URIStr)
+	to.addr = &sip.Address{URI: channelURI}
+	hb := sip.NewHeaderBuilder().SetTo(to.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
+		Transport: device.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE)
+	req := sip.NewRequest("", sip.MESSAGE, to.addr.URI, sip.DefaultSipVersion, hb.Build(), sip.GetDeviceControlXML(to.ChannelID, cmd))
+	req.SetDestination(device.source)
+	tx, err := srv.Request(req)
+	if err != nil {
+		return 0, err
+	}
+	response, err := tx.GetResponse()
+	if err != nil {
+		return 0, err
+	}
+	return response.StatusCode(), nil
+}
@@ -0,0 +1,81 @@
+package sipapi
+
+import "testing"
+
+func TestPTZCmd(t *testing.T) {
+	cases := []struct {
+		ptz  PTZControl
+		want string
+	}{
+		{PTZControl{Cmd: PTZStop, Speed: 100}, "A50F0100000000B5"},
+		{PTZControl{Cmd: PTZUp, Speed: 0x80}, "A50F0108808000BD"},
+		{PTZControl{Cmd: PTZZoomIn, ZoomSpeed: 15}, "A50F01100000F0B5"},
+		{PTZControl{Cmd: PTZUpLeft, Speed: 255, ZoomSpeed: 15}, "A50F010AFFFFF0AD"},
+		// FI指令不带变倍速度
+		{PTZControl{Cmd: PTZIrisOpen, Speed: 0x20, ZoomSpeed: 15}, "A50F014420200039"},
+	}
+	for _, c := range cases {
+		got, err := c.ptz.PTZCmd()
+		if err != nil {
+			t.Errorf("%s: %v", c.ptz.Cmd, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: %s, want %s", c.ptz.Cmd, got, c.want)
+		}
+	}
+	for _, ptz := range []PTZControl{{Cmd: "unknown"}, {Cmd: PTZUp, Speed: 256}, {Cmd: PTZUp, Speed: -1}, {Cmd: PTZZoomIn, ZoomSpeed: 16}} {
+		if _, err := ptz.PTZCmd(); err == nil {
+			t.Errorf("%+v: want error", ptz)
+		}
+	}
+}
+
+func TestPresetCmd(t *testing.T) {
+	if got, _ := PresetCmd(PresetCall, 3); got != "A50F01820003003A" {
+		t.Errorf("call preset 3: %s", got)
+	}
+	if got, _ := PresetCmd(PresetSet, 255); got != "A50F018100FF0035" {
+		t.Errorf("set preset 255: %s", got)
+	}
+	for _, preset := range []int{0, 256} {
+		if _, err := PresetCmd(PresetDel, preset); err == nil {
+			t.Errorf("preset %d: want error", preset)
+		}
+	}
+}
+
+func TestCruiseCmd(t *testing.T) {
+	cases := []struct {
+		cruise CruiseControl
+		want   string
+	}{
+		{CruiseControl{Cmd: CruiseAdd, Group: 1, Preset: 2}, "A50F01840102003C"},
+		{CruiseControl{Cmd: CruiseDel, Group: 1}, "A50F01850100003B"},
+		{CruiseControl{Cmd: CruiseSpeed, Group: 2, Value: 0x123}, "A50F018602231070"},
+		{CruiseControl{Cmd: CruiseDwell, Group: 2, Value: 4095}, "A50F018702FFF02D"},
+		{CruiseControl{Cmd: CruiseStart, Group: 3}, "A50F018803000040"},
+		{CruiseControl{Cmd: CruiseScanRight}, "A50F018900020040"},
+		{CruiseControl{Cmd: CruiseStop, Group: 3}, "A50F0100000000B5"},
+	}
+	for _, c := range cases {
+		got, err := c.cruise.PTZCmd()
+		if err != nil {
+			t.Errorf("%s: %v", c.cruise.Cmd, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: %s, want %s", c.cruise.Cmd, got, c.want)
+		}
+	}
+	for _, cruise := range []CruiseControl{
+		{Cmd: "unknown"},
+		{Cmd: CruiseAdd, Group: 1},
+		{Cmd: CruiseDel, Group: 256},
+		{Cmd: CruiseDwell, Value: 4096},
+	} {
+		if _, err := cruise.PTZCmd(); err == nil {
+			t.Errorf("%+v: want error", cruise)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
 	"net/http"
 	"sort"
 	"strconv"
@@ -30,7 +31,8 @@ func SipRecordList(to *Channels, start, end int64) (*Records, error) {
 	_recordList.Store(recordKey, recordList{channelid: to.ChannelID, resp: resp, data: [][]int64{}, l: &sync.Mutex{}, s: start, e: end})
 	defer _recordList.Delete(recordKey)
 	hb := sip.NewHeaderBuilder().SetTo(to.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
-		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+		Transport: device.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE)
 	req := sip.NewRequest("", sip.MESSAGE, to.addr.URI, sip.DefaultSipVersion, hb.Build(), sip.GetRecordInfoXML(to.ChannelID, sn, start, end))
 	req.SetDestination(device.source)
@@ -38,7 +40,10 @@ func SipRecordList(to *Channels, start, end int64) (*Records, error) {
 	if err != nil {
 		return nil, err
 	}
-	response := tx.GetResponse()
+	response, err := tx.GetResponse()
+	if err != nil {
+		return nil, err
+	}
 	if response.StatusCode() != http.StatusOK {
 		return nil, errors.New(response.Reason())
 	}
@@ -266,7 +271,7 @@ func sipCasRecordList(u Devices, did, body string) error {
 	if _, err := db.FindT(db.DBClient, new(Devices), &devices, db.M{"deviceid": did}, "", 0, 100, false); err != nil {
 		return err
 	}
-	if time.Now().Unix()-device.Active > 30*60 {
+	if device.Status != m.DeviceStatusON {
 		return errors.New("device is offline")
 	}
 	user := Devices{}
@@ -278,7 +283,8 @@ func sipCasRecordList(u Devices, did, body string) error {
 	_ = parseRecordInfoRequest(body)
 
 	hb := sip.NewHeaderBuilder().SetTo(user.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
-		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+		Transport: user.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
 	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE)
 	req := sip.NewRequest("", sip.MESSAGE, user.addr.URI, sip.DefaultSipVersion, hb.Build(), []byte(body))
 	req.SetDestination(user.source)
@@ -287,10 +293,9 @@ func sipCasRecordList(u Devices, did, body string) error {
 	if err != nil {
 		return err
 	}
-	res := tx.GetResponse()
-	if res == nil {
-		logrus.Errorf("sipCasRecordList response is nil")
-		return errors.New("response is nil")
+	if _, err = tx.GetResponse(); err != nil {
+		logrus.Errorf("sipCasRecordList get response failed, err=%s", err)
+		return err
 	}
 	sendUp = true
 
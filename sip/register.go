@@ -0,0 +1,113 @@
+package sipapi
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/panjjo/gosip/db"
+	sip "github.com/panjjo/gosip/sip/s"
+	"github.com/sirupsen/logrus"
+)
+
+// 设备未携带Expires时使用的注册有效期，单位秒
+const defaultRegisterExpires = 3600
+
+// registerExpires 获取REGISTER请求的有效期，Contact的expires参数优先于Expires头 RFC 3261 10.2.1.1
+func registerExpires(req *sip.Request) int64 {
+	if contact, ok := req.Contact(); ok && contact.Params != nil {
+		if v, ok := contact.Params.Get("expires"); ok && v != nil {
+			if expires, err := strconv.ParseInt(v.String(), 10, 64); err == nil && expires >= 0 {
+				return expires
+			}
+		}
+	}
+	if hdrs := req.GetHeaders("Expires"); len(hdrs) > 0 {
+		if expires, ok := hdrs[0].(*sip.Expires); ok {
+			return int64(*expires)
+		}
+	}
+	return defaultRegisterExpires
+}
+
+// registerResponse 注册成功的响应，返回实际有效期和Date头，设备使用Date校时
+func registerResponse(req *sip.Request, expires int64) *sip.Response {
+	resp := sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil)
+	exp := sip.Expires(expires)
+	resp.AppendHeader(&exp)
+	resp.AppendHeader(&sip.GenericHeader{HeaderName: "Date", Contents: time.Now().Format("2006-01-02T15:04:05.000")})
+	return resp
+}
+
+// sipUnregister 设备注销或注册过期，移出活跃设备并关闭设备的流
+func sipUnregister(user Devices, reason string, bye bool) {
+	logrus.Infoln("device unregister,id:", user.DeviceID, reason)
+	closeDeviceStreams(user, reason, bye)
+	// 过期时间记为注销时间，与旧版本未记录过期时间(0)的设备区分
+	db.UpdateAll(db.DBClient, new(Devices), db.M{"deviceid=?": user.DeviceID}, db.M{"expires": time.Now().Unix()})
+	deviceOffline(user.DeviceID)
+}
+
+// CheckDevices 定时清理注册过期的设备
+func CheckDevices() {
+	now := time.Now().Unix()
+	_activeDevices.Range(func(key, value interface{}) bool {
+		user := value.(Devices)
+		if user.Expires > 0 && user.Expires < now {
+			sipUnregister(user, "register expired", false)
+		}
+		return true
+	})
+}
+
+// validDeviceID 是否合法的国标设备编码：20位数字，类型编码(11-13位)为前端设备111-199或平台200 GB/T 28181 附录D
+func validDeviceID(id string) bool {
+	if len(id) != 20 {
+		return false
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	t, _ := strconv.Atoi(id[10:13])
+	return t >= 111 && t <= 200
+}
+
+// autoRegisterAllowed 未创建的设备是否允许使用域密码自动注册
+func autoRegisterAllowed(user Devices) bool {
+	policy := _sysinfo.AutoRegister
+	if policy.PWD == "" || !validDeviceID(user.DeviceID) {
+		return false
+	}
+	if len(policy.Allow) == 0 {
+		return true
+	}
+	ip := sourceIP(user.source)
+	if ip == nil {
+		return false
+	}
+	for _, allow := range policy.Allow {
+		if _, ipnet, err := net.ParseCIDR(allow); err == nil {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		} else if allowIP := net.ParseIP(allow); allowIP != nil && allowIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceIP 消息来源地址的ip
+func sourceIP(addr net.Addr) net.IP {
+	if addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,104 @@
+package sipapi
+
+import (
+	"net"
+	"testing"
+
+	"github.com/panjjo/gosip/m"
+	sip "github.com/panjjo/gosip/sip/s"
+)
+
+func newRegisterRequest(t *testing.T, contactExpires string, expires *sip.Expires) *sip.Request {
+	t.Helper()
+	uri, err := sip.ParseURI("sip:34020000002000000001@3402000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := sip.NewRequest("", sip.REGISTER, uri, sip.DefaultSipVersion, nil, nil)
+	contact, err := sip.ParseURI("sip:34020000001320000001@192.168.1.64:5060")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := sip.NewParams()
+	if contactExpires != "" {
+		params.Add("expires", sip.String{Str: contactExpires})
+	}
+	req.AppendHeader(&sip.ContactHeader{Address: contact, Params: params})
+	if expires != nil {
+		req.AppendHeader(expires)
+	}
+	return req
+}
+
+func TestRegisterExpires(t *testing.T) {
+	zero, hour := sip.Expires(0), sip.Expires(7200)
+	cases := []struct {
+		name    string
+		contact string
+		expires *sip.Expires
+		want    int64
+	}{
+		{"default", "", nil, defaultRegisterExpires},
+		{"header", "", &hour, 7200},
+		{"unregister", "", &zero, 0},
+		// Contact的expires参数优先
+		{"contact", "600", &hour, 600},
+		{"contact unregister", "0", &hour, 0},
+		{"invalid contact", "abc", &hour, 7200},
+	}
+	for _, c := range cases {
+		if got := registerExpires(newRegisterRequest(t, c.contact, c.expires)); got != c.want {
+			t.Errorf("%s: expires %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestValidDeviceID(t *testing.T) {
+	cases := map[string]bool{
+		"34020000001320000001": true,
+		"34020000001110000001": true,
+		"34020000002000000001": true,
+		// 类型编码不是前端设备或平台
+		"34020000002160000001": false,
+		"34020000001100000001": false,
+		// 长度和字符
+		"3402000000132000001":   false,
+		"340200000013200000011": false,
+		"3402000000132000000a":  false,
+		"":                      false,
+	}
+	for id, want := range cases {
+		if got := validDeviceID(id); got != want {
+			t.Errorf("%q: %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestAutoRegisterAllowed(t *testing.T) {
+	old := _sysinfo
+	defer func() { _sysinfo = old }()
+	device := func(id, addr string) Devices {
+		return Devices{DeviceID: id, source: &net.UDPAddr{IP: net.ParseIP(addr), Port: 5060}}
+	}
+	cases := []struct {
+		name   string
+		policy m.AutoRegisterConfig
+		device Devices
+		want   bool
+	}{
+		{"disabled", m.AutoRegisterConfig{}, device("34020000001320000001", "192.168.1.64"), false},
+		{"any source", m.AutoRegisterConfig{PWD: "123456"}, device("34020000001320000001", "10.0.0.1"), true},
+		{"invalid id", m.AutoRegisterConfig{PWD: "123456"}, device("34020000002160000001", "10.0.0.1"), false},
+		{"cidr", m.AutoRegisterConfig{PWD: "123456", Allow: []string{"192.168.1.0/24"}}, device("34020000001320000001", "192.168.1.64"), true},
+		{"outside cidr", m.AutoRegisterConfig{PWD: "123456", Allow: []string{"192.168.1.0/24"}}, device("34020000001320000001", "192.168.2.64"), false},
+		{"single ip", m.AutoRegisterConfig{PWD: "123456", Allow: []string{"bad", "10.0.0.1"}}, device("34020000001320000001", "10.0.0.1"), true},
+		{"ipv6 cidr", m.AutoRegisterConfig{PWD: "123456", Allow: []string{"fd00::/8"}}, device("34020000001320000001", "fd00::64"), true},
+		{"no source", m.AutoRegisterConfig{PWD: "123456", Allow: []string{"0.0.0.0/0"}}, Devices{DeviceID: "34020000001320000001"}, false},
+	}
+	for _, c := range cases {
+		_sysinfo = &m.SysInfo{AutoRegister: c.policy}
+		if got := autoRegisterAllowed(c.device); got != c.want {
+			t.Errorf("%s: %v, want %v", c.name, got, c.want)
+		}
+	}
+}
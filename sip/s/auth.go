@@ -2,13 +2,57 @@ package sip
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/panjjo/gosip/utils"
+)
+
+var (
+	// ErrNonceUnknown nonce不是本服务下发的，或者不属于该用户
+	ErrNonceUnknown = errors.New("unknown nonce")
+	// ErrNonceStale nonce已过期，需要使用新的nonce重新认证(stale=true)
+	ErrNonceStale = errors.New("stale nonce")
+	// ErrNonceReplay nc未递增或不带qop的nonce重复使用，视为重放
+	ErrNonceReplay = errors.New("nonce replayed")
 )
 
-// Authorization currently only Digest and MD5
+// 摘要认证算法 RFC 8760
+const (
+	AlgorithmMD5        = "MD5"
+	AlgorithmMD5Sess    = "MD5-sess"
+	AlgorithmSHA256     = "SHA-256"
+	AlgorithmSHA256Sess = "SHA-256-sess"
+)
+
+// ValidAlgorithm 是否支持的摘要认证算法，为空表示默认的MD5
+func ValidAlgorithm(algorithm string) bool {
+	switch strings.ToUpper(algorithm) {
+	case "", "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+		return true
+	}
+	return false
+}
+
+// AlgorithmEqual 比较两个算法是否相同，为空视为MD5
+func AlgorithmEqual(a, b string) bool {
+	if a == "" {
+		a = AlgorithmMD5
+	}
+	if b == "" {
+		b = AlgorithmMD5
+	}
+	return strings.EqualFold(a, b)
+}
+
+// Authorization Digest认证，支持MD5和SHA-256及其-sess算法
 type Authorization struct {
 	realm     string
 	nonce     string
@@ -95,6 +139,20 @@ func (auth *Authorization) SetMethod(method string) *Authorization {
 	return auth
 }
 
+// SetCnonce 客户端nonce，qop=auth时使用
+func (auth *Authorization) SetCnonce(cnonce string) *Authorization {
+	auth.cnonce = cnonce
+
+	return auth
+}
+
+// SetNc nonce使用次数，8位16进制，qop=auth时使用
+func (auth *Authorization) SetNc(nc string) *Authorization {
+	auth.nc = nc
+
+	return auth
+}
+
 // SetPassword SetPassword
 func (auth *Authorization) SetPassword(password string) *Authorization {
 	auth.password = password
@@ -102,9 +160,10 @@ func (auth *Authorization) SetPassword(password string) *Authorization {
 	return auth
 }
 
-// CalcResponse CalcResponse
+// CalcResponse 使用认证头中的算法计算response
 func (auth *Authorization) CalcResponse() string {
-	auth.response = CalcResponse(
+	auth.response = CalcResponseWithAlgorithm(
+		auth.algorithm,
 		auth.username,
 		auth.realm,
 		auth.password,
@@ -142,24 +201,137 @@ func (auth *Authorization) String() string {
 
 // CalcResponse Authorization response https://www.ietf.org/rfc/rfc2617.txt
 func CalcResponse(username, realm, password, method, uri, nonce, qop, cnonce, nc string) string {
-	calcA1 := func() string {
-		encoder := md5.New()
-		encoder.Write([]byte(username + ":" + realm + ":" + password))
+	return CalcResponseWithAlgorithm(AlgorithmMD5, username, realm, password, method, uri, nonce, qop, cnonce, nc)
+}
 
-		return hex.EncodeToString(encoder.Sum(nil))
+// CalcResponseWithAlgorithm 按指定算法计算response RFC 7616 3.4.1
+func CalcResponseWithAlgorithm(algorithm, username, realm, password, method, uri, nonce, qop, cnonce, nc string) string {
+	newHash := md5.New
+	if strings.HasPrefix(strings.ToUpper(algorithm), "SHA-256") {
+		newHash = sha256.New
 	}
-	calcA2 := func() string {
-		encoder := md5.New()
-		encoder.Write([]byte(method + ":" + uri))
+	h := func(data string) string {
+		encoder := newHash()
+		encoder.Write([]byte(data))
 
 		return hex.EncodeToString(encoder.Sum(nil))
 	}
 
-	encoder := md5.New()
-	encoder.Write([]byte(calcA1() + ":" + nonce + ":"))
+	a1 := h(username + ":" + realm + ":" + password)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		a1 = h(a1 + ":" + nonce + ":" + cnonce)
+	}
+	a2 := h(method + ":" + uri)
+
 	if qop != "" {
-		encoder.Write([]byte(nc + ":" + cnonce + ":" + qop + ":"))
+		return h(a1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + a2)
+	}
+	return h(a1 + ":" + nonce + ":" + a2)
+}
+
+// nonce最多保存数量，超过后淘汰最早过期的nonce
+const maxNonces = 10000
+
+// Nonces 服务端下发的nonce，记录所属用户、有效期和nc，防止Authorization被重放 RFC 2617 3.2.2
+// 每个用户只保留最新下发的nonce，用户可以是设备id加来源地址，避免其他来源的请求使设备的nonce失效
+type Nonces struct {
+	expire time.Duration
+	items  map[string]*nonceItem
+	// users 用户最新下发的nonce
+	users map[string]string
+	clean time.Time
+	l     *sync.Mutex
+}
+
+type nonceItem struct {
+	user   string
+	expire time.Time
+	nc     uint64
+	used   bool
+}
+
+// NewNonces expire为nonce有效期
+func NewNonces(expire time.Duration) *Nonces {
+	return &Nonces{expire: expire, items: map[string]*nonceItem{}, users: map[string]string{}, clean: time.Now(), l: &sync.Mutex{}}
+}
+
+// New 为user生成新的nonce，user之前下发的nonce失效
+func (n *Nonces) New(user string) string {
+	nonce := utils.RandString(32)
+	now := time.Now()
+	n.l.Lock()
+	defer n.l.Unlock()
+	if now.Sub(n.clean) > n.expire {
+		// 过期的nonce多保留一个有效期，用来返回stale
+		for k, item := range n.items {
+			if now.Sub(item.expire) > n.expire {
+				n.deleteLocked(k)
+			}
+		}
+		n.clean = now
+	}
+	if old, ok := n.users[user]; ok {
+		n.deleteLocked(old)
+	}
+	if len(n.items) >= maxNonces {
+		n.evictLocked()
+	}
+	n.items[nonce] = &nonceItem{user: user, expire: now.Add(n.expire)}
+	n.users[user] = nonce
+	return nonce
+}
+
+// Len 当前保存的nonce数量
+func (n *Nonces) Len() int {
+	n.l.Lock()
+	defer n.l.Unlock()
+	return len(n.items)
+}
+
+func (n *Nonces) deleteLocked(nonce string) {
+	if item, ok := n.items[nonce]; ok {
+		if n.users[item.user] == nonce {
+			delete(n.users, item.user)
+		}
+		delete(n.items, nonce)
+	}
+}
+
+// evictLocked 淘汰最早过期的nonce
+func (n *Nonces) evictLocked() {
+	var oldest string
+	var expire time.Time
+	for k, item := range n.items {
+		if oldest == "" || item.expire.Before(expire) {
+			oldest, expire = k, item.expire
+		}
+	}
+	n.deleteLocked(oldest)
+}
+
+// Check 校验user使用的nonce和nc，应在response校验通过后调用
+// 带qop时nc必须递增，不带qop时nonce只能使用一次
+func (n *Nonces) Check(user, nonce, nc string) error {
+	n.l.Lock()
+	defer n.l.Unlock()
+	item, ok := n.items[nonce]
+	if !ok || item.user != user {
+		return ErrNonceUnknown
+	}
+	if time.Now().After(item.expire) {
+		return ErrNonceStale
+	}
+	if nc == "" {
+		if item.used {
+			return ErrNonceReplay
+		}
+		item.used = true
+		return nil
+	}
+	count, err := strconv.ParseUint(nc, 16, 64)
+	if err != nil || count <= item.nc {
+		return ErrNonceReplay
 	}
-	encoder.Write([]byte(calcA2()))
-	return hex.EncodeToString(encoder.Sum(nil))
+	item.nc = count
+	return nil
 }
@@ -0,0 +1,149 @@
+package sip
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCalcResponseMD5(t *testing.T) {
+	// RFC 2617 3.5
+	got := CalcResponse("Mufasa", "testrealm@host.com", "Circle Of Life", "GET", "/dir/index.html",
+		"dcd98b7102dd2f0e8b11d0f600bfb0c093", "auth", "0a4f113b", "00000001")
+	if want := "6629fae49393a05397450978507c4ef1"; got != want {
+		t.Fatalf("response %s, want %s", got, want)
+	}
+}
+
+func TestCalcResponseSHA256(t *testing.T) {
+	// RFC 7616 3.9.1
+	const (
+		nonce  = "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+		cnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+	)
+	cases := []struct {
+		algorithm, want string
+	}{
+		{AlgorithmMD5, "8ca523f5e9506fed4657c9700eebdbec"},
+		{AlgorithmSHA256, "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+		{"sha-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, c := range cases {
+		got := CalcResponseWithAlgorithm(c.algorithm, "Mufasa", "http-auth@example.org", "Circle of Life", "GET", "/dir/index.html",
+			nonce, "auth", cnonce, "00000001")
+		if got != c.want {
+			t.Errorf("%s response %s, want %s", c.algorithm, got, c.want)
+		}
+	}
+}
+
+func TestCalcResponseSess(t *testing.T) {
+	h := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+	a1 := h(h("Mufasa:http-auth@example.org:Circle of Life") + ":nonce:cnonce")
+	want := h(a1 + ":nonce:00000001:cnonce:auth:" + h("REGISTER:sip:3402000000"))
+
+	auth := AuthFromValue(`Digest realm="http-auth@example.org", nonce="nonce", algorithm=SHA-256-sess, qop="auth"`)
+	auth.SetUsername("Mufasa").SetPassword("Circle of Life").SetMethod("REGISTER").SetURI("sip:3402000000").SetCnonce("cnonce").SetNc("00000001")
+	if got := auth.CalcResponse(); got != want {
+		t.Fatalf("SHA-256-sess response %s, want %s", got, want)
+	}
+	if got := CalcResponseWithAlgorithm(AlgorithmSHA256, "Mufasa", "http-auth@example.org", "Circle of Life", "REGISTER", "sip:3402000000",
+		"nonce", "auth", "cnonce", "00000001"); got == want {
+		t.Fatal("-sess response equals SHA-256 response")
+	}
+	md5Sess := CalcResponseWithAlgorithm(AlgorithmMD5Sess, "Mufasa", "http-auth@example.org", "Circle of Life", "REGISTER", "sip:3402000000",
+		"nonce", "auth", "cnonce", "00000001")
+	if len(md5Sess) != 32 || md5Sess == CalcResponse("Mufasa", "http-auth@example.org", "Circle of Life", "REGISTER", "sip:3402000000",
+		"nonce", "auth", "cnonce", "00000001") {
+		t.Fatalf("MD5-sess response %s", md5Sess)
+	}
+}
+
+func TestAlgorithm(t *testing.T) {
+	for _, a := range []string{"", "MD5", "md5-sess", "SHA-256", "sha-256-SESS"} {
+		if !ValidAlgorithm(a) {
+			t.Errorf("%q should be valid", a)
+		}
+	}
+	if ValidAlgorithm("SHA-512-256") {
+		t.Error("SHA-512-256 should be invalid")
+	}
+	if !AlgorithmEqual("", "md5") || !AlgorithmEqual("sha-256", AlgorithmSHA256) || AlgorithmEqual("", AlgorithmSHA256) {
+		t.Error("AlgorithmEqual mismatch")
+	}
+}
+
+func TestNoncesCheck(t *testing.T) {
+	nonces := NewNonces(time.Minute)
+	nonce := nonces.New("34020000001320000001")
+	if err := nonces.Check("34020000001320000001", nonce, "00000001"); err != nil {
+		t.Fatal(err)
+	}
+	// nc必须递增
+	if err := nonces.Check("34020000001320000001", nonce, "00000001"); !errors.Is(err, ErrNonceReplay) {
+		t.Fatalf("replayed nc err %v", err)
+	}
+	if err := nonces.Check("34020000001320000001", nonce, "0000000a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := nonces.Check("34020000001320000001", nonce, "00000009"); !errors.Is(err, ErrNonceReplay) {
+		t.Fatalf("decreased nc err %v", err)
+	}
+	if err := nonces.Check("34020000001320000002", nonce, "0000000b"); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("other user err %v", err)
+	}
+	if err := nonces.Check("34020000001320000001", "unknown", "00000001"); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("unknown nonce err %v", err)
+	}
+
+	// 不带qop的nonce只能使用一次
+	nonce = nonces.New("34020000001320000003")
+	if err := nonces.Check("34020000001320000003", nonce, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := nonces.Check("34020000001320000003", nonce, ""); !errors.Is(err, ErrNonceReplay) {
+		t.Fatalf("reused nonce err %v", err)
+	}
+}
+
+func TestNoncesStale(t *testing.T) {
+	nonces := NewNonces(20 * time.Millisecond)
+	nonce := nonces.New("34020000001320000001")
+	time.Sleep(30 * time.Millisecond)
+	if err := nonces.Check("34020000001320000001", nonce, "00000001"); !errors.Is(err, ErrNonceStale) {
+		t.Fatalf("expired nonce err %v", err)
+	}
+}
+
+func TestNoncesBounded(t *testing.T) {
+	nonces := NewNonces(time.Minute)
+	// 每个用户只保留最新的nonce
+	first := nonces.New("34020000001320000001")
+	second := nonces.New("34020000001320000001")
+	if err := nonces.Check("34020000001320000001", first, "00000001"); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("replaced nonce err %v", err)
+	}
+	if err := nonces.Check("34020000001320000001", second, "00000001"); err != nil {
+		t.Fatal(err)
+	}
+	if n := nonces.Len(); n != 1 {
+		t.Fatalf("len %d, want 1", n)
+	}
+
+	for i := 0; i < maxNonces+10; i++ {
+		nonces.New(fmt.Sprintf("user%d", i))
+	}
+	if n := nonces.Len(); n != maxNonces {
+		t.Fatalf("len %d, want %d", n, maxNonces)
+	}
+	// 最早下发的nonce被淘汰
+	if err := nonces.Check("34020000001320000001", second, "00000002"); !errors.Is(err, ErrNonceUnknown) {
+		t.Fatalf("evicted nonce err %v", err)
+	}
+}
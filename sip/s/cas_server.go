@@ -1,7 +1,6 @@
 package sip
 
 import (
-	"errors"
 	"github.com/panjjo/gosip/utils"
 	"github.com/sirupsen/logrus"
 	"net"
@@ -9,11 +8,6 @@ import (
 	"strings"
 )
 
-//var (
-//	srvParser      *parser
-//	LoAddr, ReAddr net.Addr
-//)
-
 // CreateUDPServer CreateUDPServer
 func (s *Server) CreateCasUDPServer(raddr, laddr string) {
 	lAddr, err := net.ResolveUDPAddr("udp", laddr)
@@ -22,7 +16,7 @@ func (s *Server) CreateCasUDPServer(raddr, laddr string) {
 	}
 	s.udpaddr = lAddr
 	s.port = NewPort(lAddr.Port)
-	s.host, err = utils.ResolveSelfIP()
+	s.host, err = resolveHost(lAddr.IP)
 	if err != nil {
 		logrus.Fatalf("CreateUDPServer resolveip failed, addr=%s, err=%s", laddr, err.Error())
 	}
@@ -31,60 +25,35 @@ func (s *Server) CreateCasUDPServer(raddr, laddr string) {
 	if err != nil {
 		logrus.Fatalf("CreateUDPServer resolve remote addr failed, addr=%s, err=%s", raddr, err.Error())
 	}
-	LoAddr = lAddr
-	ReAddr = rAddr
+	s.raddr = rAddr
 
 	udp, err := net.DialUDP("udp", lAddr, rAddr)
 	if err != nil {
 		logrus.Fatalf("CreateUDPServer dialudp failed, laddr=%s, raddr=%s, err=%s", laddr, raddr, err.Error())
 	}
 	s.conn = newUDPConnection(udp)
-	srvParser = newParser()
+	s.addTransport(newUDPTransport(s.conn))
 }
 
 // ListenUDPServer ListenUDPServer
 func (s *Server) ListenCasUDPServer() {
-
-	var (
-		readdr net.Addr
-		num    int
-		err    error
-	)
-	defer srvParser.stop()
-	buf := make([]byte, bufferSize)
-	go s.handlerListen(srvParser.out)
-
-	for {
-		num, readdr, err = s.conn.ReadFrom(buf)
-		if err != nil {
-			logrus.Errorf("ListenUDPServer read data failed, err=%s, data=%s", err.Error(), string(buf))
-			continue
-		}
-		srvParser.in <- newPacket(buf[:num], readdr)
+	t, ok := s.transport("UDP")
+	if !ok {
+		logrus.Errorln("ListenCasUDPServer udp server not created")
+		return
+	}
+	if err := t.Serve(s.receive); err != nil {
+		logrus.Errorf("ListenUDPServer read data failed, err=%s", err.Error())
 	}
 }
 
 func (s *Server) CasNewPacket(data []byte, raddr net.Addr) {
-	srvParser.in <- newPacket(data, raddr)
+	s.receive(data, raddr)
 }
 
 // Request Request
 func (s *Server) CasRequest(req *Request) (*Transaction, error) {
-	viaHop, ok := req.ViaHop()
-	if !ok {
-		return nil, errors.New("missing required 'Via' header")
-	}
-	viaHop.Host = s.host.String()
-	viaHop.Port = s.port
-	if viaHop.Params == nil {
-		viaHop.Params = NewParams().Add("branch", String{Str: GenerateBranch()})
-	}
-	if !viaHop.Params.Has("rport") {
-		viaHop.Params.Add("rport", nil)
-	}
-
-	tx := s.mustTX(getTXKey(req))
-	return tx, tx.CasRequest(req)
+	return s.Request(req)
 }
 
 func (s *Server) CasWrite(buf []byte) (int, error) {
@@ -98,9 +67,9 @@ func (s *Server) CasRead(buf []byte) (int, error) {
 }
 
 func (s *Server) CasSipResponse(tx *Transaction) (*Response, error) {
-	response := tx.GetResponse()
-	if response == nil {
-		return nil, utils.NewError(nil, "response timeout, tx key:", tx.Key())
+	response, err := tx.GetResponse()
+	if err != nil {
+		return nil, utils.NewError(err, "get response failed, tx key:", tx.Key())
 	}
 	if response.StatusCode() != http.StatusOK {
 		return response, utils.NewError(nil, "response fail, code=", response.StatusCode(), ", reason=", response.Reason(), ", tx key:", tx.Key())
@@ -109,9 +78,9 @@ func (s *Server) CasSipResponse(tx *Transaction) (*Response, error) {
 }
 
 func (s *Server) GetCasRegResponse(tx *Transaction) (*Response, error) {
-	response := tx.GetResponse()
-	if response == nil {
-		return nil, utils.NewError(nil, "response timeout, tx key:", tx.Key())
+	response, err := tx.GetResponse()
+	if err != nil {
+		return nil, utils.NewError(err, "get response failed, tx key:", tx.Key())
 	}
 	return response, nil
 }
@@ -3,9 +3,12 @@ package sip
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/panjjo/gosip/utils"
@@ -89,6 +92,35 @@ func newUDPConnection(baseConn net.Conn) Connection {
 	return conn
 }
 
+func newTCPConnection(baseConn net.Conn) Connection {
+	conn := &connection{
+		baseConn: baseConn,
+		laddr:    baseConn.LocalAddr(),
+		raddr:    baseConn.RemoteAddr(),
+		logKey:   "tcpConnection",
+	}
+	return conn
+}
+
+func newTLSConnection(baseConn net.Conn) Connection {
+	conn := &connection{
+		baseConn: baseConn,
+		laddr:    tlsAddr{baseConn.LocalAddr()},
+		raddr:    tlsAddr{baseConn.RemoteAddr()},
+		logKey:   "tlsConnection",
+	}
+	return conn
+}
+
+// tlsAddr tls连接地址，Network返回tls，用于和tcp连接区分
+type tlsAddr struct {
+	net.Addr
+}
+
+func (addr tlsAddr) Network() string {
+	return "tls"
+}
+
 func (conn *connection) Read(buf []byte) (int, error) {
 	var (
 		num int
@@ -104,7 +136,13 @@ func (conn *connection) Read(buf []byte) (int, error) {
 }
 
 func (conn *connection) ReadFrom(buf []byte) (num int, raddr net.Addr, err error) {
-	num, raddr, err = conn.baseConn.(net.PacketConn).ReadFrom(buf)
+	pconn, ok := conn.baseConn.(net.PacketConn)
+	if !ok {
+		// 面向连接的传输，来源地址即为对端地址
+		num, err = conn.Read(buf)
+		return num, conn.raddr, err
+	}
+	num, raddr, err = pconn.ReadFrom(buf)
 	if err != nil {
 		return num, raddr, utils.NewError(err, conn.logKey, "readfrom", conn.baseConn.LocalAddr().String(), raddr.String())
 	}
@@ -126,7 +164,12 @@ func (conn *connection) Write(buf []byte) (int, error) {
 }
 
 func (conn *connection) WriteTo(buf []byte, raddr net.Addr) (num int, err error) {
-	num, err = conn.baseConn.(net.PacketConn).WriteTo(buf, raddr)
+	pconn, ok := conn.baseConn.(net.PacketConn)
+	if !ok || conn.raddr != nil {
+		// 面向连接的传输或已连接的udp，直接写入连接
+		return conn.Write(buf)
+	}
+	num, err = pconn.WriteTo(buf, raddr)
 	if err != nil {
 		return num, utils.NewError(err, conn.logKey, "writeTo", conn.baseConn.LocalAddr().String(), raddr.String())
 	}
@@ -135,11 +178,11 @@ func (conn *connection) WriteTo(buf []byte, raddr net.Addr) (num int, err error)
 }
 
 func (conn *connection) LocalAddr() net.Addr {
-	return conn.baseConn.LocalAddr()
+	return conn.laddr
 }
 
 func (conn *connection) RemoteAddr() net.Addr {
-	return conn.baseConn.RemoteAddr()
+	return conn.raddr
 }
 
 func (conn *connection) Close() error {
@@ -151,7 +194,7 @@ func (conn *connection) Close() error {
 }
 
 func (conn *connection) Network() string {
-	return strings.ToUpper(conn.baseConn.LocalAddr().Network())
+	return strings.ToUpper(conn.laddr.Network())
 }
 
 func (conn *connection) SetDeadline(t time.Time) error {
@@ -165,3 +208,85 @@ func (conn *connection) SetReadDeadline(t time.Time) error {
 func (conn *connection) SetWriteDeadline(t time.Time) error {
 	return conn.baseConn.SetWriteDeadline(t)
 }
+
+// readStreamMessage 从流式连接(tcp/tls)中读取一个完整的sip消息，按Content-Length切分消息体
+func readStreamMessage(reader *bufio.Reader) ([]byte, error) {
+	var (
+		buf    bytes.Buffer
+		length int
+	)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() == 0 && strings.TrimSpace(line) == "" {
+			// 消息之间的CRLF保活数据，直接忽略
+			continue
+		}
+		buf.WriteString(line)
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			// 头部结束
+			break
+		}
+		if idx := strings.Index(line, ":"); idx > 0 {
+			switch strings.ToLower(strings.TrimSpace(line[:idx])) {
+			case "content-length", "l":
+				length, err = strconv.Atoi(strings.TrimSpace(line[idx+1:]))
+				if err != nil || length < 0 || length > int(bufferSize) {
+					return nil, fmt.Errorf("invalid content-length: %s", line)
+				}
+			}
+		}
+	}
+	if length > 0 {
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil, err
+		}
+		buf.Write(body)
+	}
+	return buf.Bytes(), nil
+}
+
+// streamConnections 流式连接(tcp/tls)集合，按对端地址索引，用来将响应和后续请求发回设备所使用的连接
+type streamConnections struct {
+	conns map[string]Connection
+	rwm   *sync.RWMutex
+}
+
+func newStreamConnections() *streamConnections {
+	return &streamConnections{conns: map[string]Connection{}, rwm: &sync.RWMutex{}}
+}
+
+func (sc *streamConnections) get(raddr net.Addr) Connection {
+	sc.rwm.RLock()
+	defer sc.rwm.RUnlock()
+	return sc.conns[raddr.String()]
+}
+
+func (sc *streamConnections) store(conn Connection) {
+	sc.rwm.Lock()
+	sc.conns[conn.RemoteAddr().String()] = conn
+	sc.rwm.Unlock()
+}
+
+// closeAll 关闭全部连接，连接的读取协程随之退出
+func (sc *streamConnections) closeAll() {
+	sc.rwm.Lock()
+	conns := sc.conns
+	sc.conns = map[string]Connection{}
+	sc.rwm.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func (sc *streamConnections) remove(conn Connection) {
+	sc.rwm.Lock()
+	if c, ok := sc.conns[conn.RemoteAddr().String()]; ok && c == conn {
+		delete(sc.conns, conn.RemoteAddr().String())
+	}
+	sc.rwm.Unlock()
+}
@@ -0,0 +1,159 @@
+package sip
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadStreamMessage(t *testing.T) {
+	first := "MESSAGE sip:a@b SIP/2.0\r\nContent-Length: 12\r\n\r\nhello\r\nworld"
+	second := "SIP/2.0 200 OK\r\nl: 0\r\n\r\n"
+	third := "MESSAGE sip:a@b SIP/2.0\r\nCall-ID: 1\r\n\r\n"
+	// 消息之间的CRLF保活数据被忽略
+	reader := bufio.NewReader(strings.NewReader("\r\n\r\n" + first + "\r\n" + second + third))
+	for _, want := range []string{first, second, third} {
+		data, err := readStreamMessage(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Fatalf("message %q, want %q", data, want)
+		}
+	}
+	if _, err := readStreamMessage(reader); err != io.EOF {
+		t.Fatalf("err %v, want EOF", err)
+	}
+}
+
+func TestReadStreamMessageInvalid(t *testing.T) {
+	cases := map[string]string{
+		"negative length":  "MESSAGE sip:a@b SIP/2.0\r\nContent-Length: -1\r\n\r\n",
+		"invalid length":   "MESSAGE sip:a@b SIP/2.0\r\nContent-Length: abc\r\n\r\n",
+		"oversized length": "MESSAGE sip:a@b SIP/2.0\r\nContent-Length: 99999999\r\n\r\n",
+		"truncated body":   "MESSAGE sip:a@b SIP/2.0\r\nContent-Length: 10\r\n\r\nhello",
+		"truncated header": "MESSAGE sip:a@b SIP/2.0\r\nCall-ID",
+	}
+	for name, raw := range cases {
+		if _, err := readStreamMessage(bufio.NewReader(strings.NewReader(raw))); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestStreamTransportDialOnce(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dials int32
+	dial := func(raddr net.Addr) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		time.Sleep(20 * time.Millisecond)
+		return net.Dial("tcp", raddr.String())
+	}
+	tp := newStreamTransport("TCP", nil, dial, newTCPConnection, func(data []byte, raddr net.Addr) {})
+	defer tp.Close()
+	defer listener.Close()
+
+	conns := make([]Connection, 10)
+	var wg sync.WaitGroup
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := tp.Connection(listener.Addr())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conns[i] = conn
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Fatalf("dialed %d times, want 1", n)
+	}
+	for _, conn := range conns {
+		if conn != conns[0] {
+			t.Fatal("concurrent requests got different connections")
+		}
+	}
+}
+
+func TestStreamTransportDialFailed(t *testing.T) {
+	var dials int32
+	dial := func(raddr net.Addr) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		time.Sleep(20 * time.Millisecond)
+		return nil, errors.New("connection refused")
+	}
+	tp := newStreamTransport("TCP", nil, dial, newTCPConnection, func(data []byte, raddr net.Addr) {})
+	raddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5060}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tp.Connection(raddr); err == nil {
+				t.Error("want dial error")
+			}
+		}()
+	}
+	wg.Wait()
+	// 失败后不保留正在建立的连接，下次请求重新拨号
+	before := atomic.LoadInt32(&dials)
+	if _, err := tp.Connection(raddr); err == nil {
+		t.Fatal("want dial error")
+	}
+	if n := atomic.LoadInt32(&dials); n != before+1 {
+		t.Fatalf("dialed %d times, want %d", n, before+1)
+	}
+}
+
+func TestStreamTransportServeHandle(t *testing.T) {
+	peer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	msg := "MESSAGE sip:a@b SIP/2.0\r\nContent-Length: 0\r\n\r\n"
+	go func() {
+		conn, err := peer.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < 20; i++ {
+			conn.Write([]byte(msg))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan struct{}, 20)
+	handle := func(data []byte, raddr net.Addr) { received <- struct{}{} }
+	dial := func(raddr net.Addr) (net.Conn, error) { return net.Dial("tcp", raddr.String()) }
+	tp := newStreamTransport("TCP", listener, dial, newTCPConnection, handle)
+	defer tp.Close()
+	// 主动建立的连接读取消息的同时开始Serve
+	if _, err := tp.Connection(peer.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	go tp.Serve(handle)
+	for i := 0; i < 20; i++ {
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("received %d messages, want 20", i)
+		}
+	}
+}
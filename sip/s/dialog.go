@@ -0,0 +1,253 @@
+package sip
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"sync/atomic"
+
+	"github.com/panjjo/gosip/utils"
+)
+
+// Dialog INVITE建立的sip会话 RFC 3261 12
+// 会话内请求(ACK,BYE,INFO)都通过Dialog生成，保证callid，tag，cseq，路由集一致
+// 字段均可序列化，保存到数据库后服务重启仍可以用来关闭会话
+type Dialog struct {
+	CallID    string `json:"callid"`
+	LocalTag  string `json:"localtag"`
+	RemoteTag string `json:"remotetag"`
+	LocalURI  string `json:"localuri"`
+	RemoteURI string `json:"remoteuri"`
+	// 对端Contact地址，会话内请求的Request-URI
+	RemoteTarget string `json:"remotetarget"`
+	// 路由集，由Record-Route生成
+	RouteSet []string `json:"routeset"`
+	// 本端cseq，每发起一个会话内请求加1
+	LocalSeq uint32 `json:"localseq"`
+	// 对端cseq
+	RemoteSeq uint32 `json:"remoteseq"`
+	// INVITE的cseq，ACK使用
+	InviteSeq uint32 `json:"inviteseq"`
+	Transport string `json:"transport"`
+
+	dest net.Addr
+}
+
+// NewDialogFromResponse 作为UAC，根据发出的INVITE和收到的2xx响应建立会话
+func NewDialogFromResponse(invite *Request, resp *Response) (*Dialog, error) {
+	callID, ok := resp.CallID()
+	if !ok {
+		return nil, fmt.Errorf("dialog response missing call-id")
+	}
+	from, ok := resp.From()
+	if !ok {
+		return nil, fmt.Errorf("dialog response missing from")
+	}
+	to, ok := resp.To()
+	if !ok {
+		return nil, fmt.Errorf("dialog response missing to")
+	}
+	cseq, ok := resp.CSeq()
+	if !ok {
+		return nil, fmt.Errorf("dialog response missing cseq")
+	}
+	d := &Dialog{
+		CallID:       string(*callID),
+		LocalTag:     paramValue(from.Params, "tag"),
+		RemoteTag:    paramValue(to.Params, "tag"),
+		LocalURI:     from.Address.String(),
+		RemoteURI:    to.Address.String(),
+		RemoteTarget: to.Address.String(),
+		LocalSeq:     cseq.SeqNo,
+		InviteSeq:    cseq.SeqNo,
+		Transport:    "UDP",
+		dest:         resp.Source(),
+	}
+	if contact, ok := resp.Contact(); ok && contact.Address != nil {
+		d.RemoteTarget = contact.Address.String()
+	}
+	if invite != nil {
+		if via, ok := invite.ViaHop(); ok && via.Transport != "" {
+			d.Transport = via.Transport
+		}
+	}
+	// UAC路由集为Record-Route的逆序
+	routes := recordRoutes(resp)
+	for i := len(routes) - 1; i >= 0; i-- {
+		d.RouteSet = append(d.RouteSet, routes[i])
+	}
+	return d, nil
+}
+
+// NewDialogFromRequest 作为UAS，根据收到的INVITE和回复的2xx响应建立会话
+func NewDialogFromRequest(invite *Request, resp *Response) (*Dialog, error) {
+	callID, ok := invite.CallID()
+	if !ok {
+		return nil, fmt.Errorf("dialog request missing call-id")
+	}
+	from, ok := invite.From()
+	if !ok {
+		return nil, fmt.Errorf("dialog request missing from")
+	}
+	to, ok := resp.To()
+	if !ok {
+		return nil, fmt.Errorf("dialog response missing to")
+	}
+	cseq, ok := invite.CSeq()
+	if !ok {
+		return nil, fmt.Errorf("dialog request missing cseq")
+	}
+	d := &Dialog{
+		CallID:       string(*callID),
+		LocalTag:     paramValue(to.Params, "tag"),
+		RemoteTag:    paramValue(from.Params, "tag"),
+		LocalURI:     to.Address.String(),
+		RemoteURI:    from.Address.String(),
+		RemoteTarget: from.Address.String(),
+		RemoteSeq:    cseq.SeqNo,
+		InviteSeq:    cseq.SeqNo,
+		Transport:    "UDP",
+		dest:         invite.Source(),
+	}
+	if contact, ok := invite.Contact(); ok && contact.Address != nil {
+		d.RemoteTarget = contact.Address.String()
+	}
+	if via, ok := invite.ViaHop(); ok && via.Transport != "" {
+		d.Transport = via.Transport
+	}
+	// UAS路由集与Record-Route顺序一致
+	d.RouteSet = recordRoutes(invite)
+	return d, nil
+}
+
+// Match 判断收到的请求是否属于此会话
+func (d *Dialog) Match(req *Request) bool {
+	callID, ok := req.CallID()
+	if !ok || string(*callID) != d.CallID {
+		return false
+	}
+	from, ok := req.From()
+	if !ok || paramValue(from.Params, "tag") != d.RemoteTag {
+		return false
+	}
+	to, ok := req.To()
+	if !ok || paramValue(to.Params, "tag") != d.LocalTag {
+		return false
+	}
+	if cseq, ok := req.CSeq(); ok && req.Method() != ACK && req.Method() != CANCEL {
+		if cseq.SeqNo > atomic.LoadUint32(&d.RemoteSeq) {
+			atomic.StoreUint32(&d.RemoteSeq, cseq.SeqNo)
+		}
+	}
+	return true
+}
+
+// SetDestination 设置会话内请求的发送地址，服务重启后需要重新设置
+func (d *Dialog) SetDestination(dest net.Addr) {
+	d.dest = dest
+}
+
+// NewRequest 生成会话内请求，cseq自动递增
+func (d *Dialog) NewRequest(method RequestMethod) (*Request, error) {
+	return d.newRequest(method, atomic.AddUint32(&d.LocalSeq, 1))
+}
+
+// NewAck 生成INVITE 2xx响应的ACK，cseq与INVITE相同
+func (d *Dialog) NewAck() (*Request, error) {
+	return d.newRequest(ACK, d.InviteSeq)
+}
+
+func (d *Dialog) newRequest(method RequestMethod, seq uint32) (*Request, error) {
+	local, err := ParseURI(d.LocalURI)
+	if err != nil {
+		return nil, utils.NewError(err, "dialog local uri", d.LocalURI)
+	}
+	remote, err := ParseURI(d.RemoteURI)
+	if err != nil {
+		return nil, utils.NewError(err, "dialog remote uri", d.RemoteURI)
+	}
+	target, err := ParseURI(d.RemoteTarget)
+	if err != nil {
+		return nil, utils.NewError(err, "dialog remote target", d.RemoteTarget)
+	}
+	routes := make([]*URI, 0, len(d.RouteSet)+1)
+	for _, r := range d.RouteSet {
+		uri, err := ParseURI(r)
+		if err != nil {
+			return nil, utils.NewError(err, "dialog route", r)
+		}
+		routes = append(routes, uri)
+	}
+	// 严格路由：首个路由不带lr参数时，Request-URI使用首个路由，对端地址放到路由集最后
+	if len(routes) > 0 && (routes[0].FUriParams == nil || !routes[0].FUriParams.Has("lr")) {
+		first := routes[0]
+		routes = append(routes[1:], target)
+		target = first.Clone()
+		target.FHeaders = nil
+	}
+
+	callID := CallID(d.CallID)
+	toParams := NewParams()
+	if d.RemoteTag != "" {
+		toParams.Add("tag", String{Str: d.RemoteTag})
+	}
+	hb := NewHeaderBuilder().
+		SetFrom(&Address{URI: local, Params: NewParams().Add("tag", String{Str: d.LocalTag})}).
+		SetToWithParam(&Address{URI: remote, Params: toParams}).
+		AddVia(&ViaHop{
+			Transport: d.Transport,
+			Params:    NewParams().Add("branch", String{Str: GenerateBranch()}),
+		}).
+		SetCallID(&callID).
+		SetMethod(method).
+		SetSeqNo(uint(seq))
+	req := NewRequest("", method, target, DefaultSipVersion, hb.Build(), nil)
+	if len(routes) > 0 {
+		req.AppendHeader(&RouteHeader{Addresses: routes})
+	}
+	req.SetDestination(d.dest)
+	return req, nil
+}
+
+// Value 数据库存储
+func (d *Dialog) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	return utils.JSONEncode(d), nil
+}
+
+// Scan 数据库读取
+func (d *Dialog) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return utils.JSONDecode(v, d)
+	case string:
+		return utils.JSONDecode([]byte(v), d)
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("failed to unmarshal dialog value: %v", value)
+}
+
+func paramValue(params Params, key string) string {
+	if params == nil {
+		return ""
+	}
+	if v, ok := params.Get(key); ok && v != nil {
+		return v.String()
+	}
+	return ""
+}
+
+func recordRoutes(msg Message) []string {
+	routes := []string{}
+	for _, h := range msg.GetHeaders("Record-Route") {
+		if rr, ok := h.(*RecordRouteHeader); ok {
+			for _, uri := range rr.Addresses {
+				routes = append(routes, uri.String())
+			}
+		}
+	}
+	return routes
+}
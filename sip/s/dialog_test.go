@@ -0,0 +1,148 @@
+package sip
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// newDialogResponse INVITE的2xx响应，带to tag、Contact和Record-Route
+func newDialogResponse(t *testing.T, invite *Request, routes ...string) *Response {
+	t.Helper()
+	from, _ := invite.From()
+	from.Params = NewParams().Add("tag", String{Str: "uactag"})
+	resp := NewResponseFromRequest("", invite, http.StatusOK, "OK", nil)
+	to, _ := resp.To()
+	to.Params = NewParams().Add("tag", String{Str: "uastag"})
+	contact, err := ParseURI("sip:34020000001320000001@192.168.1.64:5060")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.AppendHeader(&ContactHeader{Address: contact, Params: NewParams()})
+	if len(routes) > 0 {
+		rr := &RecordRouteHeader{}
+		for _, r := range routes {
+			uri, err := ParseURI(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr.Addresses = append(rr.Addresses, uri)
+		}
+		resp.AppendHeader(rr)
+		invite.AppendHeader(rr)
+	}
+	return resp
+}
+
+func routeHeader(t *testing.T, req *Request) []string {
+	t.Helper()
+	hdrs := req.GetHeaders("Route")
+	if len(hdrs) == 0 {
+		return nil
+	}
+	routes := []string{}
+	for _, uri := range hdrs[0].(*RouteHeader).Addresses {
+		routes = append(routes, uri.String())
+	}
+	return routes
+}
+
+func TestDialogRouteSet(t *testing.T) {
+	invite := newMemoryRequest(t, INVITE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	resp := newDialogResponse(t, invite, "sip:p2.example.com;lr", "sip:p1.example.com;lr")
+
+	uac, err := NewDialogFromResponse(invite, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(uac.RouteSet, ",") != "sip:p1.example.com;lr,sip:p2.example.com;lr" {
+		t.Fatalf("uac route set %v", uac.RouteSet)
+	}
+	uas, err := NewDialogFromRequest(invite, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(uas.RouteSet, ",") != "sip:p2.example.com;lr,sip:p1.example.com;lr" {
+		t.Fatalf("uas route set %v", uas.RouteSet)
+	}
+
+	bye, err := uac.NewRequest(BYE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 松散路由：Request-URI为对端Contact
+	if bye.Recipient().String() != "sip:34020000001320000001@192.168.1.64:5060" {
+		t.Fatalf("request uri %s", bye.Recipient())
+	}
+	if routes := routeHeader(t, bye); strings.Join(routes, ",") != strings.Join(uac.RouteSet, ",") {
+		t.Fatalf("route %v, want %v", routes, uac.RouteSet)
+	}
+	if !uas.Match(bye) {
+		t.Fatal("bye does not match uas dialog")
+	}
+	if cseq, _ := bye.CSeq(); cseq.SeqNo != uac.InviteSeq+1 || uas.RemoteSeq != cseq.SeqNo {
+		t.Fatalf("bye cseq %d, uas remote seq %d", cseq.SeqNo, uas.RemoteSeq)
+	}
+	ack, err := uac.NewAck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cseq, _ := ack.CSeq(); cseq.SeqNo != uac.InviteSeq || cseq.MethodName != ACK {
+		t.Fatalf("ack cseq %v", cseq)
+	}
+	// 其他会话的请求不匹配
+	other, _ := uas.NewRequest(BYE)
+	if uas.Match(other) {
+		t.Fatal("request with swapped tags matched")
+	}
+}
+
+func TestDialogStrictRoute(t *testing.T) {
+	invite := newMemoryRequest(t, INVITE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	resp := newDialogResponse(t, invite, "sip:p2.example.com;lr", "sip:p1.example.com")
+	uac, err := NewDialogFromResponse(invite, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bye, err := uac.NewRequest(BYE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 严格路由：Request-URI为首个路由，对端Contact放到路由集最后
+	if bye.Recipient().String() != "sip:p1.example.com" {
+		t.Fatalf("request uri %s", bye.Recipient())
+	}
+	want := "sip:p2.example.com;lr,sip:34020000001320000001@192.168.1.64:5060"
+	if routes := routeHeader(t, bye); strings.Join(routes, ",") != want {
+		t.Fatalf("route %v, want %s", routes, want)
+	}
+}
+
+func TestDialogValue(t *testing.T) {
+	invite := newMemoryRequest(t, INVITE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	uac, err := NewDialogFromResponse(invite, newDialogResponse(t, invite, "sip:p1.example.com;lr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uac.NewRequest(INFO)
+	value, err := uac.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &Dialog{}
+	if err := restored.Scan(value); err != nil {
+		t.Fatal(err)
+	}
+	if restored.CallID != uac.CallID || restored.RemoteTag != "uastag" || restored.LocalTag != "uactag" ||
+		restored.LocalSeq != uac.LocalSeq || len(restored.RouteSet) != 1 || restored.Transport != uac.Transport {
+		t.Fatalf("restored dialog %+v, want %+v", restored, uac)
+	}
+	// 重启后的会话继续递增cseq
+	bye, err := restored.NewRequest(BYE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cseq, _ := bye.CSeq(); cseq.SeqNo != uac.LocalSeq+1 {
+		t.Fatalf("bye cseq %d, want %d", cseq.SeqNo, uac.LocalSeq+1)
+	}
+}
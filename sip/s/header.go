@@ -755,7 +755,7 @@ type ViaHop struct {
 // SentBy SentBy
 func (hop *ViaHop) SentBy() string {
 	var buf bytes.Buffer
-	buf.WriteString(hop.Host)
+	buf.WriteString(formatHost(hop.Host))
 	if hop.Port != nil {
 		buf.WriteString(fmt.Sprintf(":%d", *hop.Port))
 	}
@@ -771,7 +771,7 @@ func (hop *ViaHop) String() string {
 			hop.ProtocolName,
 			hop.ProtocolVersion,
 			hop.Transport,
-			hop.Host,
+			formatHost(hop.Host),
 		),
 	)
 	if hop.Port != nil {
@@ -1355,7 +1355,7 @@ func (ua *UserAgentHeader) Equals(other interface{}) bool {
 
 // ==================   AllowHeader   ================
 
-var defaultAllowMethods = &AllowHeader{INVITE, ACK, CANCEL, MESSAGE, REGISTER}
+var defaultAllowMethods = &AllowHeader{INVITE, ACK, CANCEL, MESSAGE, REGISTER, NOTIFY}
 
 // AllowHeader AllowHeader
 type AllowHeader []RequestMethod
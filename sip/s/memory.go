@@ -0,0 +1,194 @@
+package sip
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// MemoryNetwork 内存网络，同一进程中的多个Server通过内存传输互通，不需要打开端口，用于单元测试
+//
+//	network := NewMemoryNetwork()
+//	ta, _ := network.Transport("127.0.0.1:5060")
+//	tb, _ := network.Transport("127.0.0.2:5060")
+//	go srvA.ListenTransport(ta)
+//	go srvB.ListenTransport(tb)
+type MemoryNetwork struct {
+	rwm       *sync.RWMutex
+	endpoints map[string]*memoryTransport
+}
+
+// NewMemoryNetwork NewMemoryNetwork
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{rwm: &sync.RWMutex{}, endpoints: map[string]*memoryTransport{}}
+}
+
+// Transport 创建监听addr的内存传输，addr格式为ip:port，发往此地址的消息由该传输接收
+func (n *MemoryNetwork) Transport(addr string) (Transport, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, err
+	}
+	n.rwm.Lock()
+	defer n.rwm.Unlock()
+	if _, ok := n.endpoints[addr]; ok {
+		return nil, fmt.Errorf("memory address %s already in use", addr)
+	}
+	t := &memoryTransport{
+		network: n,
+		addr:    memoryAddr(addr),
+		inbox:   make(chan memoryPacket, 1024),
+		closed:  make(chan struct{}),
+		once:    &sync.Once{},
+	}
+	n.endpoints[addr] = t
+	return t, nil
+}
+
+func (n *MemoryNetwork) get(addr string) *memoryTransport {
+	n.rwm.RLock()
+	defer n.rwm.RUnlock()
+	return n.endpoints[addr]
+}
+
+func (n *MemoryNetwork) remove(t *memoryTransport) {
+	n.rwm.Lock()
+	if e, ok := n.endpoints[t.addr.String()]; ok && e == t {
+		delete(n.endpoints, t.addr.String())
+	}
+	n.rwm.Unlock()
+}
+
+// memoryAddr 内存传输地址，Network返回mem
+type memoryAddr string
+
+func (addr memoryAddr) Network() string {
+	return "mem"
+}
+
+func (addr memoryAddr) String() string {
+	return string(addr)
+}
+
+type memoryPacket struct {
+	data []byte
+	from net.Addr
+}
+
+// memoryTransport 内存传输，消息按发送顺序投递，不丢包，按可靠传输处理不做重传
+type memoryTransport struct {
+	network *MemoryNetwork
+	addr    memoryAddr
+	inbox   chan memoryPacket
+	closed  chan struct{}
+	once    *sync.Once
+}
+
+func (t *memoryTransport) Network() string {
+	return "MEM"
+}
+
+func (t *memoryTransport) LocalAddr() net.Addr {
+	return t.addr
+}
+
+func (t *memoryTransport) Serve(handle func(data []byte, raddr net.Addr)) error {
+	for {
+		select {
+		case p := <-t.inbox:
+			handle(p.data, p.from)
+		case <-t.closed:
+			return net.ErrClosed
+		}
+	}
+}
+
+func (t *memoryTransport) Connection(raddr net.Addr) (Connection, error) {
+	if raddr == nil {
+		return nil, fmt.Errorf("missing mem destination")
+	}
+	return &memoryConn{transport: t, raddr: raddr}, nil
+}
+
+func (t *memoryTransport) Close() error {
+	t.once.Do(func() {
+		close(t.closed)
+		t.network.remove(t)
+	})
+	return nil
+}
+
+// deliver 投递到本传输的收件箱
+func (t *memoryTransport) deliver(data []byte, from net.Addr) error {
+	select {
+	case <-t.closed:
+		return net.ErrClosed
+	default:
+	}
+	select {
+	case t.inbox <- memoryPacket{data: append([]byte{}, data...), from: from}:
+		return nil
+	case <-t.closed:
+		return net.ErrClosed
+	}
+}
+
+// memoryConn 发往某个内存地址的连接，只用于发送，接收由memoryTransport.Serve完成
+type memoryConn struct {
+	transport *memoryTransport
+	raddr     net.Addr
+}
+
+func (conn *memoryConn) Read(buf []byte) (int, error) {
+	return 0, fmt.Errorf("memory connection is write only")
+}
+
+func (conn *memoryConn) ReadFrom(buf []byte) (int, net.Addr, error) {
+	return 0, nil, fmt.Errorf("memory connection is write only")
+}
+
+func (conn *memoryConn) Write(buf []byte) (int, error) {
+	return conn.WriteTo(buf, conn.raddr)
+}
+
+func (conn *memoryConn) WriteTo(buf []byte, raddr net.Addr) (int, error) {
+	if raddr == nil {
+		raddr = conn.raddr
+	}
+	peer := conn.transport.network.get(raddr.String())
+	if peer == nil {
+		return 0, fmt.Errorf("memory address %s unreachable", raddr.String())
+	}
+	if err := peer.deliver(buf, conn.transport.addr); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (conn *memoryConn) Network() string {
+	return "MEM"
+}
+
+func (conn *memoryConn) LocalAddr() net.Addr {
+	return conn.transport.addr
+}
+
+func (conn *memoryConn) RemoteAddr() net.Addr {
+	return conn.raddr
+}
+
+func (conn *memoryConn) Close() error {
+	return nil
+}
+
+func (conn *memoryConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (conn *memoryConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (conn *memoryConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
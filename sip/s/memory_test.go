@@ -0,0 +1,330 @@
+package sip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newMemoryServer 创建监听内存地址的Server，测试结束时关闭
+func newMemoryServer(t *testing.T, network *MemoryNetwork, addr string) *Server {
+	t.Helper()
+	tp, err := network.Transport(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer()
+	srv.addTransport(tp)
+	go tp.Serve(srv.receive)
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// newMemoryRequest 生成发往to的请求，to为内存地址
+func newMemoryRequest(t *testing.T, method RequestMethod, from, to string, body []byte) *Request {
+	t.Helper()
+	fromURI, err := ParseURI(fmt.Sprintf("sip:34020000002000000001@%s", from))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toURI, err := ParseURI(fmt.Sprintf("sip:34020000001320000001@%s", to))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromAddr := &Address{URI: fromURI, Params: NewParams()}
+	toAddr := &Address{URI: toURI, Params: NewParams()}
+	hb := NewHeaderBuilder().SetFrom(fromAddr).SetTo(toAddr).AddVia(&ViaHop{
+		Params: NewParams().Add("branch", String{Str: GenerateBranch()}),
+	}).SetMethod(method).SetContact(fromAddr)
+	if len(body) > 0 {
+		hb.SetContentType(&ContentTypeXML)
+	}
+	req := NewRequest("", method, toAddr.URI, DefaultSipVersion, hb.Build(), body)
+	req.SetDestination(memoryAddr(to))
+	return req
+}
+
+func waitRequest(t *testing.T, ch chan *Request) *Request {
+	t.Helper()
+	select {
+	case req := <-ch:
+		return req
+	case <-time.After(2 * time.Second):
+		t.Fatal("request not received")
+	}
+	return nil
+}
+
+func TestMemoryMessage(t *testing.T) {
+	network := NewMemoryNetwork()
+	srvA := newMemoryServer(t, network, "127.0.0.1:5060")
+	srvB := newMemoryServer(t, network, "127.0.0.2:5060")
+	received := make(chan *Request, 1)
+	srvB.RegistHandler(MESSAGE, func(req *Request, tx *Transaction) {
+		received <- req
+		tx.Respond(NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+	})
+
+	body := []byte("<?xml version=\"1.0\"?><Query><CmdType>Catalog</CmdType></Query>")
+	tx, err := srvA.Request(newMemoryRequest(t, MESSAGE, "127.0.0.1:5060", "127.0.0.2:5060", body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tx.GetResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode())
+	}
+	req := waitRequest(t, received)
+	if string(req.Body()) != string(body) {
+		t.Fatalf("body %q, want %q", req.Body(), body)
+	}
+	if req.Source().String() != "127.0.0.1:5060" {
+		t.Fatalf("source %s, want 127.0.0.1:5060", req.Source())
+	}
+	if via, ok := req.ViaHop(); !ok || via.Transport != "MEM" {
+		t.Fatalf("via transport %v, want MEM", via)
+	}
+}
+
+func TestMemoryRegisterDigest(t *testing.T) {
+	network := NewMemoryNetwork()
+	srvA := newMemoryServer(t, network, "127.0.0.1:5060")
+	srvB := newMemoryServer(t, network, "127.0.0.2:5060")
+	const (
+		realm    = "3402000000"
+		password = "123456"
+	)
+	nonces := NewNonces(time.Minute)
+	srvB.RegistHandler(REGISTER, func(req *Request, tx *Transaction) {
+		from, _ := req.From()
+		user := from.Address.User().String()
+		if hdrs := req.GetHeaders("Authorization"); len(hdrs) > 0 {
+			auth := AuthFromValue(hdrs[0].(*GenericHeader).Contents)
+			auth.SetPassword(password)
+			auth.SetUsername(user)
+			auth.SetMethod(string(req.Method()))
+			auth.SetURI(auth.Get("uri"))
+			if auth.CalcResponse() == auth.Get("response") && nonces.Check(user, auth.Get("nonce"), auth.Get("nc")) == nil {
+				tx.Respond(NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+				return
+			}
+		}
+		resp := NewResponseFromRequest("", req, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized), nil)
+		resp.AppendHeader(&GenericHeader{HeaderName: "WWW-Authenticate", Contents: fmt.Sprintf("Digest nonce=\"%s\", algorithm=MD5, realm=\"%s\",qop=\"auth\"", nonces.New(user), realm)})
+		tx.Respond(resp)
+	})
+
+	register := func(authorization string) *Response {
+		t.Helper()
+		req := newMemoryRequest(t, REGISTER, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+		if authorization != "" {
+			req.AppendHeader(&GenericHeader{HeaderName: "Authorization", Contents: authorization})
+		}
+		tx, err := srvA.Request(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tx.GetResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := register("")
+	if resp.StatusCode() != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", resp.StatusCode())
+	}
+	challenge := AuthFromValue(resp.GetHeaders("WWW-Authenticate")[0].(*GenericHeader).Contents)
+	uri := "sip:34020000001320000001@127.0.0.2:5060"
+	authorization := func(nc string) string {
+		response := CalcResponse("34020000002000000001", realm, password, string(REGISTER), uri, challenge.Get("nonce"), "auth", "0a4f113b", nc)
+		return fmt.Sprintf("Digest username=\"34020000002000000001\", realm=\"%s\", nonce=\"%s\", uri=\"%s\", response=\"%s\", algorithm=MD5, qop=auth, nc=%s, cnonce=\"0a4f113b\"",
+			realm, challenge.Get("nonce"), uri, response, nc)
+	}
+	if resp = register(authorization("00000001")); resp.StatusCode() != http.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode())
+	}
+	// 重放相同nc的Authorization需要重新认证
+	if resp = register(authorization("00000001")); resp.StatusCode() != http.StatusUnauthorized {
+		t.Fatalf("replayed status %d, want 401", resp.StatusCode())
+	}
+}
+
+func TestMemoryInviteDialog(t *testing.T) {
+	network := NewMemoryNetwork()
+	srvA := newMemoryServer(t, network, "127.0.0.1:5060")
+	srvB := newMemoryServer(t, network, "127.0.0.2:5060")
+	acks := make(chan *Request, 1)
+	byes := make(chan *Request, 1)
+	var uas *Dialog
+	srvB.RegistHandler(INVITE, func(req *Request, tx *Transaction) {
+		resp := NewResponseFromRequest("", req, http.StatusOK, "OK", nil)
+		to, _ := resp.To()
+		to.Params = NewParams().Add("tag", String{Str: "uastag"})
+		contact, _ := ParseURI("sip:34020000001320000001@127.0.0.2:5060")
+		resp.AppendHeader(&ContactHeader{Address: contact, Params: NewParams()})
+		uas, _ = NewDialogFromRequest(req, resp)
+		tx.Respond(resp)
+	})
+	srvB.RegistHandler(ACK, func(req *Request, tx *Transaction) {
+		acks <- req
+	})
+	srvB.RegistHandler(BYE, func(req *Request, tx *Transaction) {
+		byes <- req
+		tx.Respond(NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+	})
+
+	invite := newMemoryRequest(t, INVITE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	tx, err := srvA.Request(invite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tx.GetResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialog, err := NewDialogFromResponse(invite, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialog.RemoteTag != "uastag" || dialog.RemoteTarget != "sip:34020000001320000001@127.0.0.2:5060" {
+		t.Fatalf("dialog remote tag %q target %q", dialog.RemoteTag, dialog.RemoteTarget)
+	}
+	ack, err := dialog.NewAck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Request(ack); err != nil {
+		t.Fatal(err)
+	}
+	if req := waitRequest(t, acks); !uas.Match(req) {
+		t.Fatal("ack does not match uas dialog")
+	}
+
+	bye, err := dialog.NewRequest(BYE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byeTX, err := srvA.Request(bye)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = byeTX.GetResponse(); err != nil || resp.StatusCode() != http.StatusOK {
+		t.Fatalf("bye response %v %v", resp, err)
+	}
+	req := waitRequest(t, byes)
+	if !uas.Match(req) {
+		t.Fatal("bye does not match uas dialog")
+	}
+	if cseq, _ := req.CSeq(); cseq.SeqNo != dialog.InviteSeq+1 {
+		t.Fatalf("bye cseq %d, want %d", cseq.SeqNo, dialog.InviteSeq+1)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	network := NewMemoryNetwork()
+	srvA := newMemoryServer(t, network, "127.0.0.1:5060")
+	tp, err := network.Transport("127.0.0.2:5060")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srvB := NewServer()
+	done := make(chan error, 1)
+	go func() { done <- srvB.ListenTransport(tp) }()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := srvB.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ListenTransport not returned after Close")
+	}
+	// 地址已释放，请求无法送达
+	if _, err := srvA.Request(newMemoryRequest(t, MESSAGE, "127.0.0.1:5060", "127.0.0.2:5060", nil)); err == nil {
+		t.Fatal("request to closed server succeeded")
+	}
+	// 关闭后收到的消息不会阻塞传输
+	srvB.receive([]byte("MESSAGE sip:a@b SIP/2.0\r\n\r\n"), memoryAddr("127.0.0.1:5060"))
+	if _, err := network.Transport("127.0.0.2:5060"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryRetransmission(t *testing.T) {
+	network := NewMemoryNetwork()
+	srv := newMemoryServer(t, network, "127.0.0.2:5060")
+	var handled int32
+	received, release := make(chan struct{}, 2), make(chan struct{})
+	srv.RegistHandler(MESSAGE, func(req *Request, tx *Transaction) {
+		atomic.AddInt32(&handled, 1)
+		received <- struct{}{}
+		<-release
+		tx.Respond(NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+	})
+	// 设备端直接使用传输层发送，模拟处理过程中重传同一请求
+	tp, err := network.Transport("127.0.0.1:5060")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	responses := make(chan string, 4)
+	go tp.Serve(func(data []byte, raddr net.Addr) { responses <- string(data) })
+	conn, err := tp.Connection(memoryAddr("127.0.0.2:5060"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := newMemoryRequest(t, MESSAGE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	req.SetBody(nil, true)
+	for i := 0; i < 2; i++ {
+		if _, err := conn.WriteTo([]byte(req.String()), req.Destination()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request not received")
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	select {
+	case resp := <-responses:
+		if !strings.HasPrefix(resp, "SIP/2.0 200") {
+			t.Fatalf("response %q, want 200", resp)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("response not received")
+	}
+	// 重传的请求由事务吸收，handler只执行一次
+	if n := atomic.LoadInt32(&handled); n != 1 {
+		t.Fatalf("handler run %d times, want 1", n)
+	}
+}
+
+func TestTXKeyMethod(t *testing.T) {
+	req := newMemoryRequest(t, MESSAGE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	bye := newMemoryRequest(t, BYE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	via, _ := req.ViaHop()
+	bvia, _ := bye.ViaHop()
+	bvia.Params = via.Params.Clone()
+	// 相同branch不同方法属于不同事务 RFC 3261 17.2.3
+	if getTXKey(bye) == getTXKey(req) {
+		t.Fatal("same key for different methods")
+	}
+	// 非2xx的ACK属于INVITE事务
+	invite := newMemoryRequest(t, INVITE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	ack := newAckRequest(invite, NewResponseFromRequest("", invite, http.StatusNotFound, "Not Found", nil))
+	if getTXKey(ack) != getTXKey(invite) {
+		t.Fatalf("ack key %s, want %s", getTXKey(ack), getTXKey(invite))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"strings"
 )
 
 // MessageID MessageID
@@ -231,6 +232,14 @@ func (uri *URI) SetHost(host string) {
 	uri.FHost = host
 }
 
+// formatHost ipv6地址使用[]包裹
+func formatHost(host string) string {
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
 // Generates the string representation of a SipUri struct.
 func (uri *URI) String() string {
 	var buffer bytes.Buffer
@@ -255,7 +264,7 @@ func (uri *URI) String() string {
 	}
 
 	// Compulsory hostname.
-	buffer.WriteString(uri.FHost)
+	buffer.WriteString(formatHost(uri.FHost))
 
 	// Optional port number.
 	if uri.FPort != nil {
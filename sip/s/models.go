@@ -137,7 +137,7 @@ var (
 	DeviceControlXML = `<?xml version="1.0"?>
 		<Control>
 		<CmdType>DeviceControl</CmdType>
-		<SN>17430</SN>
+		<SN>%d</SN>
 		<DeviceID>%s</DeviceID>
 		<PTZCmd>%s</PTZCmd>
 		<Info>
@@ -145,11 +145,40 @@ var (
 		</Control>
 		`
 
+	// PresetQueryXML 查询设备预置位xml样式
+	PresetQueryXML = `<?xml version="1.0" encoding="GB2312"?>
+		<Query>
+		<CmdType>PresetQuery</CmdType>
+		<SN>%d</SN>
+		<DeviceID>%s</DeviceID>
+		</Query>
+		`
+
+	// MobilePositionXML 订阅移动设备位置xml样式
+	MobilePositionXML = `<?xml version="1.0" encoding="GB2312"?>
+		<Query>
+		<CmdType>MobilePosition</CmdType>
+		<SN>%d</SN>
+		<DeviceID>%s</DeviceID>
+		<Interval>%d</Interval>
+		</Query>
+		`
+
+	// AlarmResponseXML 报警通知应答xml样式
+	AlarmResponseXML = `<?xml version="1.0" encoding="GB2312"?>
+		<Response>
+		<CmdType>Alarm</CmdType>
+		<SN>%d</SN>
+		<DeviceID>%s</DeviceID>
+		<Result>OK</Result>
+		</Response>
+		`
+
 	// DeviceStatusXML 查询设备状态xml样式
 	DeviceStatusXML = `<?xml version="1.0"?>
 		<Query>
 		<CmdType>DeviceStatus</CmdType>
-		<SN>17430</SN>
+		<SN>%d</SN>
 		<DeviceID>%s</DeviceID>
 		</Query>
 		`
@@ -239,13 +268,28 @@ func GetRecordInfoXML(id string, sceqNo int, start, end int64) []byte {
 }
 
 // GetDeviceControlXML 获取NVR下云台控制指令
-func GetDeviceControlXML(id, cmd string) string {
-	return fmt.Sprintf(DeviceControlXML, id, cmd)
+func GetDeviceControlXML(id, cmd string) []byte {
+	return []byte(fmt.Sprintf(DeviceControlXML, utils.RandInt(100000, 999999), id, cmd))
+}
+
+// GetPresetQueryXML 获取设备预置位查询指令
+func GetPresetQueryXML(id string, sn int) []byte {
+	return []byte(fmt.Sprintf(PresetQueryXML, sn, id))
+}
+
+// GetMobilePositionXML 获取移动设备位置订阅指令，interval为上报间隔，单位秒
+func GetMobilePositionXML(id string, sn, interval int) []byte {
+	return []byte(fmt.Sprintf(MobilePositionXML, sn, id, interval))
+}
+
+// GetAlarmResponseXML 获取报警通知应答
+func GetAlarmResponseXML(id string, sn int) []byte {
+	return []byte(fmt.Sprintf(AlarmResponseXML, sn, id))
 }
 
-// GetDeviceStatusXML 获取设备状态控制指令
-func GetDeviceStatusXML(id string) string {
-	return fmt.Sprintf(DeviceStatusXML, id)
+// GetDeviceStatusXML 获取设备状态查询指令
+func GetDeviceStatusXML(id string, sn int) []byte {
+	return []byte(fmt.Sprintf(DeviceStatusXML, sn, id))
 }
 
 // GetKeepAliveXML 发送心跳
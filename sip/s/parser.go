@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/panjjo/gosip/utils"
 	"github.com/sirupsen/logrus"
@@ -556,18 +557,21 @@ func parseRecordRouteHeader(headerName string, headerText string) (headers []Hea
 }
 
 type parser struct {
-	out    chan Message
-	in     chan Packet
-	isStop bool
+	out  chan Message
+	in   chan Packet
+	done chan struct{}
+	once sync.Once
 }
 
 func newParser() *parser {
-	p := &parser{out: make(chan Message), in: make(chan Packet)}
+	p := &parser{out: make(chan Message), in: make(chan Packet), done: make(chan struct{})}
 	go p.start()
 	return p
 }
+
+// stop 停止解析，解析协程退出
 func (p *parser) stop() {
-	p.isStop = true
+	p.once.Do(func() { close(p.done) })
 }
 
 func (p *parser) start() {
@@ -575,9 +579,13 @@ func (p *parser) start() {
 	var msg Message
 	var packet Packet
 
-	for !p.isStop {
+	for {
 		termErr = nil
-		packet = <-p.in
+		select {
+		case packet = <-p.in:
+		case <-p.done:
+			return
+		}
 		startLine, err := packet.nextLine()
 		if err != nil {
 			logrus.Errorln(err, "parserMessage", "getStartLine", startLine)
@@ -614,7 +622,7 @@ func (p *parser) start() {
 				if err == nil {
 					headers = append(headers, newHeaders...)
 				} else {
-					logrus.Warnf("skip header '%s' due to error: %s", buffer, err)
+					logrus.Warnf("skip header '%s' due to error: %s", buffer.String(), err)
 				}
 				buffer.Reset()
 			}
@@ -661,7 +669,11 @@ func (p *parser) start() {
 			msg.SetBody(body, false)
 		}
 		msg.SetSource(packet.raddr)
-		p.out <- msg
+		select {
+		case p.out <- msg:
+		case <-p.done:
+			return
+		}
 	}
 }
 
@@ -793,7 +805,7 @@ func ParseSipURI(uriStr string) (uri URI, err error) {
 	uriStrCopy := uriStr
 
 	// URI should start 'sip' or 'sips'. Check the first 3 chars.
-	if strings.ToLower(uriStr[:3]) != "sip" {
+	if len(uriStr) < 4 || strings.ToLower(uriStr[:3]) != "sip" {
 		err = fmt.Errorf("invalid SIP uri protocol name in '%s'", uriStrCopy)
 		return
 	}
@@ -806,7 +818,7 @@ func ParseSipURI(uriStr string) (uri URI, err error) {
 	}
 
 	// The 'sip' or 'sips' protocol name should be followed by a ':' character.
-	if uriStr[0] != ':' {
+	if len(uriStr) == 0 || uriStr[0] != ':' {
 		err = fmt.Errorf("no ':' after protocol name in SIP uri '%s'", uriStrCopy)
 		return
 	}
@@ -895,12 +907,39 @@ func ParseSipURI(uriStr string) (uri URI, err error) {
 // The port may or may not be present, so we represent it with a *uint16,
 // and return 'nil' if no port was present.
 func ParseHostPort(rawText string) (host string, port *Port, err error) {
+	// ipv6地址使用[]包裹，host中不保存[]
+	if strings.HasPrefix(rawText, "[") {
+		endIdx := strings.Index(rawText, "]")
+		if endIdx == -1 {
+			err = fmt.Errorf("missing ']' in host '%s'", rawText)
+			return
+		}
+		host = rawText[1:endIdx]
+		rawText = rawText[endIdx+1:]
+		if rawText == "" {
+			return
+		}
+		if rawText[0] != ':' {
+			err = fmt.Errorf("unexpected '%s' after ipv6 host '%s'", rawText, host)
+			return
+		}
+		return parsePort(host+rawText, len(host))
+	}
 	colonIdx := strings.Index(rawText, ":")
 	if colonIdx == -1 {
 		host = rawText
 		return
 	}
+	if strings.Count(rawText, ":") > 1 {
+		// 不带[]的ipv6地址，没有端口
+		host = rawText
+		return
+	}
+	return parsePort(rawText, colonIdx)
+}
 
+// parsePort rawText[colonIdx]为host与port的分隔符
+func parsePort(rawText string, colonIdx int) (host string, port *Port, err error) {
 	// Surely there must be a better way..!
 	var portRaw64 uint64
 	var portRaw16 uint16
@@ -0,0 +1,72 @@
+package sip
+
+import "testing"
+
+func TestParseHostPort(t *testing.T) {
+	cases := []struct {
+		raw, host string
+		port      int
+		err       bool
+	}{
+		{raw: "192.168.1.1", host: "192.168.1.1"},
+		{raw: "192.168.1.1:5060", host: "192.168.1.1", port: 5060},
+		{raw: "example.com:5061", host: "example.com", port: 5061},
+		{raw: "[2001:db8::1]", host: "2001:db8::1"},
+		{raw: "[2001:db8::1]:5060", host: "2001:db8::1", port: 5060},
+		{raw: "[::1]:15060", host: "::1", port: 15060},
+		{raw: "2001:db8::1", host: "2001:db8::1"},
+		{raw: "[2001:db8::1", err: true},
+		{raw: "[2001:db8::1]5060", err: true},
+		{raw: "[2001:db8::1]:port", err: true},
+	}
+	for _, c := range cases {
+		host, port, err := ParseHostPort(c.raw)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: want error", c.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.raw, err)
+			continue
+		}
+		if host != c.host {
+			t.Errorf("%s: host %s, want %s", c.raw, host, c.host)
+		}
+		if c.port == 0 && port != nil || c.port != 0 && (port == nil || int(*port) != c.port) {
+			t.Errorf("%s: port %v, want %d", c.raw, port, c.port)
+		}
+	}
+}
+
+func TestParseIPv6URI(t *testing.T) {
+	raw := "sip:34020000001320000001@[2001:db8::1]:5060"
+	uri, err := ParseSipURI(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.FHost != "2001:db8::1" || uri.FPort == nil || *uri.FPort != 5060 {
+		t.Fatalf("host %s port %v", uri.FHost, uri.FPort)
+	}
+	if got := uri.String(); got != raw {
+		t.Fatalf("uri %s, want %s", got, raw)
+	}
+}
+
+func TestParseIPv6Via(t *testing.T) {
+	headers, err := ParseHeader("Via: SIP/2.0/UDP [2001:db8::1]:5060;rport;branch=z9hG4bK776asdhds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	via, ok := headers[0].(ViaHeader)
+	if !ok || len(via) != 1 {
+		t.Fatalf("headers %v", headers)
+	}
+	if via[0].Host != "2001:db8::1" {
+		t.Fatalf("host %s, want 2001:db8::1", via[0].Host)
+	}
+	if got := via[0].SentBy(); got != "[2001:db8::1]:5060" {
+		t.Fatalf("sent-by %s, want [2001:db8::1]:5060", got)
+	}
+}
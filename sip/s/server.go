@@ -1,10 +1,16 @@
 package sip
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/panjjo/gosip/utils"
 	"github.com/sirupsen/logrus"
@@ -13,8 +19,6 @@ import (
 var (
 	bufferSize uint16 = 65535 - 20 - 8 // IPv4 max size - IPv4 Header size - UDP Header size
 	// bufferSize     uint16 = 65535 - 20 - 8 // IPv4 max size - IPv4 Header size - UDP Header size
-	srvParser      *parser
-	LoAddr, ReAddr net.Addr
 )
 
 // RequestHandler RequestHandler
@@ -23,7 +27,15 @@ type RequestHandler func(req *Request, tx *Transaction)
 // Server Server
 type Server struct {
 	udpaddr net.Addr
-	conn    Connection
+	// raddr 级联上级平台地址
+	raddr net.Addr
+	// conn 级联使用的udp连接
+	conn Connection
+	// transports 传输层，按协议(UDP TCP TLS MEM)索引
+	transports map[string]Transport
+	tmu        *sync.RWMutex
+	tlsConfig  *tls.Config
+	parser     *parser
 
 	txs *transacionts
 
@@ -32,42 +44,149 @@ type Server struct {
 
 	port *Port
 	host net.IP
+
+	// mtu udp发送请求的大小上限，超过时改用tcp
+	mtu int
+	// tcpFailed 超过mtu改用tcp发送失败的地址和失败时间，一段时间内直接使用udp
+	tcpFailed map[string]time.Time
+	fmu       *sync.Mutex
 }
 
 // NewServer NewServer
 func NewServer() *Server {
-	activeTX = &transacionts{txs: map[string]*Transaction{}, rwm: &sync.RWMutex{}}
 	srv := &Server{
 		hmu:             &sync.RWMutex{},
-		txs:             activeTX,
+		txs:             newTransactions(),
 		requestHandlers: map[RequestMethod]RequestHandler{},
+		transports:      map[string]Transport{},
+		tmu:             &sync.RWMutex{},
+		parser:          newParser(),
+		mtu:             defaultMTU,
+		tcpFailed:       map[string]time.Time{},
+		fmu:             &sync.Mutex{},
 	}
+	go srv.handlerListen(srv.parser.out)
 	return srv
 }
 
 // CasNewServer CasNewServer
 func CasNewServer() *Server {
-	casActTX = &transacionts{txs: map[string]*Transaction{}, rwm: &sync.RWMutex{}}
-	srv := &Server{
-		hmu:             &sync.RWMutex{},
-		txs:             casActTX,
-		requestHandlers: map[RequestMethod]RequestHandler{},
-	}
-	return srv
+	return NewServer()
+}
+
+// LocalAddr 本地udp监听地址
+func (s *Server) LocalAddr() net.Addr {
+	return s.udpaddr
+}
+
+// RemoteAddr 级联上级平台地址
+func (s *Server) RemoteAddr() net.Addr {
+	return s.raddr
 }
 
-//	func (s *Server) newTX(key string) *Transaction {
-//		return s.txs.newTX(key, s.conn)
-//	}
 func (s *Server) getTX(key string) *Transaction {
 	return s.txs.getTX(key)
 }
-func (s *Server) mustTX(key string) *Transaction {
-	tx := s.txs.getTX(key)
-	if tx == nil {
-		tx = s.txs.newTX(key, s.conn)
+
+// receive 传输层收到的消息交给解析器
+func (s *Server) receive(data []byte, raddr net.Addr) {
+	select {
+	case s.parser.in <- newPacket(data, raddr):
+	case <-s.parser.done:
+	}
+}
+
+// Close 关闭所有传输，停止解析和消息处理协程
+func (s *Server) Close() error {
+	s.parser.stop()
+	s.tmu.Lock()
+	defer s.tmu.Unlock()
+	var err error
+	for network, t := range s.transports {
+		if cerr := t.Close(); cerr != nil {
+			err = utils.NewError(cerr, "close", network, "transport failed")
+		}
+		delete(s.transports, network)
+	}
+	return err
+}
+
+// ListenTransport 使用传输层收发消息，阻塞直到传输关闭
+func (s *Server) ListenTransport(t Transport) error {
+	s.addTransport(t)
+	return t.Serve(s.receive)
+}
+
+func (s *Server) addTransport(t Transport) {
+	s.tmu.Lock()
+	s.transports[t.Network()] = t
+	s.tmu.Unlock()
+	if s.host != nil && s.port != nil {
+		return
 	}
-	return tx
+	// 未指定本机地址时使用传输监听地址
+	if laddr := t.LocalAddr(); laddr != nil {
+		if host, port, err := net.SplitHostPort(laddr.String()); err == nil {
+			if p, err := strconv.Atoi(port); err == nil && s.port == nil {
+				s.port = NewPort(p)
+			}
+			if ip := net.ParseIP(host); ip != nil && s.host == nil {
+				s.host = ip
+			}
+		}
+	}
+}
+
+func (s *Server) transport(network string) (Transport, bool) {
+	s.tmu.RLock()
+	defer s.tmu.RUnlock()
+	t, ok := s.transports[network]
+	return t, ok
+}
+
+// connection 根据传输协议获取发往raddr的连接，tcp/tls优先复用对端已建立的连接，不存在时主动建立连接
+func (s *Server) connection(transport string, raddr net.Addr) (Connection, error) {
+	network := strings.ToUpper(transport)
+	t, ok := s.transport(network)
+	if !ok {
+		switch network {
+		case "TCP":
+			// 未监听tcp时也允许主动连接设备
+			s.tmu.Lock()
+			if t, ok = s.transports[network]; !ok {
+				t = newStreamTransport("TCP", nil, dialTCP, newTCPConnection, s.receive)
+				s.transports[network] = t
+			}
+			s.tmu.Unlock()
+		case "TLS", "MEM":
+			// tls设备只允许通过tls发送，不做降级
+			return nil, fmt.Errorf("%s server not listening", strings.ToLower(network))
+		default:
+			if t, ok = s.transport("UDP"); !ok {
+				return nil, fmt.Errorf("udp server not listening")
+			}
+		}
+	}
+	return t.Connection(raddr)
+}
+
+func dialTCP(raddr net.Addr) (net.Conn, error) {
+	return net.DialTimeout("tcp", raddr.String(), 5*time.Second)
+}
+
+// defaultMTU udp发送请求的默认大小上限 RFC 3261 18.1.1
+const defaultMTU = 1300
+
+// SetMTU 设置udp发送请求的大小上限，超过时改用tcp，为0保持默认值。需在开始监听前设置
+func (s *Server) SetMTU(mtu int) {
+	if mtu > 0 {
+		s.mtu = mtu
+	}
+}
+
+// SetTimers 设置事务定时器T1 T2 T4，为0的保持默认值，只影响之后新建的事务
+func (s *Server) SetTimers(t1, t2, t4 time.Duration) {
+	s.txs.setTimers(t1, t2, t4)
 }
 
 // ListenUDPServer ListenUDPServer
@@ -77,7 +196,7 @@ func (s *Server) ListenUDPServer(addr string) {
 		logrus.Fatal("net.ResolveUDPAddr err", err, addr)
 	}
 	s.port = NewPort(udpaddr.Port)
-	s.host, err = utils.ResolveSelfIP()
+	s.host, err = resolveHost(udpaddr.IP)
 	if err != nil {
 		logrus.Fatal("net.ListenUDP resolveip err", err, addr)
 	}
@@ -85,63 +204,101 @@ func (s *Server) ListenUDPServer(addr string) {
 	if err != nil {
 		logrus.Fatal("net.ListenUDP err", err, addr)
 	}
-	s.conn = newUDPConnection(udp)
-	var (
-		raddr net.Addr
-		num   int
-	)
-	buf := make([]byte, bufferSize)
-	parser := newParser()
-	defer parser.stop()
-	go s.handlerListen(parser.out)
-	for {
-		num, raddr, err = s.conn.ReadFrom(buf)
+	s.ListenTransport(newUDPTransport(newUDPConnection(udp)))
+}
+
+// ListenTCPServer ListenTCPServer
+func (s *Server) ListenTCPServer(addr string) {
+	tcpaddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		logrus.Fatal("net.ResolveTCPAddr err", err, addr)
+	}
+	if s.port == nil {
+		s.port = NewPort(tcpaddr.Port)
+	}
+	if s.host == nil {
+		s.host, err = resolveHost(tcpaddr.IP)
 		if err != nil {
-			logrus.Errorln("udp.ReadFromUDP err", err)
-			continue
+			logrus.Fatal("net.ListenTCP resolveip err", err, addr)
 		}
-		parser.in <- newPacket(append([]byte{}, buf[:num]...), raddr)
 	}
+	listener, err := net.ListenTCP("tcp", tcpaddr)
+	if err != nil {
+		logrus.Fatal("net.ListenTCP err", err, addr)
+	}
+	s.ListenTransport(newStreamTransport("TCP", listener, dialTCP, newTCPConnection, s.receive))
 }
 
-/*
-// ListenUDPServer ListenUDPServer
-func (s *Server) ListenCasUDPServer(raddr, laddr string) {
-	lAddr, err := net.ResolveUDPAddr("udp", laddr)
+// ListenTLSServer ListenTLSServer
+func (s *Server) ListenTLSServer(addr string, config *tls.Config) {
+	tcpaddr, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
-		logrus.Fatalf("CreateUDPServer resolve local addr failed, addr=%s, err=%s", laddr, err.Error())
+		logrus.Fatal("net.ResolveTCPAddr err", err, addr)
+	}
+	if s.port == nil {
+		s.port = NewPort(tcpaddr.Port)
 	}
-	s.udpaddr = lAddr
-	s.port = NewPort(lAddr.Port)
-	s.host, err = utils.ResolveSelfIP()
+	if s.host == nil {
+		s.host, err = resolveHost(tcpaddr.IP)
+		if err != nil {
+			logrus.Fatal("tls.Listen resolveip err", err, addr)
+		}
+	}
+	s.tlsConfig = config
+	listener, err := tls.Listen("tcp", addr, config)
 	if err != nil {
-		logrus.Fatalf("CreateUDPServer resolveip failed, addr=%s, err=%s", laddr, err.Error())
+		logrus.Fatal("tls.Listen err", err, addr)
 	}
+	dial := func(raddr net.Addr) (net.Conn, error) {
+		return tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", raddr.String(), s.clientTLSConfig())
+	}
+	s.ListenTransport(newStreamTransport("TLS", listener, dial, newTLSConnection, s.receive))
+}
 
-	rAddr, err := net.ResolveUDPAddr("udp", raddr)
-	if err != nil {
-		logrus.Fatalf("CreateUDPServer resolve remote addr failed, addr=%s, err=%s", raddr, err.Error())
+// resolveHost 监听地址对应的本机地址，ipv4取本机ipv4地址，ipv6指定了ip时直接使用，监听[::]时取本机ipv6地址
+func resolveHost(ip net.IP) (net.IP, error) {
+	if ip == nil || ip.To4() != nil {
+		return utils.ResolveSelfIP()
 	}
-	udp, err := net.DialUDP("udp", lAddr, rAddr)
-	if err != nil {
-		logrus.Fatalf("CreateUDPServer dialudp failed, laddr=%s, raddr=%s, err=%s", laddr, raddr, err.Error())
+	if ip.IsUnspecified() {
+		return utils.ResolveSelfIPv6()
 	}
-	s.conn = newUDPConnection(udp)
-	srvParser := newParser()
+	return ip, nil
+}
 
-	defer srvParser.stop()
-	buf := make([]byte, bufferSize)
-	go s.handlerListen(srvParser.out)
+// clientTLSConfig 主动连接设备时使用的tls配置
+func (s *Server) clientTLSConfig() *tls.Config {
+	config := &tls.Config{Certificates: s.tlsConfig.Certificates}
+	if s.tlsConfig.ClientCAs != nil {
+		config.RootCAs = s.tlsConfig.ClientCAs
+	} else {
+		// 未配置ca时不校验设备证书，与监听端一致
+		config.InsecureSkipVerify = true
+	}
+	return config
+}
 
-	for {
-		num, readdr, err := s.conn.ReadFrom(buf)
+// NewTLSConfig 加载证书生成tls配置，caFile不为空时要求并校验设备证书
+func NewTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, utils.NewError(err, "load tls cert failed, cert:", certFile, "key:", keyFile)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
 		if err != nil {
-			logrus.Errorf("ListenUDPServer read data failed, err=%s, data=%s", err.Error(), string(buf))
-			continue
+			return nil, utils.NewError(err, "read tls ca failed, ca:", caFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid tls ca file %s", caFile)
 		}
-		srvParser.in <- newPacket(buf[:num], readdr)
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
 	}
-}*/
+	return config, nil
+}
 
 // RegistHandler RegistHandler
 func (s *Server) RegistHandler(method RequestMethod, handler RequestHandler) {
@@ -152,7 +309,11 @@ func (s *Server) RegistHandler(method RequestMethod, handler RequestHandler) {
 func (s *Server) handlerListen(msgs chan Message) {
 	var msg Message
 	for {
-		msg = <-msgs
+		select {
+		case msg = <-msgs:
+		case <-s.parser.done:
+			return
+		}
 		switch tmsg := msg.(type) {
 		case *Request:
 			req := tmsg
@@ -168,11 +329,39 @@ func (s *Server) handlerListen(msgs chan Message) {
 	}
 }
 func (s *Server) handlerRequest(msg *Request) {
-	tx := s.mustTX(getTXKey(msg))
+	key := getTXKey(msg)
+	if tx := s.getTX(key); tx != nil && !tx.client {
+		// 重传的请求或非2xx的ACK由事务处理，handler不再重复执行
+		logrus.Traceln("receive retransmission from:", msg.Source(), ",method:", msg.Method(), "txKey:", key)
+		tx.receiveRequest(msg)
+		return
+	}
+	// 响应通过请求到达的连接返回
+	conn, err := s.connection(msg.Source().Network(), msg.Source())
+	if err != nil {
+		logrus.Errorln("get connection failed,", err, msg.Source())
+		return
+	}
+	var tx *Transaction
+	if msg.IsAck() {
+		// 2xx的ACK不属于任何事务，直接交给handler
+		tx = newServerTransaction(key, conn, msg, s.txs.getTimers())
+	} else {
+		tx = s.txs.newServerTX(key, conn, msg)
+	}
 	logrus.Traceln("receive request from:", msg.Source(), ",method:", msg.Method(), "txKey:", tx.key, "message: \n", msg.String())
+	if msg.IsCancel() {
+		// CANCEL由协议栈直接响应，注册了CANCEL handler的继续交给handler做业务清理
+		if !s.handlerCancel(msg, tx) {
+			return
+		}
+	}
 	s.hmu.RLock()
 	handler, ok := s.requestHandlers[msg.Method()]
 	s.hmu.RUnlock()
+	if !ok && msg.IsCancel() {
+		return
+	}
 	if !ok {
 		logrus.Errorln("not found handler func,requestMethod:", msg.Method(), msg.String())
 		go handlerMethodNotAllowed(msg, tx)
@@ -182,9 +371,24 @@ func (s *Server) handlerRequest(msg *Request) {
 	go handler(msg, tx)
 }
 
+// handlerCancel 查找CANCEL对应的INVITE服务端事务，回复CANCEL 200并对INVITE回复487 RFC 3261 9.2
+// 找不到INVITE事务时回复481，返回false
+func (s *Server) handlerCancel(msg *Request, tx *Transaction) bool {
+	inviteKey := strings.TrimSuffix(tx.key, string(CANCEL)) + string(INVITE)
+	inviteTX := s.getTX(inviteKey)
+	if inviteTX == nil || inviteTX.client || !inviteTX.invite {
+		logrus.Infoln("not found invite tx for cancel, txKey:", tx.key)
+		tx.Respond(NewResponseFromRequest("", msg, 481, "Call/Transaction Does Not Exist", nil))
+		return false
+	}
+	tx.Respond(NewResponseFromRequest("", msg, http.StatusOK, http.StatusText(http.StatusOK), nil))
+	inviteTX.receiveCancel()
+	return true
+}
+
 func (s *Server) handlerResponse(msg *Response) {
 	tx := s.getTX(getTXKey(msg))
-	if tx == nil {
+	if tx == nil || !tx.client {
 		logrus.Infoln("not found tx. receive response from:", msg.Source(), "message: \n", msg.String())
 	} else {
 		logrus.Traceln("receive response from:", msg.Source(), "txKey:", tx.key, "message: \n", msg.String())
@@ -206,60 +410,72 @@ func (s *Server) Request(req *Request) (*Transaction, error) {
 	if !viaHop.Params.Has("rport") {
 		viaHop.Params.Add("rport", nil)
 	}
+	if dest := req.Destination(); dest != nil {
+		switch dest.Network() {
+		case "tls", "mem":
+			// 通过tls注册的设备只能通过tls发送，内存地址只能通过内存传输发送
+			viaHop.Transport = strings.ToUpper(dest.Network())
+		}
+	}
+	if strings.EqualFold(viaHop.Transport, "UDP") && len(req.String()) > s.mtu && s.tcpAvailable(req.Destination()) {
+		// 超过mtu的请求改用tcp发送 RFC 3261 18.1.1，设备不支持tcp时仍使用udp
+		viaHop.Transport = "TCP"
+		conn, err := s.connection(viaHop.Transport, req.Destination())
+		if err == nil {
+			tx := s.txs.newClientTX(getTXKey(req), conn, req)
+			return tx, tx.start()
+		}
+		logrus.Warnln("request exceeds mtu, send by tcp failed, fallback to udp,", err)
+		s.tcpFail(req.Destination())
+		viaHop.Transport = "UDP"
+	}
 
-	tx := s.mustTX(getTXKey(req))
-	return tx, tx.Request(req)
+	conn, err := s.connection(viaHop.Transport, req.Destination())
+	if err != nil {
+		return nil, err
+	}
+	tx := s.txs.newClientTX(getTXKey(req), conn, req)
+	return tx, tx.start()
 }
 
-func handlerMethodNotAllowed(req *Request, tx *Transaction) {
-	resp := NewResponseFromRequest("", req, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), []byte{})
-	tx.Respond(resp)
-}
+// tcp连接失败后，该时长内超过mtu的请求不再尝试tcp
+var tcpRetryInterval = 5 * time.Minute
 
-/*
-// Request Request
-func (s *Server) CasRequest(req *Request) (*Transaction, error) {
-	viaHop, ok := req.ViaHop()
-	if !ok {
-		return nil, errors.New("missing required 'Via' header")
+// tcpAvailable 发往raddr的请求是否尝试tcp，最近tcp连接失败的地址直接使用udp
+func (s *Server) tcpAvailable(raddr net.Addr) bool {
+	if raddr == nil {
+		return false
 	}
-	viaHop.Host = s.host.String()
-	viaHop.Port = s.port
-	if viaHop.Params == nil {
-		viaHop.Params = NewParams().Add("branch", String{Str: GenerateBranch()})
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+	failed, ok := s.tcpFailed[raddr.String()]
+	if !ok {
+		return true
 	}
-	if !viaHop.Params.Has("rport") {
-		viaHop.Params.Add("rport", nil)
+	if time.Since(failed) > tcpRetryInterval {
+		delete(s.tcpFailed, raddr.String())
+		return true
 	}
-
-	tx := s.mustTX(getTXKey(req))
-	return tx, tx.CasRequest(req)
+	return false
 }
 
-func (s *Server) CasSipResponse(tx *Transaction) (*Response, error) {
-	response := tx.GetResponse()
-	if response == nil {
-		return nil, utils.NewError(nil, "response timeout, tx key:", tx.Key())
+// tcpFail 记录tcp连接失败的地址
+func (s *Server) tcpFail(raddr net.Addr) {
+	if raddr == nil {
+		return
 	}
-	if response.StatusCode() != http.StatusOK {
-		return response, utils.NewError(nil, "response fail, code=", response.StatusCode(), ", reason=", response.Reason(), ", tx key:", tx.Key())
+	now := time.Now()
+	s.fmu.Lock()
+	defer s.fmu.Unlock()
+	for k, failed := range s.tcpFailed {
+		if now.Sub(failed) > tcpRetryInterval {
+			delete(s.tcpFailed, k)
+		}
 	}
-	return response, nil
+	s.tcpFailed[raddr.String()] = now
 }
 
-func (s *Server) CasWrite(buf []byte) (int, error) {
-	num, err := s.conn.Write(buf)
-	return num, err
-}
-
-func (s *Server) CasNewPacket(data []byte, raddr net.Addr) {
-	srvParser.in <- newPacket(data, raddr)
+func handlerMethodNotAllowed(req *Request, tx *Transaction) {
+	resp := NewResponseFromRequest("", req, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed), []byte{})
+	tx.Respond(resp)
 }
-
-func (s *Server) GetCasRegResponse(tx *Transaction) (*Response, error) {
-	response := tx.GetResponse()
-	if response == nil {
-		return nil, utils.NewError(nil, "response timeout, tx key:", tx.Key())
-	}
-	return response, nil
-}*/
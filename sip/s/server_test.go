@@ -0,0 +1,125 @@
+package sip
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeUDPTransport 记录udp发送的消息
+type fakeUDPTransport struct {
+	conn *udpConn
+}
+
+func (t *fakeUDPTransport) Network() string { return "UDP" }
+
+func (t *fakeUDPTransport) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5060}
+}
+
+func (t *fakeUDPTransport) Serve(handle func(data []byte, raddr net.Addr)) error { return nil }
+
+func (t *fakeUDPTransport) Connection(raddr net.Addr) (Connection, error) { return t.conn, nil }
+
+func (t *fakeUDPTransport) Close() error { return nil }
+
+// newMTUServer 只有udp传输的Server，发往dest的请求超过mtu时改用tcp
+func newMTUServer(t *testing.T, mtu int) (*Server, *udpConn) {
+	t.Helper()
+	srv := NewServer()
+	srv.SetMTU(mtu)
+	conn := &udpConn{}
+	srv.addTransport(&fakeUDPTransport{conn: conn})
+	t.Cleanup(func() { srv.Close() })
+	return srv, conn
+}
+
+func newMTURequest(t *testing.T, dest net.Addr, size int) *Request {
+	t.Helper()
+	req := newMemoryRequest(t, MESSAGE, "127.0.0.1:5060", dest.String(), []byte(strings.Repeat("a", size)))
+	req.SetDestination(dest)
+	return req
+}
+
+func TestRequestMTU(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if data, err := readStreamMessage(bufio.NewReader(conn)); err == nil {
+			received <- string(data)
+		}
+	}()
+	srv, udp := newMTUServer(t, 1000)
+	port := listener.Addr().(*net.TCPAddr).Port
+	dest := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+
+	// 未超过mtu仍使用udp
+	if _, err := srv.Request(newMTURequest(t, dest, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if n := udp.count("MESSAGE"); n != 1 {
+		t.Fatalf("small request sent %d times by udp, want 1", n)
+	}
+	// 超过mtu改用tcp，Via中的传输协议同步修改
+	if _, err := srv.Request(newMTURequest(t, dest, 1200)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if !strings.Contains(data, "SIP/2.0/TCP") {
+			t.Fatalf("tcp request via %q, want TCP", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("large request not received by tcp")
+	}
+	if n := udp.count("MESSAGE"); n != 1 {
+		t.Fatalf("large request sent by udp")
+	}
+}
+
+func TestRequestMTUFallback(t *testing.T) {
+	// 获取一个没有监听的端口，tcp连接失败
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	srv, udp := newMTUServer(t, 1000)
+	dest := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+
+	// tcp失败时仍使用udp发送，并记录失败的地址
+	if _, err := srv.Request(newMTURequest(t, dest, 1200)); err != nil {
+		t.Fatal(err)
+	}
+	if n := udp.count("MESSAGE"); n != 1 {
+		t.Fatalf("request sent %d times by udp, want 1", n)
+	}
+	udp.mu.Lock()
+	via := udp.writes[0]
+	udp.mu.Unlock()
+	if !strings.Contains(via, "SIP/2.0/UDP") {
+		t.Fatal("fallback request via is not UDP")
+	}
+	if srv.tcpAvailable(dest) {
+		t.Fatal("failed tcp destination still available")
+	}
+	// 失败记录过期后重新尝试tcp
+	srv.fmu.Lock()
+	srv.tcpFailed[dest.String()] = time.Now().Add(-tcpRetryInterval - time.Second)
+	srv.fmu.Unlock()
+	if !srv.tcpAvailable(dest) {
+		t.Fatal("expired tcp failure not cleared")
+	}
+}
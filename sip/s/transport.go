@@ -0,0 +1,197 @@
+package sip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/panjjo/gosip/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Transport sip传输层，Server通过Transport收发消息，不直接依赖socket
+type Transport interface {
+	// Network 传输协议，UDP TCP TLS MEM，与Via中的transport对应
+	Network() string
+	// LocalAddr 本地监听地址
+	LocalAddr() net.Addr
+	// Serve 接收消息，每个完整的sip消息调用一次handle，阻塞直到传输关闭
+	Serve(handle func(data []byte, raddr net.Addr)) error
+	// Connection 获取发往raddr的连接
+	Connection(raddr net.Addr) (Connection, error)
+	// Close 关闭传输
+	Close() error
+}
+
+// udpTransport udp传输，所有对端共用一个连接
+type udpTransport struct {
+	conn Connection
+}
+
+func newUDPTransport(conn Connection) *udpTransport {
+	return &udpTransport{conn: conn}
+}
+
+func (t *udpTransport) Network() string {
+	return "UDP"
+}
+
+func (t *udpTransport) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+func (t *udpTransport) Serve(handle func(data []byte, raddr net.Addr)) error {
+	buf := make([]byte, bufferSize)
+	for {
+		num, raddr, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			logrus.Errorln("udp.ReadFromUDP err", err)
+			continue
+		}
+		handle(append([]byte{}, buf[:num]...), raddr)
+	}
+}
+
+func (t *udpTransport) Connection(raddr net.Addr) (Connection, error) {
+	return t.conn, nil
+}
+
+func (t *udpTransport) Close() error {
+	return t.conn.Close()
+}
+
+// streamTransport 面向连接的传输(tcp/tls)，按对端地址复用连接，没有连接时主动建立
+type streamTransport struct {
+	network  string
+	listener net.Listener
+	conns    *streamConnections
+	dial     func(raddr net.Addr) (net.Conn, error)
+	wrap     func(baseConn net.Conn) Connection
+	handle   func(data []byte, raddr net.Addr)
+	// hl 保护handle，主动建立的连接可能在Serve之前开始读取
+	hl *sync.RWMutex
+	// dialing 正在建立的连接，同一对端并发请求只建立一个连接
+	dialing map[string]chan struct{}
+	dl      *sync.Mutex
+}
+
+func newStreamTransport(network string, listener net.Listener, dial func(raddr net.Addr) (net.Conn, error), wrap func(baseConn net.Conn) Connection, handle func(data []byte, raddr net.Addr)) *streamTransport {
+	return &streamTransport{
+		network:  network,
+		listener: listener,
+		conns:    newStreamConnections(),
+		dial:     dial,
+		wrap:     wrap,
+		handle:   handle,
+		hl:       &sync.RWMutex{},
+		dialing:  map[string]chan struct{}{},
+		dl:       &sync.Mutex{},
+	}
+}
+
+func (t *streamTransport) Network() string {
+	return t.network
+}
+
+func (t *streamTransport) LocalAddr() net.Addr {
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Addr()
+}
+
+func (t *streamTransport) Serve(handle func(data []byte, raddr net.Addr)) error {
+	if t.listener == nil {
+		return fmt.Errorf("%s transport not listening", t.network)
+	}
+	t.hl.Lock()
+	t.handle = handle
+	t.hl.Unlock()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			logrus.Errorln(t.network, "accept err", err)
+			continue
+		}
+		c := t.wrap(conn)
+		t.conns.store(c)
+		go t.serveConn(c)
+	}
+}
+
+func (t *streamTransport) Connection(raddr net.Addr) (Connection, error) {
+	if raddr == nil {
+		return nil, fmt.Errorf("missing %s destination", t.network)
+	}
+	if conn := t.conns.get(raddr); conn != nil {
+		return conn, nil
+	}
+	key := raddr.String()
+	t.dl.Lock()
+	if wait, ok := t.dialing[key]; ok {
+		// 等待正在建立的连接
+		t.dl.Unlock()
+		<-wait
+		if conn := t.conns.get(raddr); conn != nil {
+			return conn, nil
+		}
+		return nil, fmt.Errorf("dial %s failed, addr: %s", t.network, key)
+	}
+	done := make(chan struct{})
+	t.dialing[key] = done
+	t.dl.Unlock()
+	defer func() {
+		t.dl.Lock()
+		delete(t.dialing, key)
+		close(done)
+		t.dl.Unlock()
+	}()
+	baseConn, err := t.dial(raddr)
+	if err != nil {
+		return nil, utils.NewError(err, "dial", t.network, "failed, addr:", key)
+	}
+	conn := t.wrap(baseConn)
+	// 启动读取前保存连接，后续请求直接复用
+	t.conns.store(conn)
+	go t.serveConn(conn)
+	return conn, nil
+}
+
+func (t *streamTransport) Close() error {
+	t.conns.closeAll()
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Close()
+}
+
+// serveConn 读取tcp/tls连接上的sip消息，连接断开后移除
+func (t *streamTransport) serveConn(conn Connection) {
+	defer func() {
+		t.conns.remove(conn)
+		conn.Close()
+	}()
+	reader := bufio.NewReaderSize(conn, int(bufferSize))
+	for {
+		data, err := readStreamMessage(reader)
+		if err != nil {
+			if err != io.EOF {
+				logrus.Warnln("stream read message err", err, conn.RemoteAddr())
+			}
+			return
+		}
+		t.hl.RLock()
+		handle := t.handle
+		t.hl.RUnlock()
+		handle(data, conn.RemoteAddr())
+	}
+}
@@ -1,6 +1,8 @@
 package sip
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
@@ -9,18 +11,76 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-var activeTX, casActTX *transacionts
+var (
+	// ErrTransactionTimeout 事务超时，未收到最终响应(Timer B/F)
+	ErrTransactionTimeout = errors.New("transaction timeout")
+	// ErrTransactionTerminated 事务已结束
+	ErrTransactionTerminated = errors.New("transaction terminated")
+	// ErrTransactionCompleted 事务已有最终响应，不能再取消或响应
+	ErrTransactionCompleted = errors.New("transaction completed")
+)
+
+// timers 事务定时器 RFC 3261 17.1.1.1
+type timers struct {
+	// t1 RTT预估值
+	t1 time.Duration
+	// t2 非INVITE请求和INVITE响应的最大重传间隔
+	t2 time.Duration
+	// t4 消息在网络中的最大存活时间
+	t4 time.Duration
+}
+
+func defaultTimers() timers {
+	return timers{t1: 500 * time.Millisecond, t2: 4 * time.Second, t4: 5 * time.Second}
+}
 
 type transacionts struct {
-	txs map[string]*Transaction
-	rwm *sync.RWMutex
+	txs    map[string]*Transaction
+	timers timers
+	rwm    *sync.RWMutex
+}
+
+func newTransactions() *transacionts {
+	return &transacionts{txs: map[string]*Transaction{}, timers: defaultTimers(), rwm: &sync.RWMutex{}}
+}
+
+// setTimers 设置新建事务使用的定时器，为0的保持原值
+func (txs *transacionts) setTimers(t1, t2, t4 time.Duration) {
+	txs.rwm.Lock()
+	defer txs.rwm.Unlock()
+	if t1 > 0 {
+		txs.timers.t1 = t1
+	}
+	if t2 > 0 {
+		txs.timers.t2 = t2
+	}
+	if t4 > 0 {
+		txs.timers.t4 = t4
+	}
 }
 
-func (txs *transacionts) newTX(key string, conn Connection) *Transaction {
-	tx := NewTransaction(key, conn)
+// getTimers 新建事务使用的定时器
+func (txs *transacionts) getTimers() timers {
+	txs.rwm.RLock()
+	defer txs.rwm.RUnlock()
+	return txs.timers
+}
+
+func (txs *transacionts) newClientTX(key string, conn Connection, req *Request) *Transaction {
 	txs.rwm.Lock()
+	defer txs.rwm.Unlock()
+	tx := newClientTransaction(key, conn, req, txs.timers)
+	tx.txs = txs
+	txs.txs[key] = tx
+	return tx
+}
+
+func (txs *transacionts) newServerTX(key string, conn Connection, req *Request) *Transaction {
+	txs.rwm.Lock()
+	defer txs.rwm.Unlock()
+	tx := newServerTransaction(key, conn, req, txs.timers)
+	tx.txs = txs
 	txs.txs[key] = tx
-	txs.rwm.Unlock()
 	return tx
 }
 
@@ -36,23 +96,95 @@ func (txs *transacionts) getTX(key string) *Transaction {
 
 func (txs *transacionts) rmTX(tx *Transaction) {
 	txs.rwm.Lock()
-	delete(txs.txs, tx.key)
+	if t, ok := txs.txs[tx.key]; ok && t == tx {
+		delete(txs.txs, tx.key)
+	}
 	txs.rwm.Unlock()
 }
 
-// Transaction 代表一个通讯信道
+// txState 事务状态 RFC 3261 17
+type txState int
+
+const (
+	txStateCalling txState = iota
+	txStateTrying
+	txStateProceeding
+	txStateCompleted
+	// txStateConfirmed INVITE服务端事务收到非2xx最终响应的ACK
+	txStateConfirmed
+	// txStateAccepted INVITE收到或发送2xx后吸收重传 RFC 6026
+	txStateAccepted
+	txStateTerminated
+)
+
+// Transaction 代表一个sip事务
 type Transaction struct {
-	conn   Connection
+	conn Connection
+	// txs 事务所属的事务表
+	txs    *transacionts
 	key    string
+	origin *Request
+	client bool
+	invite bool
+	state  txState
 	resp   chan *Response
-	active chan int
+	err    error
+	// ack INVITE最终响应对应的ACK，收到重传的最终响应时重发
+	ack *Request
+	// lastResp 服务端事务最后发送的响应，收到重传的请求时重发
+	lastResp *Response
+	// cancel INVITE已请求取消，未收到临时响应时等收到后再发送CANCEL
+	cancel, cancelSent bool
+	// respClosed 响应通道已关闭，超时取消后事务仍需等待487回复ACK
+	respClosed bool
+
+	// timers 事务创建时服务的定时器设置
+	timers   timers
+	mu       *sync.Mutex
+	interval time.Duration
+	// retrans 重传定时器(Timer A/E/G)，timeout 超时定时器(Timer B/F/H)，terminate 结束定时器(Timer D/K/I/J)
+	retrans, timeout, terminate *time.Timer
 }
 
-// NewTransaction 表示新创建一个Transaction
-func NewTransaction(key string, conn Connection) *Transaction {
-	logrus.Traceln("new tx", key, time.Now().Format("2006-01-02 15:04:05"))
-	tx := &Transaction{conn: conn, key: key, resp: make(chan *Response, 10), active: make(chan int, 1)}
-	go tx.watch()
+func newClientTransaction(key string, conn Connection, req *Request, timers timers) *Transaction {
+	logrus.Traceln("new client tx", key, time.Now().Format("2006-01-02 15:04:05"))
+	tx := &Transaction{
+		conn:   conn,
+		key:    key,
+		origin: req,
+		client: true,
+		invite: req.IsInvite(),
+		resp:   make(chan *Response, 10),
+		timers: timers,
+		mu:     &sync.Mutex{},
+	}
+	if tx.invite {
+		tx.state = txStateCalling
+	} else {
+		tx.state = txStateTrying
+	}
+	return tx
+}
+
+func newServerTransaction(key string, conn Connection, req *Request, timers timers) *Transaction {
+	logrus.Traceln("new server tx", key, time.Now().Format("2006-01-02 15:04:05"))
+	tx := &Transaction{
+		conn:   conn,
+		key:    key,
+		origin: req,
+		invite: req.IsInvite(),
+		state:  txStateTrying,
+		resp:   make(chan *Response, 10),
+		timers: timers,
+		mu:     &sync.Mutex{},
+	}
+	// handler未响应时的兜底，INVITE需要等待设备或用户处理，给出较长时间
+	wait := 64 * tx.timers.t1
+	if tx.invite {
+		tx.state = txStateProceeding
+		wait = 3 * time.Minute
+	}
+	tx.terminate = time.AfterFunc(wait, tx.Close)
 	return tx
 }
 
@@ -61,91 +193,460 @@ func (tx *Transaction) Key() string {
 	return tx.key
 }
 
-func (tx *Transaction) watch() {
-	for {
-		select {
-		case <-tx.active:
-			logrus.Traceln("active tx", tx.Key(), time.Now().Format("2006-01-02 15:04:05"))
-		case <-time.After(20 * time.Second):
-			tx.Close()
-			logrus.Traceln("watch closed tx", tx.key, time.Now().Format("2006-01-02 15:04:05"))
+// Origin 事务的原始请求
+func (tx *Transaction) Origin() *Request {
+	return tx.origin
+}
+
+// Error 事务结束的原因
+func (tx *Transaction) Error() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.err
+}
+
+// reliable 是否可靠传输(tcp/tls)，可靠传输不需要重传
+func (tx *Transaction) reliable() bool {
+	return tx.conn.Network() != "UDP"
+}
+
+// start 发送事务请求，启动重传和超时定时器
+func (tx *Transaction) start() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if err := tx.write(tx.origin); err != nil {
+		tx.err = err
+		tx.terminateLocked()
+		return err
+	}
+	if !tx.reliable() {
+		tx.interval = tx.timers.t1
+		tx.retrans = time.AfterFunc(tx.interval, tx.retransmit)
+	}
+	tx.timeout = time.AfterFunc(64*tx.timers.t1, tx.timeoutFired)
+	return nil
+}
+
+// retransmit Timer A/E 触发，重传请求
+func (tx *Transaction) retransmit() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	switch tx.state {
+	case txStateCalling:
+		// INVITE 间隔每次翻倍
+		tx.interval *= 2
+	case txStateTrying:
+		tx.interval *= 2
+		if tx.interval > tx.timers.t2 {
+			tx.interval = tx.timers.t2
+		}
+	case txStateProceeding:
+		if tx.invite {
 			return
 		}
+		// 非INVITE收到临时响应后按T2间隔重传
+		tx.interval = tx.timers.t2
+	default:
+		return
+	}
+	logrus.Traceln("retransmit request, txkey:", tx.key)
+	if err := tx.write(tx.origin); err != nil {
+		logrus.Warnln("retransmit request failed, txkey:", tx.key, err)
 	}
+	tx.retrans = time.AfterFunc(tx.interval, tx.retransmit)
 }
 
-// GetResponse GetResponse
-func (tx *Transaction) GetResponse() *Response {
-	for {
-		res := <-tx.resp
-		if res == nil {
-			return res
+// timeoutFired Timer B/F 触发，超时未收到最终响应
+func (tx *Transaction) timeoutFired() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	switch tx.state {
+	case txStateCalling, txStateTrying, txStateProceeding:
+		// INVITE在Proceeding状态继续计时，防止设备只回复100 Trying时调用方无限等待
+		tx.err = fmt.Errorf("%w after %s, txkey: %s", ErrTransactionTimeout, 64*tx.timers.t1, tx.key)
+		if tx.invite && tx.state == txStateProceeding {
+			// 设备已收到INVITE，发送CANCEL，事务保留到收到487并回复ACK
+			tx.sendCancelLocked()
+			tx.closeResp()
+			tx.terminate = time.AfterFunc(64*tx.timers.t1, tx.Close)
+			return
 		}
-		tx.active <- 2
+		tx.terminateLocked()
+	}
+}
+
+// GetResponse 获取最终响应，跳过临时响应，事务超时或结束时返回错误
+func (tx *Transaction) GetResponse() (*Response, error) {
+	for res := range tx.resp {
 		logrus.Traceln("response tx", tx.key, time.Now().Format("2006-01-02 15:04:05"))
-		if res.StatusCode() == http.StatusContinue || res.statusCode == http.StatusSwitchingProtocols {
+		if res.StatusCode() < http.StatusOK {
 			// Trying and Dialog Establishement 等待下一个返回
 			continue
 		}
-		return res
+		return res, nil
 	}
+	if err := tx.Error(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w, txkey: %s", ErrTransactionTerminated, tx.key)
 }
 
 // Close Close
 func (tx *Transaction) Close() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.terminateLocked()
+}
+
+func (tx *Transaction) terminateLocked() {
+	if tx.state == txStateTerminated {
+		return
+	}
 	logrus.Traceln("closed tx", tx.key, time.Now().Format("2006-01-02 15:04:05"))
-	activeTX.rmTX(tx)
-	close(tx.resp)
-	close(tx.active)
+	tx.state = txStateTerminated
+	for _, timer := range []*time.Timer{tx.retrans, tx.timeout, tx.terminate} {
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	if tx.txs != nil {
+		tx.txs.rmTX(tx)
+	}
+	tx.closeResp()
 }
 
-// Response Response
+func (tx *Transaction) closeResp() {
+	if !tx.respClosed {
+		tx.respClosed = true
+		close(tx.resp)
+	}
+}
+
+// receiveResponse 客户端事务收到响应 RFC 3261 17.1.1.2 17.1.2.2
 func (tx *Transaction) receiveResponse(msg *Response) {
-	defer func() {
-		if r := recover(); r != nil {
-			logrus.Errorln("send to closed channel, txkey:", tx.key, "message: \n", msg.String())
-		}
-	}()
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
 	logrus.Traceln("receiveResponse tx", tx.Key(), time.Now().Format("2006-01-02 15:04:05"))
-	tx.resp <- msg
-	tx.active <- 1
+	code := msg.StatusCode()
+	switch {
+	case tx.state == txStateTerminated:
+		return
+	case code < http.StatusOK:
+		if tx.state != txStateCalling && tx.state != txStateTrying && tx.state != txStateProceeding {
+			return
+		}
+		tx.state = txStateProceeding
+		if tx.invite && tx.retrans != nil {
+			tx.retrans.Stop()
+		}
+		if tx.cancel {
+			// 收到临时响应后才能发送CANCEL RFC 3261 9.1
+			tx.sendCancelLocked()
+		}
+		tx.deliver(msg)
+	case tx.invite && code < http.StatusMultipleChoices:
+		if tx.state == txStateAccepted {
+			// 重传的2xx，重发ACK
+			if tx.ack != nil {
+				tx.write(tx.ack)
+			}
+			return
+		}
+		tx.complete(txStateAccepted, 64*tx.timers.t1)
+		tx.deliver(msg)
+	case tx.invite:
+		if tx.state == txStateCompleted {
+			tx.write(tx.ack)
+			return
+		}
+		// 非2xx的最终响应由事务发送ACK
+		tx.ack = newAckRequest(tx.origin, msg)
+		if err := tx.write(tx.ack); err != nil {
+			logrus.Warnln("send ack failed, txkey:", tx.key, err)
+		}
+		tx.complete(txStateCompleted, 32*time.Second)
+		tx.deliver(msg)
+	default:
+		if tx.state == txStateCompleted {
+			return
+		}
+		tx.complete(txStateCompleted, tx.timers.t4)
+		tx.deliver(msg)
+	}
 }
 
-// Respond Respond
-func (tx *Transaction) Respond(res *Response) error {
-	logrus.Traceln("send response,to:", res.dest.String(), "txkey:", tx.key, "message: \n", res.String())
-	_, err := tx.conn.WriteTo([]byte(res.String()), res.dest)
+// complete 收到最终响应，停止重传和超时定时器，等待wait后结束事务，可靠传输立即结束
+func (tx *Transaction) complete(state txState, wait time.Duration) {
+	tx.state = state
+	if tx.retrans != nil {
+		tx.retrans.Stop()
+	}
+	if tx.timeout != nil {
+		tx.timeout.Stop()
+	}
+	if tx.reliable() && state == txStateCompleted {
+		wait = 0
+	}
+	if tx.terminate != nil {
+		tx.terminate.Stop()
+	}
+	tx.terminate = time.AfterFunc(wait, tx.Close)
+}
+
+func (tx *Transaction) deliver(msg *Response) {
+	if tx.respClosed {
+		return
+	}
+	select {
+	case tx.resp <- msg:
+	default:
+		logrus.Warnln("response chan is full, drop response, txkey:", tx.key, "message: \n", msg.String())
+	}
+}
+
+func (tx *Transaction) write(msg Message) error {
+	if len(msg.GetHeaders("Content-Length")) == 0 {
+		// 流式传输依赖Content-Length切分消息
+		msg.SetBody(msg.Body(), true)
+	}
+	logrus.Traceln("send message,to:", msg.Destination(), "txkey:", tx.key, "message: \n", msg.String())
+	_, err := tx.conn.WriteTo([]byte(msg.String()), msg.Destination())
 	return err
 }
 
-// Request Request
+// Respond 服务端事务发送响应 RFC 3261 17.2.1 17.2.2
+func (tx *Transaction) Respond(res *Response) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if !tx.client && tx.lastResp != nil && tx.lastResp.StatusCode() >= http.StatusOK {
+		// 已发送最终响应(如收到CANCEL后回复的487)，不再发送其他响应
+		return fmt.Errorf("%w, txkey: %s", ErrTransactionCompleted, tx.key)
+	}
+	if tx.client || tx.state == txStateTerminated || tx.state == txStateConfirmed {
+		return tx.write(res)
+	}
+	tx.lastResp = res
+	code := res.StatusCode()
+	switch {
+	case code < http.StatusOK:
+		tx.state = txStateProceeding
+	case tx.invite && code < http.StatusMultipleChoices:
+		tx.respondFinal(txStateAccepted, 64*tx.timers.t1)
+	case tx.invite:
+		// 等待ACK，不可靠传输重传响应(Timer G)，超时结束(Timer H)
+		tx.respondFinal(txStateCompleted, 64*tx.timers.t1)
+		if !tx.reliable() {
+			tx.interval = tx.timers.t1
+			tx.retrans = time.AfterFunc(tx.interval, tx.retransmitResponse)
+		}
+	default:
+		wait := 64 * tx.timers.t1
+		if tx.reliable() {
+			wait = 0
+		}
+		tx.respondFinal(txStateCompleted, wait)
+	}
+	return tx.write(res)
+}
+
+func (tx *Transaction) respondFinal(state txState, wait time.Duration) {
+	tx.state = state
+	if tx.terminate != nil {
+		tx.terminate.Stop()
+	}
+	tx.terminate = time.AfterFunc(wait, tx.Close)
+}
+
+// retransmitResponse Timer G 触发，重传INVITE的非2xx最终响应
+func (tx *Transaction) retransmitResponse() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.state != txStateCompleted {
+		return
+	}
+	if err := tx.write(tx.lastResp); err != nil {
+		logrus.Warnln("retransmit response failed, txkey:", tx.key, err)
+	}
+	tx.interval *= 2
+	if tx.interval > tx.timers.t2 {
+		tx.interval = tx.timers.t2
+	}
+	tx.retrans = time.AfterFunc(tx.interval, tx.retransmitResponse)
+}
+
+// receiveRequest 服务端事务收到重传的请求或非2xx的ACK，不再交给handler处理
+func (tx *Transaction) receiveRequest(req *Request) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if req.IsAck() {
+		if tx.invite && tx.state == txStateCompleted {
+			if tx.retrans != nil {
+				tx.retrans.Stop()
+			}
+			wait := tx.timers.t4
+			if tx.reliable() {
+				wait = 0
+			}
+			tx.respondFinal(txStateConfirmed, wait)
+		}
+		return
+	}
+	switch tx.state {
+	case txStateProceeding, txStateCompleted, txStateAccepted:
+		if tx.lastResp != nil {
+			logrus.Traceln("resend last response for retransmission, txkey:", tx.key)
+			tx.write(tx.lastResp)
+		}
+	}
+}
+
+// Request 在事务上发送请求，用于INVITE 2xx的ACK
 func (tx *Transaction) Request(req *Request) error {
-	logrus.Traceln("send request,to:", req.dest.String(), "txkey:", tx.key, "message: \n", req.String())
-	_, err := tx.conn.WriteTo([]byte(req.String()), req.dest)
-	return err
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if req.IsAck() {
+		tx.ack = req
+	}
+	return tx.write(req)
 }
 
-// 根据Message获取Call-ID
-func getTXKey(msg Message) (key string) {
-	callid, ok := msg.CallID()
-	if ok {
-		key = callid.String()
+// Cancel 取消INVITE客户端事务 RFC 3261 9.1
+// 已收到临时响应时立即发送CANCEL，否则收到临时响应后再发送，设备回复487后事务正常结束
+// 已收到最终响应时返回ErrTransactionCompleted，2xx需要调用方发送BYE结束会话
+func (tx *Transaction) Cancel() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if !tx.client || !tx.invite {
+		return fmt.Errorf("only client invite transaction can be cancelled, txkey: %s", tx.key)
+	}
+	switch tx.state {
+	case txStateCalling:
+		tx.cancel = true
+		return nil
+	case txStateProceeding:
+		tx.sendCancelLocked()
+		return nil
+	}
+	return fmt.Errorf("%w, txkey: %s", ErrTransactionCompleted, tx.key)
+}
+
+// sendCancelLocked 发送CANCEL，CANCEL是独立的非INVITE客户端事务
+func (tx *Transaction) sendCancelLocked() {
+	if tx.cancelSent {
+		return
+	}
+	tx.cancel, tx.cancelSent = true, true
+	cancel := newCancelRequest(tx.origin)
+	var ctx *Transaction
+	if tx.txs != nil {
+		ctx = tx.txs.newClientTX(getTXKey(cancel), tx.conn, cancel)
 	} else {
-		key = utils.RandString(10)
+		ctx = newClientTransaction(getTXKey(cancel), tx.conn, cancel, tx.timers)
+	}
+	logrus.Infoln("send cancel, txkey:", tx.key)
+	if err := ctx.start(); err != nil {
+		logrus.Warnln("send cancel failed, txkey:", tx.key, err)
 	}
-	return
 }
 
-// CasRequest Request
-func (tx *Transaction) CasRequest(req *Request) error {
-	_, err := tx.conn.Write([]byte(req.String())) // 发送到相机地址
-	// utils.CusLog.Debugf("CasRequest write msg:\n%s, \nerr=%+v", req.String(), err)
-	return err
+// receiveCancel INVITE服务端事务收到CANCEL，尚未发送最终响应时回复487 RFC 3261 9.2
+func (tx *Transaction) receiveCancel() {
+	res := NewResponseFromRequest("", tx.origin, 487, "Request Terminated", nil)
+	if to, ok := res.To(); ok {
+		if to.Params == nil {
+			to.Params = NewParams()
+		}
+		if !to.Params.Has("tag") {
+			to.Params.Add("tag", String{Str: utils.RandString(10)})
+		}
+	}
+	if err := tx.Respond(res); err != nil {
+		logrus.Infoln("receive cancel after final response, txkey:", tx.key, err)
+	}
+}
+
+// newCancelRequest CANCEL请求，Request-URI、Via、Call-ID、From、To和CSeq序号与INVITE相同 RFC 3261 9.1
+func newCancelRequest(inviteRequest *Request) *Request {
+	cancelRequest := NewRequest(
+		"",
+		CANCEL,
+		inviteRequest.Recipient(),
+		inviteRequest.SipVersion(),
+		[]Header{},
+		[]byte{},
+	)
+	if viaHop, ok := inviteRequest.ViaHop(); ok {
+		cancelRequest.AppendHeader(ViaHeader{viaHop.Clone()})
+	}
+	CopyHeaders("Route", inviteRequest, cancelRequest)
+	CopyHeaders("From", inviteRequest, cancelRequest)
+	CopyHeaders("To", inviteRequest, cancelRequest)
+	CopyHeaders("Call-ID", inviteRequest, cancelRequest)
+	if cseq, ok := inviteRequest.CSeq(); ok {
+		cancelRequest.AppendHeader(&CSeq{SeqNo: cseq.SeqNo, MethodName: CANCEL})
+	}
+	maxForwards := MaxForwards(70)
+	cancelRequest.AppendHeader(&maxForwards)
+	cancelRequest.SetSource(inviteRequest.Source())
+	cancelRequest.SetDestination(inviteRequest.Destination())
+	return cancelRequest
+}
+
+// newAckRequest 非2xx最终响应的ACK RFC 3261 17.1.1.3
+func newAckRequest(inviteRequest *Request, inviteResponse *Response) *Request {
+	ackRequest := NewRequest(
+		"",
+		ACK,
+		inviteRequest.Recipient(),
+		inviteRequest.SipVersion(),
+		[]Header{},
+		[]byte{},
+	)
+	if viaHop, ok := inviteRequest.ViaHop(); ok {
+		ackRequest.AppendHeader(ViaHeader{viaHop.Clone()})
+	}
+	CopyHeaders("Route", inviteRequest, ackRequest)
+	CopyHeaders("From", inviteRequest, ackRequest)
+	CopyHeaders("To", inviteResponse, ackRequest)
+	CopyHeaders("Call-ID", inviteRequest, ackRequest)
+	if cseq, ok := inviteRequest.CSeq(); ok {
+		ackRequest.AppendHeader(&CSeq{SeqNo: cseq.SeqNo, MethodName: ACK})
+	}
+	maxForwards := MaxForwards(70)
+	ackRequest.AppendHeader(&maxForwards)
+	ackRequest.SetSource(inviteRequest.Source())
+	ackRequest.SetDestination(inviteRequest.Destination())
+	return ackRequest
+}
+
+// getTXKey 事务key，使用via branch、sent-by和cseq method RFC 3261 17.1.3 17.2.3
+func getTXKey(msg Message) (key string) {
+	var branch, sentBy, method string
+	if viaHop, ok := msg.ViaHop(); ok && viaHop.Params != nil {
+		if b, ok := viaHop.Params.Get("branch"); ok && b != nil {
+			branch = b.String()
+		}
+		sentBy = viaHop.SentBy()
+	}
+	if branch == "" {
+		// 不兼容RFC 3261的branch，退化为call-id
+		if callid, ok := msg.CallID(); ok {
+			branch = callid.String()
+		} else {
+			branch = utils.RandString(10)
+		}
+	}
+	if cseq, ok := msg.CSeq(); ok {
+		method = string(cseq.MethodName)
+	}
+	if method == string(ACK) {
+		// 非2xx的ACK属于INVITE事务
+		method = string(INVITE)
+	}
+	return branch + "|" + sentBy + "|" + method
 }
 
 // CasResponse Response
 func (tx *Transaction) CasResponse(res *Response) error {
-	_, err := tx.conn.Write([]byte(res.String()))
-	// utils.CusLog.Debugf("CasResponse write msg:\n%s, \nerr=%+v", res.String(), err)
-	return err
+	return tx.Respond(res)
 }
@@ -0,0 +1,395 @@
+package sip
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// udpConn 记录写出的消息，模拟不可靠传输
+type udpConn struct {
+	net.Conn
+	mu     sync.Mutex
+	writes []string
+}
+
+func (c *udpConn) Network() string { return "UDP" }
+
+func (c *udpConn) ReadFrom(buf []byte) (int, net.Addr, error) { return 0, nil, net.ErrClosed }
+
+func (c *udpConn) WriteTo(buf []byte, raddr net.Addr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes = append(c.writes, string(buf))
+	return len(buf), nil
+}
+
+// count 以method开头的消息个数，method为请求方法或"SIP/2.0 <code>"
+func (c *udpConn) count(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, w := range c.writes {
+		if strings.HasPrefix(w, method+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+// fastTransactions 缩短定时器的事务表，测试结束后结束所有事务
+func fastTransactions(t *testing.T, t1, t2, t4 time.Duration) *transacionts {
+	t.Helper()
+	txs := newTransactions()
+	txs.setTimers(t1, t2, t4)
+	t.Cleanup(func() { closeTransactions(txs) })
+	return txs
+}
+
+func newTestTX(t *testing.T, txs *transacionts, method RequestMethod) (*Transaction, *udpConn) {
+	t.Helper()
+	conn := &udpConn{}
+	req := newMemoryRequest(t, method, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	return txs.newClientTX(getTXKey(req), conn, req), conn
+}
+
+// closeTransactions 结束事务表中的所有事务，包括事务内部发起的CANCEL
+func closeTransactions(txs *transacionts) {
+	txs.rwm.RLock()
+	list := make([]*Transaction, 0, len(txs.txs))
+	for _, tx := range txs.txs {
+		list = append(list, tx)
+	}
+	txs.rwm.RUnlock()
+	for _, tx := range list {
+		tx.Close()
+	}
+}
+
+func TestTXRetransmit(t *testing.T) {
+	tx, conn := newTestTX(t, fastTransactions(t, 10*time.Millisecond, 40*time.Millisecond, 50*time.Millisecond), INVITE)
+	if err := tx.start(); err != nil {
+		t.Fatal(err)
+	}
+	// Timer A: 0, 10, 30, 70ms
+	time.Sleep(85 * time.Millisecond)
+	if n := conn.count("INVITE"); n < 3 {
+		t.Fatalf("invite sent %d times, want at least 3", n)
+	}
+	// 收到临时响应后INVITE停止重传
+	tx.receiveResponse(NewResponseFromRequest("", tx.Origin(), 100, "Trying", nil))
+	n := conn.count("INVITE")
+	time.Sleep(100 * time.Millisecond)
+	if m := conn.count("INVITE"); m != n {
+		t.Fatalf("invite retransmitted after 100 Trying: %d -> %d", n, m)
+	}
+}
+
+func TestTXTimeout(t *testing.T) {
+	tx, conn := newTestTX(t, fastTransactions(t, 2*time.Millisecond, 8*time.Millisecond, 10*time.Millisecond), MESSAGE)
+	if err := tx.start(); err != nil {
+		t.Fatal(err)
+	}
+	// Timer B/F 64*T1 后结束
+	if _, err := tx.GetResponse(); !errors.Is(err, ErrTransactionTimeout) {
+		t.Fatalf("err %v, want ErrTransactionTimeout", err)
+	}
+	if n := conn.count("MESSAGE"); n < 2 {
+		t.Fatalf("message sent %d times, want retransmits", n)
+	}
+}
+
+func TestTXCancelAfterProvisional(t *testing.T) {
+	tx, conn := newTestTX(t, fastTransactions(t, 50*time.Millisecond, 0, 0), INVITE)
+	if err := tx.start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	// Calling状态不能发送CANCEL RFC 3261 9.1
+	if n := conn.count("CANCEL"); n != 0 {
+		t.Fatalf("cancel sent before provisional response")
+	}
+	tx.receiveResponse(NewResponseFromRequest("", tx.Origin(), 100, "Trying", nil))
+	if n := conn.count("CANCEL"); n != 1 {
+		t.Fatalf("cancel sent %d times, want 1", n)
+	}
+	tx.receiveResponse(NewResponseFromRequest("", tx.Origin(), 487, "Request Terminated", nil))
+	if resp, err := tx.GetResponse(); err != nil || resp.StatusCode() != 487 {
+		t.Fatalf("response %v %v, want 487", resp, err)
+	}
+	if err := tx.Cancel(); !errors.Is(err, ErrTransactionCompleted) {
+		t.Fatalf("cancel after final response err %v", err)
+	}
+}
+
+func TestTXAckNon2xx(t *testing.T) {
+	tx, conn := newTestTX(t, fastTransactions(t, 50*time.Millisecond, 0, 0), INVITE)
+	if err := tx.start(); err != nil {
+		t.Fatal(err)
+	}
+	resp := NewResponseFromRequest("", tx.Origin(), http.StatusNotFound, "Not Found", nil)
+	to, _ := resp.To()
+	to.Params = NewParams().Add("tag", String{Str: "uastag"})
+	tx.receiveResponse(resp)
+	if n := conn.count("ACK"); n != 1 {
+		t.Fatalf("ack sent %d times, want 1", n)
+	}
+	ack := tx.ack
+	if to, _ := ack.To(); !strings.Contains(to.String(), "uastag") {
+		t.Fatalf("ack To %s, want response to tag", to)
+	}
+	if getTXKey(ack) != tx.Key() {
+		t.Fatalf("ack key %s, want %s", getTXKey(ack), tx.Key())
+	}
+	// 重传的最终响应重发ACK，不再交给调用方
+	tx.receiveResponse(resp)
+	if n := conn.count("ACK"); n != 2 {
+		t.Fatalf("ack sent %d times, want 2", n)
+	}
+	if got, err := tx.GetResponse(); err != nil || got.StatusCode() != http.StatusNotFound {
+		t.Fatalf("response %v %v, want 404", got, err)
+	}
+	if len(tx.resp) != 0 {
+		t.Fatal("retransmitted response delivered")
+	}
+}
+
+func TestTXServerRetransmission(t *testing.T) {
+	conn := &udpConn{}
+	req := newMemoryRequest(t, MESSAGE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	tx := fastTransactions(t, 50*time.Millisecond, 0, 0).newServerTX(getTXKey(req), conn, req)
+	if err := tx.Respond(NewResponseFromRequest("", req, http.StatusOK, "OK", nil)); err != nil {
+		t.Fatal(err)
+	}
+	tx.receiveRequest(req)
+	if n := conn.count("SIP/2.0 200"); n != 2 {
+		t.Fatalf("200 sent %d times, want 2", n)
+	}
+	if err := tx.Respond(NewResponseFromRequest("", req, http.StatusInternalServerError, "", nil)); !errors.Is(err, ErrTransactionCompleted) {
+		t.Fatalf("second final response err %v", err)
+	}
+}
+
+func TestMemoryCancel(t *testing.T) {
+	network := NewMemoryNetwork()
+	srvA := newMemoryServer(t, network, "127.0.0.1:5060")
+	srvB := newMemoryServer(t, network, "127.0.0.2:5060")
+	ringing := make(chan struct{})
+	srvB.RegistHandler(INVITE, func(req *Request, tx *Transaction) {
+		tx.Respond(NewResponseFromRequest("", req, 180, "Ringing", nil))
+		close(ringing)
+	})
+
+	tx, err := srvA.Request(newMemoryRequest(t, INVITE, "127.0.0.1:5060", "127.0.0.2:5060", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ringing:
+	case <-time.After(2 * time.Second):
+		t.Fatal("invite not received")
+	}
+	if err := tx.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tx.GetResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode() != 487 {
+		t.Fatalf("status %d, want 487", resp.StatusCode())
+	}
+}
+
+func TestServerSetTimers(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.SetTimers(100*time.Millisecond, 0, time.Second)
+	srv.SetMTU(0)
+	req := newMemoryRequest(t, MESSAGE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	tx := srv.txs.newClientTX(getTXKey(req), &udpConn{}, req)
+	defer tx.Close()
+	// 为0的保持默认值
+	want := timers{t1: 100 * time.Millisecond, t2: defaultTimers().t2, t4: time.Second}
+	if tx.timers != want {
+		t.Fatalf("timers %+v, want %+v", tx.timers, want)
+	}
+	if srv.mtu != defaultMTU {
+		t.Fatalf("mtu %d, want %d", srv.mtu, defaultMTU)
+	}
+	// 其他服务不受影响
+	other := NewServer()
+	defer other.Close()
+	if other.txs.getTimers() != defaultTimers() {
+		t.Fatalf("other server timers %+v", other.txs.getTimers())
+	}
+}
+
+// tcpConn 可靠传输，事务不重传
+type tcpConn struct {
+	udpConn
+}
+
+func (c *tcpConn) Network() string { return "TCP" }
+
+// getState 加锁读取事务状态
+func (tx *Transaction) getState() txState {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.state
+}
+
+func TestTXNonInviteRetransmit(t *testing.T) {
+	txs := fastTransactions(t, 5*time.Millisecond, 20*time.Millisecond, 30*time.Millisecond)
+	tx, conn := newTestTX(t, txs, MESSAGE)
+	if err := tx.start(); err != nil {
+		t.Fatal(err)
+	}
+	// Timer E 间隔翻倍，不超过T2
+	time.Sleep(60 * time.Millisecond)
+	tx.mu.Lock()
+	interval := tx.interval
+	tx.mu.Unlock()
+	if interval != 20*time.Millisecond {
+		t.Fatalf("retransmit interval %s, want T2", interval)
+	}
+	// 收到临时响应后非INVITE继续按T2重传
+	tx.receiveResponse(NewResponseFromRequest("", tx.Origin(), 100, "Trying", nil))
+	if s := tx.getState(); s != txStateProceeding {
+		t.Fatalf("state %d, want proceeding", s)
+	}
+	n := conn.count("MESSAGE")
+	time.Sleep(50 * time.Millisecond)
+	if m := conn.count("MESSAGE"); m <= n {
+		t.Fatalf("message not retransmitted in proceeding: %d -> %d", n, m)
+	}
+	// 最终响应停止重传，Timer K 后结束并移出事务表
+	tx.receiveResponse(NewResponseFromRequest("", tx.Origin(), http.StatusOK, "OK", nil))
+	if resp, err := tx.GetResponse(); err != nil || resp.StatusCode() != http.StatusOK {
+		t.Fatalf("response %v %v, want 200", resp, err)
+	}
+	n = conn.count("MESSAGE")
+	time.Sleep(60 * time.Millisecond)
+	if m := conn.count("MESSAGE"); m != n {
+		t.Fatalf("message retransmitted after final response: %d -> %d", n, m)
+	}
+	if s := tx.getState(); s != txStateTerminated {
+		t.Fatalf("state %d, want terminated after Timer K", s)
+	}
+	if txs.getTX(tx.Key()) != nil {
+		t.Fatal("terminated transaction still stored")
+	}
+}
+
+func TestTXReliable(t *testing.T) {
+	txs := fastTransactions(t, 5*time.Millisecond, 20*time.Millisecond, time.Second)
+	conn := &tcpConn{}
+	req := newMemoryRequest(t, MESSAGE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	tx := txs.newClientTX(getTXKey(req), conn, req)
+	if err := tx.start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if n := conn.count("MESSAGE"); n != 1 {
+		t.Fatalf("message sent %d times over tcp, want 1", n)
+	}
+	// 可靠传输收到最终响应后立即结束，不等待T4
+	tx.receiveResponse(NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+	time.Sleep(10 * time.Millisecond)
+	if s := tx.getState(); s != txStateTerminated {
+		t.Fatalf("state %d, want terminated", s)
+	}
+}
+
+func TestTXServerInviteNon2xx(t *testing.T) {
+	conn := &udpConn{}
+	req := newMemoryRequest(t, INVITE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	tx := fastTransactions(t, 5*time.Millisecond, 20*time.Millisecond, 10*time.Millisecond).newServerTX(getTXKey(req), conn, req)
+	resp := NewResponseFromRequest("", req, 486, "Busy Here", nil)
+	if err := tx.Respond(resp); err != nil {
+		t.Fatal(err)
+	}
+	// Timer G 重传非2xx最终响应直到收到ACK
+	time.Sleep(30 * time.Millisecond)
+	if n := conn.count("SIP/2.0 486"); n < 3 {
+		t.Fatalf("486 sent %d times, want retransmits", n)
+	}
+	tx.receiveRequest(newAckRequest(req, resp))
+	if s := tx.getState(); s != txStateConfirmed {
+		t.Fatalf("state %d, want confirmed", s)
+	}
+	n := conn.count("SIP/2.0 486")
+	time.Sleep(30 * time.Millisecond)
+	if m := conn.count("SIP/2.0 486"); m != n {
+		t.Fatalf("486 retransmitted after ack: %d -> %d", n, m)
+	}
+	if s := tx.getState(); s != txStateTerminated {
+		t.Fatalf("state %d, want terminated after Timer I", s)
+	}
+}
+
+func TestTXInviteTimeoutCancel(t *testing.T) {
+	tx, conn := newTestTX(t, fastTransactions(t, 2*time.Millisecond, 8*time.Millisecond, 10*time.Millisecond), INVITE)
+	if err := tx.start(); err != nil {
+		t.Fatal(err)
+	}
+	tx.receiveResponse(NewResponseFromRequest("", tx.Origin(), 100, "Trying", nil))
+	// 设备只回复100 Trying，Timer B 超时后发送CANCEL
+	if _, err := tx.GetResponse(); !errors.Is(err, ErrTransactionTimeout) {
+		t.Fatalf("err %v, want ErrTransactionTimeout", err)
+	}
+	if n := conn.count("CANCEL"); n < 1 {
+		t.Fatal("cancel not sent after invite timeout")
+	}
+	// 事务保留到收到487并回复ACK
+	tx.receiveResponse(NewResponseFromRequest("", tx.Origin(), 487, "Request Terminated", nil))
+	if n := conn.count("ACK"); n != 1 {
+		t.Fatalf("ack sent %d times, want 1", n)
+	}
+}
+
+func TestTXServerCancelAfterFinal(t *testing.T) {
+	conn := &udpConn{}
+	req := newMemoryRequest(t, INVITE, "127.0.0.1:5060", "127.0.0.2:5060", nil)
+	tx := fastTransactions(t, 50*time.Millisecond, 0, 0).newServerTX(getTXKey(req), conn, req)
+	if err := tx.Respond(NewResponseFromRequest("", req, http.StatusOK, "OK", nil)); err != nil {
+		t.Fatal(err)
+	}
+	// 已发送最终响应的INVITE不再回复487
+	tx.receiveCancel()
+	if n := conn.count("SIP/2.0 487"); n != 0 {
+		t.Fatalf("487 sent after 200")
+	}
+}
+
+func TestMemoryCancelUnknown(t *testing.T) {
+	network := NewMemoryNetwork()
+	srvA := newMemoryServer(t, network, "127.0.0.1:5060")
+	srvB := newMemoryServer(t, network, "127.0.0.2:5060")
+	cancelled := make(chan struct{}, 1)
+	srvB.RegistHandler(CANCEL, func(req *Request, tx *Transaction) { cancelled <- struct{}{} })
+
+	// 找不到对应的INVITE事务时回复481，不交给handler
+	tx, err := srvA.Request(newMemoryRequest(t, CANCEL, "127.0.0.1:5060", "127.0.0.2:5060", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tx.GetResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode() != 481 {
+		t.Fatalf("status %d, want 481", resp.StatusCode())
+	}
+	select {
+	case <-cancelled:
+		t.Fatal("cancel handler run for unknown invite")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,157 @@
+package sipapi
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/panjjo/gosip/db"
+	sip "github.com/panjjo/gosip/sip/s"
+	"github.com/panjjo/gosip/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// DeviceStatus 设备状态查询结果 GB/T 28181 A.2.6
+type DeviceStatus struct {
+	// Result 查询结果 OK ERROR
+	Result string `xml:"Result" json:"result"`
+	// Online 是否在线 ONLINE OFFLINE
+	Online string `xml:"Online" json:"online"`
+	// Status 是否正常工作 OK ERROR
+	Status string `xml:"Status" json:"status"`
+	// Reason 不正常工作原因
+	Reason string `xml:"Reason" json:"reason"`
+	// Encode 是否编码 ON OFF
+	Encode string `xml:"Encode" json:"encode"`
+	// Record 是否录像 ON OFF
+	Record string `xml:"Record" json:"record"`
+	// DeviceTime 设备时间
+	DeviceTime string `xml:"DeviceTime" json:"devicetime"`
+	// Alarms 报警设备状态
+	Alarms []AlarmStatus `xml:"Alarmstatus>Item" json:"alarmstatus"`
+	// UpdatedAt 查询时间
+	UpdatedAt int64 `xml:"-" json:"uptime"`
+}
+
+// AlarmStatus 报警设备状态
+type AlarmStatus struct {
+	DeviceID string `xml:"DeviceID" json:"deviceid"`
+	// DutyStatus 布防状态 ONDUTY OFFDUTY ALARM
+	DutyStatus string `xml:"DutyStatus" json:"dutystatus"`
+}
+
+func (s DeviceStatus) Value() (driver.Value, error) {
+	return string(utils.JSONEncode(&s)), nil
+}
+
+func (s *DeviceStatus) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		if len(v) == 0 {
+			return nil
+		}
+		return utils.JSONDecode(v, s)
+	case string:
+		if v == "" {
+			return nil
+		}
+		return utils.JSONDecode([]byte(v), s)
+	case nil:
+		return nil
+	}
+	return errors.New(fmt.Sprint("Failed to unmarshal DeviceStatus value:", value))
+}
+
+// MessageDeviceStatusResponse 设备状态查询返回结构
+type MessageDeviceStatusResponse struct {
+	CmdType  string `xml:"CmdType"`
+	SN       int    `xml:"SN"`
+	DeviceID string `xml:"DeviceID"`
+	DeviceStatus
+}
+
+// 当前查询设备状态的设备集合
+var _deviceStatus *sync.Map
+
+// deviceStatusKey 设备状态查询的等待key，设备id和SN之间使用分隔符避免拼接后冲突
+func deviceStatusKey(deviceID string, sn int) string {
+	return fmt.Sprintf("%s:%d", deviceID, sn)
+}
+
+// deliverDeviceStatus 将设备状态交给等待该设备该SN响应的查询，没有等待的查询时返回false
+func deliverDeviceStatus(deviceID string, sn int, status DeviceStatus) bool {
+	resp, ok := _deviceStatus.Load(deviceStatusKey(deviceID, sn))
+	if !ok {
+		return false
+	}
+	select {
+	case resp.(chan DeviceStatus) <- status:
+		return true
+	default:
+		return false
+	}
+}
+
+// 取得设备发来的设备状态，保存为设备最新状态
+// 只接受在线设备上报自身或所属通道的状态，状态保存到发送消息的设备上
+func sipMessageDeviceStatus(u Devices, body []byte) error {
+	if _, ok := _activeDevices.Get(u.DeviceID); !ok {
+		logrus.Warnln("devicestatus from inactive device,", u.DeviceID)
+		return errors.New("device not active")
+	}
+	message := &MessageDeviceStatusResponse{}
+	if err := utils.XMLDecode(body, message); err != nil {
+		logrus.Errorln("Message Unmarshal xml err:", err, "body:", string(body))
+		return err
+	}
+	if !deviceOwns(u.DeviceID, message.DeviceID) {
+		logrus.Warnln("devicestatus for other device,", u.DeviceID, message.DeviceID)
+		return errors.New("device not owned")
+	}
+	status := message.DeviceStatus
+	status.UpdatedAt = time.Now().Unix()
+	if _, err := db.UpdateAll(db.DBClient, new(Devices), db.M{"deviceid=?": u.DeviceID}, Devices{DeviceStatus: status}); err != nil {
+		logrus.Warnln("save device status error,", u.DeviceID, err)
+	}
+	deliverDeviceStatus(u.DeviceID, message.SN, status)
+	return nil
+}
+
+// SipDeviceStatus 查询设备状态，等待SN对应的响应
+func SipDeviceStatus(deviceID string) (*DeviceStatus, error) {
+	device, ok := _activeDevices.Get(deviceID)
+	if !ok {
+		return nil, errors.New("设备不在线")
+	}
+	sn := utils.RandInt(100000, 999999)
+	resp := make(chan DeviceStatus, 1)
+	statusKey := deviceStatusKey(deviceID, sn)
+	_deviceStatus.Store(statusKey, resp)
+	defer _deviceStatus.Delete(statusKey)
+	hb := sip.NewHeaderBuilder().SetTo(device.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
+		Transport: device.TransPort,
+		Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.MESSAGE)
+	req := sip.NewRequest("", sip.MESSAGE, device.addr.URI, sip.DefaultSipVersion, hb.Build(), sip.GetDeviceStatusXML(deviceID, sn))
+	req.SetDestination(device.source)
+	tx, err := srv.Request(req)
+	if err != nil {
+		return nil, err
+	}
+	response, err := tx.GetResponse()
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return nil, errors.New(response.Reason())
+	}
+	select {
+	case status := <-resp:
+		return &status, nil
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("获取数据超时")
+	}
+}
@@ -0,0 +1,51 @@
+package sipapi
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestDeliverDeviceStatus(t *testing.T) {
+	_deviceStatus = &sync.Map{}
+	resp := make(chan DeviceStatus, 1)
+	_deviceStatus.Store(deviceStatusKey("34020000001320000001", 12), resp)
+
+	// 设备id和SN拼接后相同的key不能匹配
+	if deviceStatusKey("3402000000132000000", 112) == deviceStatusKey("34020000001320000001", 12) {
+		t.Fatal("device status key collision")
+	}
+	if deliverDeviceStatus("34020000001320000001", 13, DeviceStatus{Online: "ONLINE"}) {
+		t.Fatal("delivered to wrong SN")
+	}
+	if deliverDeviceStatus("34020000001320000002", 12, DeviceStatus{Online: "ONLINE"}) {
+		t.Fatal("delivered to wrong device")
+	}
+	if !deliverDeviceStatus("34020000001320000001", 12, DeviceStatus{Online: "ONLINE"}) {
+		t.Fatal("status not delivered")
+	}
+	if status := <-resp; status.Online != "ONLINE" {
+		t.Fatalf("status %+v", status)
+	}
+}
+
+func TestDeviceStatusRejected(t *testing.T) {
+	_deviceStatus = &sync.Map{}
+	_activeDevices = ActiveDevices{}
+	resp := make(chan DeviceStatus, 1)
+	_deviceStatus.Store(deviceStatusKey("34020000001320000001", 12), resp)
+	body := []byte(`<?xml version="1.0"?><Response><CmdType>DeviceStatus</CmdType><SN>12</SN><DeviceID>34020000001320000001</DeviceID><Online>ONLINE</Online></Response>`)
+
+	// 未注册的来源不能上报设备状态
+	if err := sipMessageDeviceStatus(Devices{DeviceID: "34020000001320000001"}, body); err == nil {
+		t.Fatal("status from inactive device accepted")
+	}
+	_activeDevices.Store("34020000001320000002", Devices{DeviceID: "34020000001320000002"})
+	defer _activeDevices.Delete("34020000001320000002")
+	noID := []byte(`<?xml version="1.0"?><Response><CmdType>DeviceStatus</CmdType><SN>12</SN><Online>ONLINE</Online></Response>`)
+	if err := sipMessageDeviceStatus(Devices{DeviceID: "34020000001320000002"}, noID); err == nil {
+		t.Fatal("status without deviceid accepted")
+	}
+	if len(resp) != 0 {
+		t.Fatal("rejected status delivered")
+	}
+}
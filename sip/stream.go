@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
 	sip "github.com/panjjo/gosip/sip/s"
 	"github.com/sirupsen/logrus"
 )
@@ -24,16 +25,13 @@ type Streams struct {
 	StreamType string `json:"streamtype" gorm:"column:streamtype"`
 	// 0正常 1关闭 -1 尚未开始
 	Status int `json:"status" gorm:"column:status"`
-	// header from params
-	Ftag db.M `gorm:"column:ftag" sql:"type:json" json:"-"`
-	// header to params
-	Ttag db.M `gorm:"column:ttag" sql:"type:json" json:"-"`
+	// sip会话，用于发送bye等会话内请求
+	Dialog *sip.Dialog `gorm:"column:dialog" sql:"type:json" json:"-"`
 	// header callid
 	CallID string `json:"callid" gorm:"column:callid"`
 	// 是否停止
-	Stop   bool   `json:"stop" gorm:"column:stop"`
-	Msg    string `json:"msg" gorm:"column:msg"`
-	CseqNo uint32 `json:"cseqno" gorm:"column:cseqno"`
+	Stop bool   `json:"stop" gorm:"column:stop"`
+	Msg  string `json:"msg" gorm:"column:msg"`
 	// 视频流ID gb28181的ssrc
 	StreamID string `json:"streamid"  gorm:"column:streamid"`
 	// m3u8播放地址
@@ -48,10 +46,67 @@ type Streams struct {
 	Stream bool `json:"stream" gorm:"column:stream"`
 
 	// ---
-	S, E time.Time     `json:"-" gorm:"-"`
-	ssrc string        // 国标ssrc 10进制字符串
-	Ext  int64         `json:"-" gorm:"-"` // 流等待过期时间
-	Resp *sip.Response `json:"-" gorm:"-"`
+	S, E time.Time `json:"-" gorm:"-"`
+	ssrc string    // 国标ssrc 10进制字符串
+	Ext  int64     `json:"-" gorm:"-"` // 流等待过期时间
+}
+
+// legacyStream 旧版本的流记录，会话信息保存在ftag、ttag、cseqno字段
+type legacyStream struct {
+	db.DBModel
+	DeviceID  string `gorm:"column:deviceid"`
+	ChannelID string `gorm:"column:channelid"`
+	CallID    string `gorm:"column:callid"`
+	Ftag      db.M   `gorm:"column:ftag" sql:"type:json"`
+	Ttag      db.M   `gorm:"column:ttag" sql:"type:json"`
+	CseqNo    uint32 `gorm:"column:cseqno"`
+}
+
+// dialog 根据旧字段生成会话，local为本平台地址，remote为通道地址
+func (s legacyStream) dialog(local, remote string) *sip.Dialog {
+	tag := func(params db.M) string {
+		if v, ok := params["tag"].(string); ok {
+			return v
+		}
+		return ""
+	}
+	return &sip.Dialog{
+		CallID:       s.CallID,
+		LocalTag:     tag(s.Ftag),
+		RemoteTag:    tag(s.Ttag),
+		LocalURI:     local,
+		RemoteURI:    remote,
+		RemoteTarget: remote,
+		LocalSeq:     s.CseqNo,
+		InviteSeq:    s.CseqNo,
+		Transport:    "UDP",
+	}
+}
+
+// migrateStreamDialogs 升级前未关闭的流没有会话信息，根据旧字段补全，保证仍可以发送BYE关闭
+func migrateStreamDialogs() {
+	if !db.DBClient.Dialect().HasColumn("streams", "ftag") {
+		return
+	}
+	legacies := []legacyStream{}
+	if err := db.DBClient.Table("streams").Where("status=? AND dialog IS NULL", 0).Find(&legacies).Error; err != nil {
+		logrus.Errorln("migrateStreamDialogs find error,", err)
+		return
+	}
+	for _, legacy := range legacies {
+		remote := fmt.Sprintf("sip:%s@%s", legacy.ChannelID, _serverDevices.Region)
+		channel := Channels{}
+		if err := db.GetQ(db.DBClient, &channel, db.M{"channelid=?": legacy.ChannelID}); err == nil && channel.URIStr != "" {
+			remote = channel.URIStr
+		}
+		d := legacy.dialog(_serverDevices.addr.URI.String(), remote)
+		if _, err := db.UpdateAll(db.DBClient, new(Streams), db.M{"id=?": legacy.ID}, db.M{"dialog": d}); err != nil {
+			logrus.Errorln("migrateStreamDialogs update error,", legacy.CallID, err)
+		}
+	}
+	if len(legacies) > 0 {
+		logrus.Infoln("migrateStreamDialogs migrated", len(legacies))
+	}
 }
 
 // 当前系统中存在的流列表
@@ -60,7 +115,9 @@ type streamsList struct {
 	Response *sync.Map
 	// key=channelid value={Play}  当前设备直播信息，防止重复直播
 	Succ *sync.Map
-	ssrc int
+	// key=ssrc value=context.CancelFunc 尚未完成的播放，停止播放时取消
+	Pending *sync.Map
+	ssrc    int
 }
 
 var StreamList streamsList
@@ -132,34 +189,23 @@ func CheckStreams() {
 			}
 			logrus.Debugln("checkStreamClosed", stream.StreamID, stream.DeviceID)
 			// 关闭此流
-			channel := Channels{ChannelID: stream.ChannelID}
-			if err := db.Get(db.DBClient, &channel); err != nil {
-				logrus.Errorln("checkStreamGetchannelError", stream.StreamID, stream.ChannelID, err)
-				stream.Msg = err.Error()
+			if stream.Dialog == nil {
+				logrus.Warningln("checkStreamDialogIsNil", stream.StreamID, stream.DeviceID)
+				stream.Msg = "dialog not found"
+				stream.Status = 1
+				stream.Stop = true
 				db.Save(db.DBClient, stream)
-				channel = Channels{
-					ChannelID: stream.ChannelID,
-					DeviceID:  stream.DeviceID,
-					URIStr:    fmt.Sprintf("sip:%s@%s", stream.ChannelID, _serverDevices.Region),
-				}
-			}
-			channelURI, _ := sip.ParseURI(channel.URIStr)
-			channel.addr = &sip.Address{URI: channelURI, Params: sip.NewParams()}
-			for k, v := range stream.Ttag {
-				channel.addr.Params.Add(k, sip.String{Str: v.(string)})
+				continue
 			}
-			for k, v := range stream.Ftag {
-				_serverDevices.addr.Params.Add(k, sip.String{Str: v.(string)})
+			// 服务重启后会话的发送地址需要以设备当前地址为准
+			stream.Dialog.SetDestination(device.source)
+			req, err := stream.Dialog.NewRequest(sip.BYE)
+			if err != nil {
+				logrus.Errorln("checkStreamBuildByeError", stream.StreamID, stream.ChannelID, err)
+				stream.Msg = err.Error()
+				db.Save(db.DBClient, stream)
+				continue
 			}
-			callid := sip.CallID(stream.CallID)
-			stream.CseqNo++
-
-			hb := sip.NewHeaderBuilder().SetToWithParam(channel.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
-				Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
-			}).SetContentType(&sip.ContentTypeSDP).SetMethod(sip.BYE).SetContact(_serverDevices.addr).SetCallID(&callid).SetSeqNo(uint(stream.CseqNo))
-			req := sip.NewRequest("", sip.BYE, channel.addr.URI, sip.DefaultSipVersion, hb.Build(), nil)
-			req.SetDestination(device.source)
-			req.SetRecipient(channel.addr.URI)
 
 			// 不管成功不成功 程序都删除掉，后面开新流，关闭不成功的后面重试
 			StreamList.Response.Delete(stream.StreamID)
@@ -172,9 +218,9 @@ func CheckStreams() {
 				db.Save(db.DBClient, stream)
 				continue
 			}
-			response := tx.GetResponse()
-			if response == nil {
-				logrus.Warningln("checkStreamClosedFail response is nil", channel.ChannelID, channel.DeviceID, stream.StreamID)
+			response, err := tx.GetResponse()
+			if err != nil {
+				logrus.Warningln("checkStreamClosedFail response failed", stream.ChannelID, stream.DeviceID, stream.StreamID, err)
 				continue
 			}
 			if response.StatusCode() != http.StatusOK {
@@ -200,3 +246,31 @@ func CheckStreams() {
 		skip += 100
 	}
 }
+
+// closeDeviceStreams 设备下线时关闭设备的所有流。设备主动注销时仍可达，bye为true时发送BYE；注册过期等设备已不可达的情况不发送
+func closeDeviceStreams(device Devices, msg string, bye bool) {
+	StreamList.Response.Range(func(key, value interface{}) bool {
+		play := value.(*Streams)
+		if play.DeviceID != device.DeviceID {
+			return true
+		}
+		ssrc := key.(string)
+		zlmCloseStream(ssrc)
+		play.Status = 1
+		play.Stop = true
+		play.Msg = msg
+		db.Save(db.DBClient, play)
+		StreamList.Response.Delete(ssrc)
+		if play.T == 0 {
+			StreamList.Succ.Delete(play.ChannelID)
+		}
+		if bye && play.StreamType == m.StreamTypePush && play.Dialog != nil && device.source != nil {
+			go func(play *Streams) {
+				if err := sipPlayBye(play, device); err != nil {
+					logrus.Warningln("closeDeviceStreams bye fail.id:", play.DeviceID, play.ChannelID, "err:", err)
+				}
+			}(play)
+		}
+		return true
+	})
+}
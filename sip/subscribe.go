@@ -0,0 +1,389 @@
+package sipapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/panjjo/gosip/db"
+	"github.com/panjjo/gosip/m"
+	sip "github.com/panjjo/gosip/sip/s"
+	"github.com/panjjo/gosip/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// 订阅默认有效期，单位秒
+const defaultSubscribeExpires = 3600
+
+// subscription 设备事件订阅，有效期内设备通过NOTIFY推送变化 GB/T 28181 9.11
+type subscription struct {
+	dialog *sip.Dialog
+	// 订阅到期时间
+	expires int64
+	// 订阅失败后下次重试时间
+	retryAt int64
+	// 已发送订阅，等待设备响应
+	pending bool
+}
+
+type subscriptions struct {
+	items map[string]*subscription
+	l     *sync.Mutex
+}
+
+// 目录订阅和移动位置订阅
+var (
+	_catalogSubs  = newSubscriptions()
+	_positionSubs = newSubscriptions()
+)
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{items: map[string]*subscription{}, l: &sync.Mutex{}}
+}
+
+func (s *subscriptions) get(deviceID string) (subscription, bool) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if sub, ok := s.items[deviceID]; ok {
+		return *sub, true
+	}
+	return subscription{}, false
+}
+
+func (s *subscriptions) store(deviceID string, sub subscription) {
+	s.l.Lock()
+	s.items[deviceID] = &sub
+	s.l.Unlock()
+}
+
+func (s *subscriptions) delete(deviceID string) {
+	s.l.Lock()
+	delete(s.items, deviceID)
+	s.l.Unlock()
+}
+
+// match 收到的NOTIFY是否属于设备已建立的订阅会话，Call-ID和tag需要一致
+func (s *subscriptions) match(deviceID string, req *sip.Request) bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	sub, ok := s.items[deviceID]
+	return ok && sub.dialog != nil && sub.dialog.Match(req)
+}
+
+// claim 没有订阅，或订阅失败且已到重试时间时，记录订阅中标记并返回true
+// 订阅响应返回前不会重复订阅
+func (s *subscriptions) claim(deviceID string, now int64) bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if sub, ok := s.items[deviceID]; ok && (sub.pending || sub.dialog != nil || sub.retryAt > now) {
+		return false
+	}
+	s.items[deviceID] = &subscription{pending: true}
+	return true
+}
+
+// expiring 即将到期需要刷新的订阅
+func (s *subscriptions) expiring(now, ahead int64) []string {
+	s.l.Lock()
+	defer s.l.Unlock()
+	list := []string{}
+	for deviceID, sub := range s.items {
+		if sub.dialog != nil && sub.expires-ahead <= now {
+			list = append(list, deviceID)
+		}
+	}
+	return list
+}
+
+// subscribeExpires 订阅有效期
+func subscribeExpires() int64 {
+	if _sysinfo.CatalogSubscribe > 0 {
+		return int64(_sysinfo.CatalogSubscribe)
+	}
+	return defaultSubscribeExpires
+}
+
+// sipSubscribe 发送订阅，已有订阅时在会话内刷新，expires为0时取消订阅
+func sipSubscribe(to Devices, subs *subscriptions, event string, body []byte, expires int64) error {
+	now := time.Now().Unix()
+	sub, refresh := subs.get(to.DeviceID)
+	refresh = refresh && sub.dialog != nil
+	if expires == 0 {
+		subs.delete(to.DeviceID)
+		if !refresh {
+			return nil
+		}
+	}
+	var req *sip.Request
+	if refresh {
+		var err error
+		req, err = sub.dialog.NewRequest(sip.SUBSCRIBE)
+		if err != nil {
+			subs.delete(to.DeviceID)
+			return err
+		}
+		req.AppendHeader(&sip.ContactHeader{Address: _serverDevices.addr.URI, Params: sip.NewParams()})
+		if len(body) > 0 {
+			req.AppendHeader(&sip.ContentTypeXML)
+			req.SetBody(body, true)
+		}
+	} else {
+		hb := sip.NewHeaderBuilder().SetTo(to.addr).SetFrom(_serverDevices.addr).AddVia(&sip.ViaHop{
+			Transport: to.TransPort,
+			Params:    sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+		}).SetContentType(&sip.ContentTypeXML).SetMethod(sip.SUBSCRIBE).SetContact(_serverDevices.addr)
+		req = sip.NewRequest("", sip.SUBSCRIBE, to.addr.URI, sip.DefaultSipVersion, hb.Build(), body)
+	}
+	req.SetDestination(to.source)
+	exp := sip.Expires(expires)
+	req.AppendHeader(&exp)
+	req.AppendHeader(&sip.GenericHeader{HeaderName: "Event", Contents: event})
+	tx, err := srv.Request(req)
+	if err == nil {
+		var response *sip.Response
+		if response, err = sipResponse(tx); err == nil {
+			if hdrs := response.GetHeaders("Expires"); len(hdrs) > 0 {
+				if e, ok := hdrs[0].(*sip.Expires); ok && int64(*e) > 0 {
+					expires = int64(*e)
+				}
+			}
+			if !refresh {
+				sub.dialog, err = sip.NewDialogFromResponse(req, response)
+			}
+		}
+	}
+	if expires == 0 {
+		return err
+	}
+	if err != nil {
+		subs.store(to.DeviceID, subscription{retryAt: now + expires})
+		return err
+	}
+	subs.store(to.DeviceID, subscription{dialog: sub.dialog, expires: now + expires})
+	return nil
+}
+
+// sipCatalogSubscribe 订阅设备目录，已有订阅时在会话内刷新
+// 新建订阅时先全量同步一次目录，之后依赖NOTIFY增量更新；订阅失败时全量同步，并在一个订阅周期后重试
+func sipCatalogSubscribe(to Devices) {
+	sub, refresh := _catalogSubs.get(to.DeviceID)
+	refresh = refresh && sub.dialog != nil
+	if !refresh {
+		sipCatalog(to)
+	}
+	if err := sipSubscribe(to, _catalogSubs, "Catalog", sip.GetCatalogXML(to.DeviceID), subscribeExpires()); err != nil {
+		logrus.Warnln("sipCatalogSubscribe error,", to.DeviceID, err)
+		if refresh {
+			// 刷新失败，订阅可能已被设备删除，全量同步一次
+			sipCatalog(to)
+		}
+	}
+}
+
+// sipPositionSubscribe 订阅设备移动位置，设备未设置上报间隔时取消订阅
+func sipPositionSubscribe(to Devices) {
+	expires := subscribeExpires()
+	if to.PositionInterval <= 0 {
+		expires = 0
+	}
+	body := sip.GetMobilePositionXML(to.DeviceID, utils.RandInt(100000, 999999), to.PositionInterval)
+	if err := sipSubscribe(to, _positionSubs, "presence", body, expires); err != nil {
+		logrus.Warnln("sipPositionSubscribe error,", to.DeviceID, err)
+	}
+}
+
+// checkSubscriptions 心跳或注册时检查订阅，没有订阅或订阅失败到达重试时间时重新订阅
+func checkSubscriptions(u Devices) {
+	now := time.Now().Unix()
+	if _catalogSubs.claim(u.DeviceID, now) {
+		sipCatalogSubscribe(u)
+	}
+	if u.PositionInterval > 0 && _positionSubs.claim(u.DeviceID, now) {
+		sipPositionSubscribe(u)
+	}
+}
+
+// deleteSubscriptions 设备离线或重新注册，订阅失效
+func deleteSubscriptions(deviceID string) {
+	_catalogSubs.delete(deviceID)
+	_positionSubs.delete(deviceID)
+}
+
+// CheckSubscribe 定时刷新即将到期的目录和移动位置订阅
+func CheckSubscribe() {
+	now := time.Now().Unix()
+	// 提前刷新时间，不超过订阅有效期的一半
+	ahead := utils.Min(60, subscribeExpires()/2)
+	for _, deviceID := range _catalogSubs.expiring(now, ahead) {
+		if device, ok := _activeDevices.Get(deviceID); ok {
+			go sipCatalogSubscribe(device)
+		} else {
+			_catalogSubs.delete(deviceID)
+		}
+	}
+	for _, deviceID := range _positionSubs.expiring(now, ahead) {
+		if device, ok := _activeDevices.Get(deviceID); ok {
+			go sipPositionSubscribe(device)
+		} else {
+			_positionSubs.delete(deviceID)
+		}
+	}
+}
+
+// RefreshPositionSubscribe 设备移动位置上报间隔修改后重新订阅
+func RefreshPositionSubscribe(deviceID string, interval int) {
+	device, ok := _activeDevices.Get(deviceID)
+	if !ok {
+		return
+	}
+	device.PositionInterval = interval
+	_activeDevices.Store(deviceID, device)
+	// 间隔变化需要新的订阅内容，先取消原订阅
+	sipSubscribe(device, _positionSubs, "presence", nil, 0)
+	if interval > 0 && _positionSubs.claim(deviceID, time.Now().Unix()) {
+		sipPositionSubscribe(device)
+	}
+}
+
+// MessageCatalogNotify 目录订阅通知结构
+type MessageCatalogNotify struct {
+	CmdType  string             `xml:"CmdType"`
+	SN       int                `xml:"SN"`
+	DeviceID string             `xml:"DeviceID"`
+	SumNum   int                `xml:"SumNum"`
+	Item     []CatalogEventItem `xml:"DeviceList>Item"`
+}
+
+// CatalogEventItem 目录变化事件
+type CatalogEventItem struct {
+	Channels
+	// Event 事件类型 ON OFF VLOST DEFECT ADD DEL UPDATE
+	Event string `xml:"Event"`
+}
+
+// eventSubscriptions 根据NOTIFY的Event头域找到对应的订阅
+func eventSubscriptions(req *sip.Request) *subscriptions {
+	hdrs := req.GetHeaders("Event")
+	if len(hdrs) == 0 {
+		return nil
+	}
+	event, ok := hdrs[0].(*sip.GenericHeader)
+	if !ok {
+		return nil
+	}
+	// 去掉id等参数
+	name := strings.TrimSpace(strings.SplitN(event.Contents, ";", 2)[0])
+	switch strings.ToLower(name) {
+	case "catalog":
+		return _catalogSubs
+	case "presence":
+		return _positionSubs
+	}
+	return nil
+}
+
+// 处理设备发来的NOTIFY
+func handlerNotify(req *sip.Request, tx *sip.Transaction) {
+	u, ok := parserDevicesFromReqeust(req)
+	if !ok {
+		tx.Respond(sip.NewResponseFromRequest("", req, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil))
+		return
+	}
+	// 只接受Event对应的订阅会话内的通知 RFC 6665 4.1.3
+	subs := eventSubscriptions(req)
+	if subs == nil || !subs.match(u.DeviceID, req) {
+		logrus.Warnln("notify without subscription,", u.DeviceID)
+		tx.Respond(sip.NewResponseFromRequest("", req, 481, "Subscription Does Not Exist", nil))
+		return
+	}
+	if hdrs := req.GetHeaders("Subscription-State"); len(hdrs) > 0 {
+		if state, ok := hdrs[0].(*sip.GenericHeader); ok && strings.HasPrefix(strings.ToLower(state.Contents), "terminated") {
+			// 设备终止订阅，只删除Event对应的订阅，下次心跳时重新订阅
+			subs.delete(u.DeviceID)
+		}
+	}
+	body := req.Body()
+	if len(body) == 0 {
+		tx.Respond(sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+		return
+	}
+	message := &MessageReceive{}
+	if err := utils.XMLDecode(body, message); err != nil {
+		// 部分设备不带encoding且使用gbk编码
+		if body, err = utils.GbkToUtf8(body); err == nil {
+			err = utils.XMLDecode(body, message)
+		}
+		if err != nil {
+			logrus.Errorln("Notify Unmarshal xml err:", err, "body:", string(body))
+			tx.Respond(sip.NewResponseFromRequest("", req, http.StatusBadRequest, http.StatusText(http.StatusBadRequest), nil))
+			return
+		}
+	}
+	tx.Respond(sip.NewResponseFromRequest("", req, http.StatusOK, "OK", nil))
+	switch message.CmdType {
+	case "Catalog":
+		sipNotifyCatalog(u, body)
+	case "MobilePosition":
+		sipMessageMobilePosition(u, body)
+	}
+}
+
+// sipNotifyCatalog 根据目录变化事件更新通道
+func sipNotifyCatalog(u Devices, body []byte) error {
+	if _, ok := _activeDevices.Get(u.DeviceID); !ok {
+		logrus.Warnln("catalog notify from inactive device,", u.DeviceID)
+		return errors.New("device not active")
+	}
+	message := &MessageCatalogNotify{}
+	if err := utils.XMLDecode(body, message); err != nil {
+		logrus.Errorln("Notify Unmarshal xml err:", err, "body:", string(body))
+		return err
+	}
+	// 通道归属发送通知的已注册设备，不使用xml中的设备编号
+	message.DeviceID = u.DeviceID
+	for _, item := range message.Item {
+		event := strings.ToUpper(item.Event)
+		if nodeType := catalogNodeType(item.ChannelID); nodeType != TreeNodeChannel {
+			switch event {
+			case "DEL":
+				db.DelQ(db.DBClient, new(Organizations), db.M{"orgid=?": item.ChannelID, "deviceid=?": message.DeviceID})
+			case "ADD", "UPDATE", "":
+				if nodeType != "" {
+					saveCatalogOrganization(message.DeviceID, item.Channels)
+				}
+			}
+			continue
+		}
+		switch event {
+		case "ON", "OFF", "VLOST", "DEFECT":
+		case "DEL":
+			channel := Channels{ChannelID: item.ChannelID, DeviceID: message.DeviceID}
+			if err := db.Get(db.DBClient, &channel); err == nil {
+				removeChannel(channel)
+			}
+			continue
+		default:
+			// ADD UPDATE 及不带事件的全量目录，通道不存在时创建
+			saveCatalogChannel(message.DeviceID, item.Channels)
+			continue
+		}
+		channel := Channels{ChannelID: item.ChannelID, DeviceID: message.DeviceID}
+		if err := db.Get(db.DBClient, &channel); err != nil {
+			logrus.Infoln("catalog notify channel not found,channelid:", item.ChannelID, "deviceid:", message.DeviceID, "event:", item.Event, "err", err)
+			continue
+		}
+		status := channel.Status
+		channel.Status = m.DeviceStatusOFF
+		if event == "ON" {
+			channel.Status = m.DeviceStatusON
+		}
+		channel.Active = time.Now().Unix()
+		db.Save(db.DBClient, &channel)
+		if channel.Status != status {
+			go notify(notifyChannelsActive(channel))
+		}
+	}
+	return nil
+}
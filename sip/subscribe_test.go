@@ -0,0 +1,107 @@
+package sipapi
+
+import (
+	"testing"
+
+	sip "github.com/panjjo/gosip/sip/s"
+)
+
+// newNotify 设备在订阅会话内发送的NOTIFY
+func newNotify(t *testing.T, sub *sip.Dialog, event string) *sip.Request {
+	t.Helper()
+	device := &sip.Dialog{
+		CallID:       sub.CallID,
+		LocalTag:     sub.RemoteTag,
+		RemoteTag:    sub.LocalTag,
+		LocalURI:     sub.RemoteURI,
+		RemoteURI:    sub.LocalURI,
+		RemoteTarget: sub.LocalURI,
+	}
+	req, err := device.NewRequest(sip.NOTIFY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AppendHeader(&sip.GenericHeader{HeaderName: "Event", Contents: event})
+	return req
+}
+
+func TestSubscriptionMatch(t *testing.T) {
+	subs := newSubscriptions()
+	dialog := &sip.Dialog{
+		CallID:    "sub-call-1",
+		LocalTag:  "servertag",
+		RemoteTag: "devicetag",
+		LocalURI:  "sip:34020000002000000001@3402000000",
+		RemoteURI: "sip:34020000001320000001@3402000000",
+	}
+	notify := newNotify(t, dialog, "Catalog;id=1")
+	if subs.match("34020000001320000001", notify) {
+		t.Fatal("notify matched without subscription")
+	}
+	// 订阅中尚未建立会话
+	subs.claim("34020000001320000001", 100)
+	if subs.match("34020000001320000001", notify) {
+		t.Fatal("notify matched pending subscription")
+	}
+	subs.store("34020000001320000001", subscription{dialog: dialog, expires: 3700})
+	if !subs.match("34020000001320000001", notify) {
+		t.Fatal("notify does not match subscription")
+	}
+	if subs.match("34020000001320000002", notify) {
+		t.Fatal("notify matched other device subscription")
+	}
+	other := *dialog
+	other.CallID = "sub-call-2"
+	if subs.match("34020000001320000001", newNotify(t, &other, "Catalog")) {
+		t.Fatal("notify with other call-id matched")
+	}
+	other = *dialog
+	other.RemoteTag = "othertag"
+	if subs.match("34020000001320000001", newNotify(t, &other, "Catalog")) {
+		t.Fatal("notify with other tag matched")
+	}
+}
+
+func TestEventSubscriptions(t *testing.T) {
+	dialog := &sip.Dialog{CallID: "sub-call-1", LocalURI: "sip:a@b", RemoteURI: "sip:c@d"}
+	cases := map[string]*subscriptions{
+		"Catalog":        _catalogSubs,
+		"catalog;id=123": _catalogSubs,
+		"presence":       _positionSubs,
+		"Alarm":          nil,
+	}
+	for event, want := range cases {
+		if got := eventSubscriptions(newNotify(t, dialog, event)); got != want {
+			t.Errorf("%s: wrong subscriptions", event)
+		}
+	}
+}
+
+func TestSubscriptionRefresh(t *testing.T) {
+	subs := newSubscriptions()
+	now := int64(1000)
+	if !subs.claim("34020000001320000001", now) {
+		t.Fatal("claim without subscription failed")
+	}
+	// 等待响应期间不重复订阅
+	if subs.claim("34020000001320000001", now) {
+		t.Fatal("pending subscription claimed twice")
+	}
+	subs.store("34020000001320000001", subscription{dialog: &sip.Dialog{}, expires: now + 3600})
+	subs.store("34020000001320000002", subscription{dialog: &sip.Dialog{}, expires: now + 30})
+	subs.store("34020000001320000003", subscription{retryAt: now + 60})
+	if subs.claim("34020000001320000001", now) {
+		t.Fatal("established subscription claimed")
+	}
+	// 只刷新即将到期的已建立订阅
+	if list := subs.expiring(now, 60); len(list) != 1 || list[0] != "34020000001320000002" {
+		t.Fatalf("expiring %v", list)
+	}
+	// 失败的订阅到达重试时间后重新订阅
+	if subs.claim("34020000001320000003", now) {
+		t.Fatal("failed subscription claimed before retry time")
+	}
+	if !subs.claim("34020000001320000003", now+60) {
+		t.Fatal("failed subscription not claimed at retry time")
+	}
+}
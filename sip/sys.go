@@ -1,6 +1,7 @@
 package sipapi
 
 import (
+	"context"
 	"fmt"
 	"github.com/panjjo/gosip/db"
 	"github.com/panjjo/gosip/m"
@@ -12,33 +13,50 @@ import (
 	"net/url"
 	"strconv"
 	"sync"
-)
-
-var (
-	// sip服务用户信息
-	cascadeSrv *sip.Server
+	"time"
 )
 
 func Start() {
 	// 数据库表初始化 启动时自动同步数据结构到数据库
 	db.DBClient.AutoMigrate(new(Devices))
 	db.DBClient.AutoMigrate(new(Channels))
+	db.DBClient.AutoMigrate(new(Organizations))
 	db.DBClient.AutoMigrate(new(Streams))
 	db.DBClient.AutoMigrate(new(m.SysInfo))
 	db.DBClient.AutoMigrate(new(Files))
+	db.DBClient.AutoMigrate(new(Presets))
+	db.DBClient.AutoMigrate(new(Alarms))
+	db.DBClient.AutoMigrate(new(Positions))
 	db.DBClient.AutoMigrate(new(m.MediaServer))
 	db.DBClient.AutoMigrate(new(m.Cascade))
+	db.DBClient.AutoMigrate(new(CascadeDialogs))
 
 	// 加载系统信息
 	LoadSYSInfo()
+	// 补全旧版本流记录的会话信息
+	migrateStreamDialogs()
 	// 服务启动时将ZLM的回调写到ZLM服务器配置文件上
 	syncWebhook2ZlmConfig()
 
 	// SIP服务器
-	srv := sip.NewServer()
+	srv = sip.NewServer()
+	timer := config.GB28181.Timer
+	srv.SetTimers(time.Duration(timer.T1)*time.Millisecond, time.Duration(timer.T2)*time.Millisecond, time.Duration(timer.T4)*time.Millisecond)
+	srv.SetMTU(config.GB28181.MTU)
 	srv.RegistHandler(sip.REGISTER, handlerRegister) //处理下级设备的注册请求
 	srv.RegistHandler(sip.MESSAGE, handlerMessage)   //处理下级设备发来的消息
+	srv.RegistHandler(sip.NOTIFY, handlerNotify)     //处理下级设备发来的订阅通知
 	go srv.ListenUDPServer(config.GB28181.UDP)
+	if config.GB28181.TCP != "" {
+		go srv.ListenTCPServer(config.GB28181.TCP)
+	}
+	if tlscfg := config.GB28181.TLS; tlscfg.Addr != "" {
+		tlsConfig, err := sip.NewTLSConfig(tlscfg.Cert, tlscfg.Key, tlscfg.CA)
+		if err != nil {
+			logrus.Fatalln("sip tls config error,", err)
+		}
+		go srv.ListenTLSServer(tlscfg.Addr, tlsConfig)
+	}
 
 	go cascadeInit()
 	//go func() {
@@ -78,6 +96,9 @@ func (a *ActiveDevices) Get(key string) (Devices, bool) {
 
 var _activeDevices ActiveDevices
 
+// 注册认证下发的nonce
+var _nonces *sip.Nonces
+
 // 系统运行信息
 var _sysinfo *m.SysInfo
 
@@ -88,10 +109,14 @@ func LoadSYSInfo() {
 
 	config = m.MConfig
 	_activeDevices = ActiveDevices{sync.Map{}}
+	_nonces = sip.NewNonces(5 * time.Minute)
+	_registerBans = newRegisterBans()
 
-	StreamList = streamsList{&sync.Map{}, &sync.Map{}, 0}
+	StreamList = streamsList{&sync.Map{}, &sync.Map{}, &sync.Map{}, 0}
 	ssrcLock = &sync.Mutex{}
 	_recordList = &sync.Map{}
+	_presetList = &sync.Map{}
+	_deviceStatus = &sync.Map{}
 	RecordList = apiRecordList{items: map[string]*apiRecordItem{}, l: sync.RWMutex{}}
 
 	// init sysinfo
@@ -108,6 +133,14 @@ func LoadSYSInfo() {
 			logrus.Fatalf("2 init sysinfo err:%v", err)
 		}
 	}
+	// 监听地址以配置文件为准
+	_sysinfo.TCP = config.GB28181.TCP
+	_sysinfo.TLS = config.GB28181.TLS
+	_sysinfo.Timer = config.GB28181.Timer
+	_sysinfo.MTU = config.GB28181.MTU
+	_sysinfo.CatalogSubscribe = config.GB28181.CatalogSubscribe
+	_sysinfo.AutoRegister = config.GB28181.AutoRegister
+	_sysinfo.AuthLock = config.GB28181.AuthLock
 	m.MConfig.GB28181 = _sysinfo
 
 	uri, _ := sip.ParseSipURI(fmt.Sprintf("sip:%s@%s", _sysinfo.LID, _sysinfo.Region))
@@ -144,12 +177,28 @@ func ssrc2stream(ssrc string) string {
 }
 
 func sipResponse(tx *sip.Transaction) (*sip.Response, error) {
-	response := tx.GetResponse()
-	if response == nil {
-		return nil, utils.NewError(nil, "response timeout", "tx key:", tx.Key())
+	response, err := tx.GetResponse()
+	if err != nil {
+		return nil, utils.NewError(err, "get response failed", "tx key:", tx.Key())
 	}
 	if response.StatusCode() != http.StatusOK {
 		return response, utils.NewError(nil, "response fail", response.StatusCode(), response.Reason(), "tx key:", tx.Key())
 	}
 	return response, nil
 }
+
+// sipInviteResponse 等待INVITE的最终响应，ctx取消时发送CANCEL
+func sipInviteResponse(ctx context.Context, tx *sip.Transaction) (*sip.Response, error) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := tx.Cancel(); err != nil {
+				logrus.Warnln("cancel invite failed,", err)
+			}
+		case <-done:
+		}
+	}()
+	return sipResponse(tx)
+}
@@ -0,0 +1,82 @@
+package sipapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	sip "github.com/panjjo/gosip/sip/s"
+)
+
+// servingTransport 开始接收消息时通知，此时传输已加入Server
+type servingTransport struct {
+	sip.Transport
+	ready chan struct{}
+}
+
+func (t *servingTransport) Serve(handle func(data []byte, raddr net.Addr)) error {
+	close(t.ready)
+	return t.Transport.Serve(handle)
+}
+
+// newMemoryServer 创建监听内存地址的Server，返回Server和监听地址
+func newMemoryServer(t *testing.T, network *sip.MemoryNetwork, addr string) (*sip.Server, net.Addr) {
+	t.Helper()
+	tp, err := network.Transport(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := sip.NewServer()
+	st := &servingTransport{Transport: tp, ready: make(chan struct{})}
+	go srv.ListenTransport(st)
+	<-st.ready
+	t.Cleanup(func() { srv.Close() })
+	return srv, tp.LocalAddr()
+}
+
+func TestSipInviteResponseCancel(t *testing.T) {
+	network := sip.NewMemoryNetwork()
+	srvA, _ := newMemoryServer(t, network, "127.0.0.1:5060")
+	srvB, addrB := newMemoryServer(t, network, "127.0.0.2:5060")
+	ringing := make(chan struct{})
+	srvB.RegistHandler(sip.INVITE, func(req *sip.Request, tx *sip.Transaction) {
+		tx.Respond(sip.NewResponseFromRequest("", req, 180, "Ringing", nil))
+		close(ringing)
+	})
+
+	from, err := sip.ParseURI("sip:34020000002000000001@127.0.0.1:5060")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := sip.ParseURI("sip:34020000001320000001@127.0.0.2:5060")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromAddr := &sip.Address{URI: from, Params: sip.NewParams().Add("tag", sip.String{Str: "fromtag"})}
+	toAddr := &sip.Address{URI: to, Params: sip.NewParams()}
+	hb := sip.NewHeaderBuilder().SetFrom(fromAddr).SetTo(toAddr).AddVia(&sip.ViaHop{
+		Params: sip.NewParams().Add("branch", sip.String{Str: sip.GenerateBranch()}),
+	}).SetMethod(sip.INVITE).SetContact(fromAddr)
+	req := sip.NewRequest("", sip.INVITE, to, sip.DefaultSipVersion, hb.Build(), nil)
+	req.SetDestination(addrB)
+	tx, err := srvA.Request(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ringing:
+	case <-time.After(2 * time.Second):
+		t.Fatal("invite not received")
+	}
+	// 调用方取消后发送CANCEL，设备回复487
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp, err := sipInviteResponse(ctx, tx)
+	if err == nil {
+		t.Fatal("want error for cancelled invite")
+	}
+	if resp == nil || resp.StatusCode() != 487 {
+		t.Fatalf("response %v, want 487", resp)
+	}
+}
@@ -0,0 +1,201 @@
+package sipapi
+
+import (
+	"strings"
+
+	"github.com/panjjo/gosip/db"
+	"github.com/sirupsen/logrus"
+)
+
+// 组织树节点类型
+const (
+	// TreeNodeDevice 注册设备或下级平台
+	TreeNodeDevice = "device"
+	// TreeNodeCivil 行政区划
+	TreeNodeCivil = "civilcode"
+	// TreeNodePlatform 系统节点，类型编码200
+	TreeNodePlatform = "platform"
+	// TreeNodeBusiness 业务分组，类型编码215
+	TreeNodeBusiness = "business"
+	// TreeNodeVirtual 虚拟组织，类型编码216
+	TreeNodeVirtual = "virtual"
+	// TreeNodeChannel 通道
+	TreeNodeChannel = "channel"
+)
+
+// Organizations 设备目录中的组织节点，行政区划、系统、业务分组和虚拟组织 GB/T 28181 附录D
+type Organizations struct {
+	db.DBModel
+	// OrgID 节点编号
+	OrgID string `json:"orgid" gorm:"column:orgid"`
+	// DeviceID 上报目录的设备编号
+	DeviceID string `json:"deviceid" gorm:"column:deviceid"`
+	// Name 节点名称
+	Name string `json:"name" gorm:"column:name"`
+	// Type 节点类型 civilcode platform business virtual
+	Type string `json:"type" gorm:"column:orgtype"`
+	// ParentID 上级节点编号，为空时挂在设备下
+	ParentID string `json:"parentid" gorm:"column:parentid"`
+	// BusinessGroupID 虚拟组织所属业务分组
+	BusinessGroupID string `json:"businessgroupid" gorm:"column:businessgroupid"`
+	// CivilCode 行政区划
+	CivilCode string `json:"civilcode" gorm:"column:civilcode"`
+}
+
+// catalogNodeType 根据目录项编号判断节点类型，2-8位为行政区划，20位编码的11-13位为类型编码，无法识别时返回空
+func catalogNodeType(id string) string {
+	if len(id) >= 2 && len(id) <= 8 {
+		return TreeNodeCivil
+	}
+	if len(id) != 20 {
+		return ""
+	}
+	switch id[10:13] {
+	case "200":
+		return TreeNodePlatform
+	case "215":
+		return TreeNodeBusiness
+	case "216":
+		return TreeNodeVirtual
+	}
+	return TreeNodeChannel
+}
+
+// catalogParent 计算目录项的上级节点
+// 优先使用ParentID，未上报时虚拟组织挂在业务分组下，行政区划挂在上级行政区划下，通道挂在所属行政区划下
+func catalogParent(deviceID string, d Channels) string {
+	parentID := d.ParentID
+	// 部分平台上报以/分隔的上级路径，取最后一级
+	if i := strings.LastIndex(parentID, "/"); i >= 0 {
+		parentID = parentID[i+1:]
+	}
+	if parentID != "" && parentID != deviceID && parentID != d.ChannelID {
+		return parentID
+	}
+	switch catalogNodeType(d.ChannelID) {
+	case TreeNodeCivil:
+		return d.ChannelID[:len(d.ChannelID)-2]
+	case TreeNodeVirtual:
+		return d.BusinessGroupID
+	case TreeNodeChannel:
+		return d.CivilCode
+	}
+	return ""
+}
+
+// saveCatalogOrganization 使用目录项更新组织节点，节点不存在时创建
+func saveCatalogOrganization(deviceID string, d Channels) {
+	if d.ChannelID == deviceID {
+		// 下级平台自身的系统节点即为设备
+		return
+	}
+	org := Organizations{OrgID: d.ChannelID, DeviceID: deviceID}
+	if err := db.Get(db.DBClient, &org); err != nil && !db.RecordNotFound(err) {
+		logrus.Warnln("get catalog organization error,", d.ChannelID, "deviceid:", deviceID, err)
+		return
+	}
+	org.Name = d.Name
+	org.Type = catalogNodeType(d.ChannelID)
+	org.ParentID = catalogParent(deviceID, d)
+	org.BusinessGroupID = d.BusinessGroupID
+	org.CivilCode = d.CivilCode
+	if err := db.Save(db.DBClient, &org); err != nil {
+		logrus.Warnln("save catalog organization error,", d.ChannelID, "deviceid:", deviceID, err)
+	}
+}
+
+// removeCatalogOrganizations 删除设备目录中已不存在的组织节点
+func removeCatalogOrganizations(deviceID string, seen map[string]bool) {
+	where := db.M{"deviceid=?": deviceID}
+	if len(seen) > 0 {
+		ids := make([]string, 0, len(seen))
+		for id := range seen {
+			ids = append(ids, id)
+		}
+		where["orgid NOT IN (?)"] = ids
+	}
+	if err := db.DelQ(db.DBClient, new(Organizations), where); err != nil {
+		logrus.Warnln("remove catalog organizations error,", deviceID, err)
+	}
+}
+
+// TreeNode 组织树节点
+type TreeNode struct {
+	// ID 节点编号
+	ID string `json:"id"`
+	// DeviceID 节点所属设备，加载下级节点时使用
+	DeviceID string `json:"deviceid"`
+	Name     string `json:"name"`
+	// Type 节点类型 device civilcode platform business virtual channel
+	Type     string `json:"type"`
+	ParentID string `json:"parentid"`
+	// Status 设备和通道在线状态
+	Status string `json:"status"`
+	// Leaf 是否叶子节点，非叶子节点可继续加载下级
+	Leaf bool `json:"leaf"`
+}
+
+// rootOrganizations 设备下的顶级组织节点，即上级节点不在设备目录中的节点，同时返回设备的全部组织节点编号
+func rootOrganizations(orgs []Organizations) ([]Organizations, []string) {
+	ids := map[string]bool{}
+	for _, org := range orgs {
+		ids[org.OrgID] = true
+	}
+	roots := []Organizations{}
+	for _, org := range orgs {
+		if !ids[org.ParentID] {
+			roots = append(roots, org)
+		}
+	}
+	all := make([]string, 0, len(ids))
+	for id := range ids {
+		all = append(all, id)
+	}
+	return roots, all
+}
+
+// TreeChildren 查询组织树的下级节点
+// deviceID为空时返回设备列表，id为空或等于deviceID时返回设备下的顶级节点，上级节点不存在的节点也挂在设备下
+func TreeChildren(deviceID, id string) ([]TreeNode, error) {
+	nodes := []TreeNode{}
+	if deviceID == "" {
+		devices := []Devices{}
+		if _, err := db.FindT(db.DBClient, new(Devices), &devices, db.M{}, "deviceid", -1, -1, false); err != nil {
+			return nil, err
+		}
+		for _, d := range devices {
+			nodes = append(nodes, TreeNode{ID: d.DeviceID, DeviceID: d.DeviceID, Name: d.Name, Type: TreeNodeDevice, Status: d.Status})
+		}
+		return nodes, nil
+	}
+	orgWhere := db.M{"deviceid=?": deviceID}
+	channelWhere := db.M{"deviceid=?": deviceID}
+	root := id == "" || id == deviceID
+	if !root {
+		orgWhere["parentid=?"] = id
+		channelWhere["parentid=?"] = id
+	}
+	orgs := []Organizations{}
+	if _, err := db.FindT(db.DBClient, new(Organizations), &orgs, orgWhere, "orgid", -1, -1, false); err != nil {
+		return nil, err
+	}
+	if root {
+		var parents []string
+		orgs, parents = rootOrganizations(orgs)
+		if len(parents) > 0 {
+			// 升级前的通道没有上级节点
+			channelWhere["(parentid IS NULL OR parentid NOT IN (?))"] = parents
+		}
+	}
+	for _, org := range orgs {
+		nodes = append(nodes, TreeNode{ID: org.OrgID, DeviceID: deviceID, Name: org.Name, Type: org.Type, ParentID: org.ParentID})
+	}
+	channels := []Channels{}
+	if _, err := db.FindT(db.DBClient, new(Channels), &channels, channelWhere, "channelid", -1, -1, false); err != nil {
+		return nil, err
+	}
+	for _, c := range channels {
+		nodes = append(nodes, TreeNode{ID: c.ChannelID, DeviceID: deviceID, Name: c.Name, Type: TreeNodeChannel, ParentID: c.ParentID, Status: c.Status, Leaf: true})
+	}
+	return nodes, nil
+}
@@ -0,0 +1,69 @@
+package sipapi
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCatalogNodeType(t *testing.T) {
+	cases := map[string]string{
+		"34":                   TreeNodeCivil,
+		"340200":               TreeNodeCivil,
+		"34020000002000000001": TreeNodePlatform,
+		"34020000002150000001": TreeNodeBusiness,
+		"34020000002160000001": TreeNodeVirtual,
+		"34020000001320000001": TreeNodeChannel,
+		"3":                    "",
+		"340200000013200000":   "",
+	}
+	for id, want := range cases {
+		if got := catalogNodeType(id); got != want {
+			t.Errorf("%s: %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestCatalogParent(t *testing.T) {
+	device := "34020000002000000001"
+	cases := []struct {
+		item Channels
+		want string
+	}{
+		{Channels{ChannelID: "34020000001320000001", ParentID: "34020000002160000001"}, "34020000002160000001"},
+		// 以/分隔的上级路径取最后一级
+		{Channels{ChannelID: "34020000001320000001", ParentID: "34020000002150000001/34020000002160000001"}, "34020000002160000001"},
+		// 上级为设备自身时按编码规则计算
+		{Channels{ChannelID: "34020000001320000001", ParentID: device, CivilCode: "340200"}, "340200"},
+		{Channels{ChannelID: "34020000002160000001", BusinessGroupID: "34020000002150000001"}, "34020000002150000001"},
+		{Channels{ChannelID: "340200"}, "3402"},
+		{Channels{ChannelID: "34020000002150000001"}, ""},
+	}
+	for _, c := range cases {
+		if got := catalogParent(device, c.item); got != c.want {
+			t.Errorf("%+v: %q, want %q", c.item, got, c.want)
+		}
+	}
+}
+
+func TestRootOrganizations(t *testing.T) {
+	orgs := []Organizations{
+		{OrgID: "3402", ParentID: "34"},
+		{OrgID: "340200", ParentID: "3402"},
+		{OrgID: "34020000002150000001"},
+		{OrgID: "34020000002160000001", ParentID: "34020000002150000001"},
+	}
+	roots, all := rootOrganizations(orgs)
+	ids := []string{}
+	for _, org := range roots {
+		ids = append(ids, org.OrgID)
+	}
+	// 上级节点不在目录中的节点作为顶级节点，子节点逐级加载
+	if strings.Join(ids, ",") != "3402,34020000002150000001" {
+		t.Fatalf("roots %v", ids)
+	}
+	sort.Strings(all)
+	if strings.Join(all, ",") != "3402,340200,34020000002150000001,34020000002160000001" {
+		t.Fatalf("all %v", all)
+	}
+}
@@ -183,8 +183,25 @@ func Max(a, b int64) int64 {
 	return b
 }
 
+// Min Min
+func Min(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 // ResolveSelfIP ResolveSelfIP
 func ResolveSelfIP() (net.IP, error) {
+	return resolveSelfIP(false)
+}
+
+// ResolveSelfIPv6 获取本机ipv6地址，忽略链路本地地址
+func ResolveSelfIPv6() (net.IP, error) {
+	return resolveSelfIP(true)
+}
+
+func resolveSelfIP(v6 bool) (net.IP, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil, err
@@ -211,6 +228,12 @@ func ResolveSelfIP() (net.IP, error) {
 			if ip == nil || ip.IsLoopback() {
 				continue
 			}
+			if v6 {
+				if ip.To4() != nil || ip.IsLinkLocalUnicast() {
+					continue // not a global ipv6 address
+				}
+				return ip, nil
+			}
 			ip = ip.To4()
 			if ip == nil {
 				continue // not an ipv4 address